@@ -0,0 +1,27 @@
+// Command encrypt-phi encrypts PHI columns in rows written before field-level
+// encryption was enabled. It is safe to run more than once.
+//
+//	cd backend && go run ./cmd/encrypt-phi
+package main
+
+import (
+	"log"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/migrations"
+)
+
+func main() {
+	config.InitDB()
+
+	// Migrating the schema turns PHI columns into text so they can hold ciphertext
+	if err := migrations.MigrateSchema(); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	if err := migrations.EncryptPHIColumns(); err != nil {
+		log.Fatalf("Failed to encrypt PHI columns: %v", err)
+	}
+
+	log.Println("PHI columns encrypted successfully")
+}
@@ -10,7 +10,9 @@ import (
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 	
+	"github.com/adrianmcmains/telehealth-platform/encryption"
 	"github.com/adrianmcmains/telehealth-platform/models"
+	"github.com/adrianmcmains/telehealth-platform/tenancy"
 )
 
 var DB *gorm.DB
@@ -38,6 +40,13 @@ func InitDB() *gorm.DB {
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=UTC", 
 		host, user, password, dbname, port)
 	
+	// Set up field-level encryption for PHI columns
+	keyProvider, err := encryption.NewKeyProviderFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load field encryption keys: %v", err)
+	}
+	encryption.Configure(keyProvider)
+	
 	// Set up logger configuration
 	logConfig := logger.Config{
 		SlowThreshold: 200, // milliseconds
@@ -59,17 +68,48 @@ func InitDB() *gorm.DB {
 	
 	log.Println("Connected to database successfully")
 	
-	// Auto-migrate the models
-	err = DB.AutoMigrate(
+	// Scope tenant-owned tables to the organization in each query's context
+	if err := tenancy.RegisterCallbacks(DB); err != nil {
+		log.Fatalf("Failed to register tenancy callbacks: %v", err)
+	}
+	
+	return DB
+}
+
+// AutoMigrate creates or updates the tables for every model. It is run by
+// migrations.MigrateSchema, which prepares existing data first.
+func AutoMigrate(db *gorm.DB) error {
+	return db.AutoMigrate(
 		&models.User{},
 		&models.Appointment{},
 		&models.Payment{},
+		&models.NotificationLog{},
+		&models.DataExport{},
+		&models.AccountDeletionRequest{},
+		&models.Organization{},
+		&models.OrganizationMembership{},
+		&models.Review{},
+		&models.ReviewReport{},
+		&models.UserPreferences{},
+		&models.PendingNotification{},
+		&models.AvailabilityRule{},
+		&models.AvailabilityException{},
+		&models.AppointmentStatusChange{},
+		&models.AppointmentReschedule{},
+		&models.CancellationPolicy{},
+		&models.WaitlistEntry{},
+		&models.WaitlistOffer{},
+		&models.AppointmentSeries{},
+		&models.CalendarFeed{},
+		&models.VideoSessionEvent{},
+		&models.AppointmentType{},
+		&models.SchedulingRules{},
+		&models.Questionnaire{},
+		&models.QuestionnaireVersion{},
+		&models.IntakeResponse{},
+		&models.AppointmentEvent{},
+		&models.AppointmentParticipant{},
+		&models.GuestLink{},
 		// Add other models as needed
 	)
-	
-	if err != nil {
-		log.Fatalf("Failed to migrate database: %v", err)
-	}
-	
-	return DB
-}
\ No newline at end of file
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Postgres error codes the application handles explicitly
+const (
+	pgUniqueViolation    = "23505"
+	pgExclusionViolation = "23P01"
+)
+
+// IsUniqueViolation reports whether err was caused by a unique constraint
+func IsUniqueViolation(err error) bool {
+	return hasPgCode(err, pgUniqueViolation)
+}
+
+// IsExclusionViolation reports whether err was caused by an exclusion constraint,
+// such as the one that stops a doctor's active appointments from overlapping
+func IsExclusionViolation(err error) bool {
+	return hasPgCode(err, pgExclusionViolation)
+}
+
+func hasPgCode(err error, code string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == code
+}
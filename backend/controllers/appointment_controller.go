@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -11,39 +13,63 @@ import (
 	"github.com/adrianmcmains/telehealth-platform/config"
 	"github.com/adrianmcmains/telehealth-platform/models"
 	"github.com/adrianmcmains/telehealth-platform/services"
+	"github.com/adrianmcmains/telehealth-platform/tenancy"
 )
 
 // CreateAppointmentRequest represents the create appointment request body
 type CreateAppointmentRequest struct {
 	DoctorID  uint      `json:"doctorId" binding:"required"`
+	AppointmentTypeID uint `json:"appointmentTypeId"`
 	StartTime string    `json:"startTime" binding:"required"`
-	EndTime   string    `json:"endTime" binding:"required"`
-	Reason    string    `json:"reason" binding:"required"`
+	EndTime   string    `json:"endTime"`
+	Reason    string    `json:"reason" binding:"required,max=500"`
 }
 
 // UpdateAppointmentRequest represents the update appointment request body
 type UpdateAppointmentRequest struct {
 	Status   string `json:"status"`
-	Notes    string `json:"notes"`
+	Notes    string `json:"notes" binding:"max=1000"`
 	RoomID   string `json:"videoRoomId"`
 }
 
+// TransitionAppointmentRequest represents the change appointment status request body
+type TransitionAppointmentRequest struct {
+	Status string `json:"status" binding:"required"`
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// RescheduleAppointmentRequest represents the reschedule appointment request body
+type RescheduleAppointmentRequest struct {
+	StartTime string `json:"startTime" binding:"required"`
+	EndTime   string `json:"endTime"`
+	Reason    string `json:"reason" binding:"max=500"`
+}
+
 // AppointmentController handles appointment-related requests
 type AppointmentController struct {
 	DB                *gorm.DB
 	NotificationService *services.NotificationService
+	AvailabilityService *services.AvailabilityService
+	AppointmentService  *services.AppointmentService
+	IntakeService       *services.IntakeService
 }
 
 // NewAppointmentController creates a new instance of AppointmentController
 func NewAppointmentController() *AppointmentController {
 	return &AppointmentController{
 		DB: config.DB,
-		NotificationService: services.NewNotificationService(&gorm.DB{}),
+		NotificationService: services.NewNotificationService(config.DB),
+		AvailabilityService: services.NewAvailabilityService(),
+		AppointmentService:  services.NewAppointmentService(),
+		IntakeService:       services.NewIntakeService(),
 	}
 }
 
 // CreateAppointment creates a new appointment
 func (ac *AppointmentController) CreateAppointment(c *gin.Context) {
+	// Scope queries to the current organization
+	db := ac.DB.WithContext(c.Request.Context())
+	
 	// Get authenticated user ID from context
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -58,18 +84,46 @@ func (ac *AppointmentController) CreateAppointment(c *gin.Context) {
 		return
 	}
 	
-	// Parse start and end times
+	// Parse start time
 	startTime, err := time.Parse(time.RFC3339, request.StartTime)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start time format"})
 		return
 	}
 	
-	endTime, err := time.Parse(time.RFC3339, request.EndTime)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end time format"})
+	// Check the doctor belongs to the current organization
+	organizationID, _ := c.Get("organizationID")
+	var doctor models.User
+	if err := db.Scopes(tenancy.MembersWithRole(organizationID.(uint), string(models.RoleDoctor))).
+		First(&doctor, request.DoctorID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Doctor not found"})
+		return
+	}
+	
+	// Create appointment
+	appointment := models.Appointment{
+		PatientID: userID.(uint),
+		DoctorID:  request.DoctorID,
+		StartTime: startTime,
+		Status:    models.StatusScheduled,
+		Reason:    request.Reason,
+	}
+	
+	// The visit type sets the end time and price; without one the client sends the end time
+	appointmentType, ok := bookingType(c, db, doctor.ID, request.AppointmentTypeID)
+	if !ok {
 		return
 	}
+	if appointmentType != nil {
+		appointmentType.Apply(&appointment)
+	} else {
+		appointment.EndTime, err = time.Parse(time.RFC3339, request.EndTime)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end time format"})
+			return
+		}
+	}
+	endTime := appointment.EndTime
 	
 	// Validate time range
 	if startTime.After(endTime) {
@@ -77,53 +131,70 @@ func (ac *AppointmentController) CreateAppointment(c *gin.Context) {
 		return
 	}
 	
-	/**  // Check if the doctor exists
-	var doctor models.User
-	if err := ac.DB.Where("id = ? AND role = ?", request.DoctorID, models.RoleDoctor).First(&doctor).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Doctor not found"})
-		return
-	}**/
-
-	// Get the default doctor
-	var doctor models.User
-	if err := ac.DB.Where("role = ?", models.RoleDoctor).First(&doctor).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Default doctor not found"})
+	// Only future times can be booked
+	if !startTime.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Appointments must be booked in the future"})
 		return
 	}
 	
-	// Check for conflicting appointments
-	var conflictCount int64
-	ac.DB.Model(&models.Appointment{}).
-		Where("doctor_id = ? AND status != ? AND ((start_time <= ? AND end_time > ?) OR (start_time < ? AND end_time >= ?) OR (start_time >= ? AND end_time <= ?))",
-			request.DoctorID, models.StatusCancelled, endTime, startTime, endTime, startTime, startTime, endTime).
-		Count(&conflictCount)
+	// Check the time falls within the doctor's working hours
+	available, err := ac.AvailabilityService.IsAvailable(c.Request.Context(), doctor.ID, startTime, endTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check doctor availability"})
+		return
+	}
+	if !available {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The selected time is outside the doctor's availability"})
+		return
+	}
 	
-	if conflictCount > 0 {
-		c.JSON(http.StatusConflict, gin.H{"error": "The selected time slot is not available"})
+	// Apply the doctor's lead time, booking horizon, buffers and daily cap
+	if err := ac.AvailabilityService.CheckRules(c.Request.Context(), doctor.ID, startTime, endTime); err != nil {
+		switch {
+		case errors.Is(err, services.ErrBookingTooSoon), errors.Is(err, services.ErrBookingTooFar):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrBufferConflict), errors.Is(err, services.ErrDailyLimitReached):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check scheduling rules"})
+		}
 		return
 	}
 	
-	// Create appointment
-	appointment := models.Appointment{
-		PatientID: userID.(uint),
-		DoctorID:  request.DoctorID,
-		StartTime: startTime,
-		EndTime:   endTime,
-		Status:    models.StatusScheduled,
-		Reason:    request.Reason,
+	// Paid visits hold the slot until checkout completes
+	if appointment.Price > 0 {
+		ac.AppointmentService.Hold(&appointment)
 	}
 	
-	// Save appointment to database
-	if err := ac.DB.Create(&appointment).Error; err != nil {
+	// Save appointment to database with its first history entry; the overlap
+	// constraint rejects double bookings, so expired holds are released first
+	userRole, _ := c.Get("userRole")
+	actor := services.Actor{ID: userID.(uint), Role: models.UserRole(userRole.(string))}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := services.ReleaseExpiredHolds(tx, appointment.DoctorID, startTime, endTime); err != nil {
+			return err
+		}
+		if err := tx.Create(&appointment).Error; err != nil {
+			return err
+		}
+		return services.RecordAppointmentEvent(tx, &appointment, models.AppointmentEventCreated, actor, models.DiffAppointment(nil, &appointment), "")
+	})
+	if err != nil {
+		if config.IsExclusionViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "The selected time slot is not available"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create appointment"})
 		return
 	}
 	
 	// Load related entities for notification
-	ac.DB.Preload("Patient").Preload("Doctor").First(&appointment, appointment.ID)
+	db.Preload("Patient").Preload("Doctor").First(&appointment, appointment.ID)
 	
-	// Send appointment confirmation notification
-	go ac.NotificationService.SendAppointmentNotification(&appointment, services.NotificationTypeAppointmentConfirmation)
+	// Send appointment confirmation notification; held slots are confirmed once paid
+	if appointment.Status == models.StatusScheduled {
+		go ac.NotificationService.SendAppointmentNotification(&appointment, services.NotificationTypeAppointmentConfirmation)
+	}
 	
 	// Return created appointment
 	c.JSON(http.StatusCreated, gin.H{
@@ -135,6 +206,11 @@ func (ac *AppointmentController) CreateAppointment(c *gin.Context) {
 			"endTime":   appointment.EndTime,
 			"status":    appointment.Status,
 			"reason":    appointment.Reason,
+			"videoRoomId": appointment.VideoRoomID,
+			"appointmentTypeId": appointment.AppointmentTypeID,
+			"modality":  appointment.Modality,
+			"price":     appointment.Price,
+			"holdExpiresAt": appointment.HoldExpiresAt,
 			"createdAt": appointment.CreatedAt,
 		},
 	})
@@ -142,6 +218,9 @@ func (ac *AppointmentController) CreateAppointment(c *gin.Context) {
 
 // GetAppointment retrieves an appointment by ID
 func (ac *AppointmentController) GetAppointment(c *gin.Context) {
+	// Scope queries to the current organization
+	db := ac.DB.WithContext(c.Request.Context())
+	
 	// Get appointment ID from URL parameter
 	id := c.Param("id")
 	appointmentID, err := strconv.ParseUint(id, 10, 32)
@@ -160,19 +239,35 @@ func (ac *AppointmentController) GetAppointment(c *gin.Context) {
 	
 	// Find appointment by ID
 	var appointment models.Appointment
-	if err := ac.DB.Preload("Patient").Preload("Doctor").First(&appointment, appointmentID).Error; err != nil {
+	if err := db.Preload("Patient").Preload("Doctor").Preload("AppointmentType").First(&appointment, appointmentID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
 		return
 	}
 	
-	// Check if user is authorized to view this appointment
+	// Check if user is authorized to view this appointment; invited
+	// participants get a limited view until the appointment ends
 	if userRole != string(models.RoleAdmin) && 
 	   appointment.PatientID != userID.(uint) && 
 	   appointment.DoctorID != userID.(uint) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to view this appointment"})
+		participant, ok := services.ActiveParticipant(db, &appointment, userID.(uint))
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to view this appointment"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"appointment": participantView(&appointment, participant)})
 		return
 	}
 	
+	// Show the doctor the patient's intake answers
+	var intake *models.IntakeResponse
+	if userRole != string(models.RolePatient) {
+		intake, err = ac.IntakeService.Response(c.Request.Context(), appointment.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve intake answers"})
+			return
+		}
+	}
+	
 	// Return appointment details
 	c.JSON(http.StatusOK, gin.H{
 		"appointment": gin.H{
@@ -183,6 +278,12 @@ func (ac *AppointmentController) GetAppointment(c *gin.Context) {
 			"reason":    appointment.Reason,
 			"notes":     appointment.Notes,
 			"videoRoomId": appointment.VideoRoomID,
+			"modality":  appointment.Modality,
+			"price":     appointment.Price,
+			"isPaid":    appointment.IsPaid,
+			"holdExpiresAt": appointment.HoldExpiresAt,
+			"appointmentType": appointment.AppointmentType,
+			"intake":    intake,
 			"createdAt": appointment.CreatedAt,
 			"updatedAt": appointment.UpdatedAt,
 			"patient": gin.H{
@@ -201,8 +302,36 @@ func (ac *AppointmentController) GetAppointment(c *gin.Context) {
 	})
 }
 
+// participantView is what an invited participant sees of an appointment:
+// when it is, who is on it and where to join, but not the reason, notes,
+// intake answers or payment
+func participantView(appointment *models.Appointment, participant *models.AppointmentParticipant) gin.H {
+	return gin.H{
+		"id":          appointment.ID,
+		"startTime":   appointment.StartTime,
+		"endTime":     appointment.EndTime,
+		"status":      appointment.Status,
+		"videoRoomId": appointment.VideoRoomID,
+		"modality":    appointment.Modality,
+		"role":        participant.Role,
+		"patient": gin.H{
+			"id":        appointment.Patient.ID,
+			"firstName": appointment.Patient.FirstName,
+			"lastName":  appointment.Patient.LastName,
+		},
+		"doctor": gin.H{
+			"id":        appointment.Doctor.ID,
+			"firstName": appointment.Doctor.FirstName,
+			"lastName":  appointment.Doctor.LastName,
+		},
+	}
+}
+
 // UpdateAppointment updates an appointment
 func (ac *AppointmentController) UpdateAppointment(c *gin.Context) {
+	// Scope queries to the current organization
+	db := ac.DB.WithContext(c.Request.Context())
+	
 	// Get appointment ID from URL parameter
 	id := c.Param("id")
 	appointmentID, err := strconv.ParseUint(id, 10, 32)
@@ -228,7 +357,7 @@ func (ac *AppointmentController) UpdateAppointment(c *gin.Context) {
 	
 	// Find appointment by ID
 	var appointment models.Appointment
-	if err := ac.DB.First(&appointment, appointmentID).Error; err != nil {
+	if err := db.First(&appointment, appointmentID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
 		return
 	}
@@ -241,46 +370,131 @@ func (ac *AppointmentController) UpdateAppointment(c *gin.Context) {
 		return
 	}
 	
+	// Status changes go through the transitions endpoint
+	if request.Status != "" && request.Status != string(appointment.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Use POST /appointments/:id/transitions to change the status"})
+		return
+	}
+	
+	// The video room is assigned by the server when the appointment is booked
+	if request.RoomID != "" && request.RoomID != appointment.VideoRoomID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "videoRoomId is assigned by the server and cannot be changed"})
+		return
+	}
+	
 	// Update appointment fields if provided
-	if request.Status != "" {
-		// Validate status
-		validStatus := false
-		switch models.AppointmentStatus(request.Status) {
-		case models.StatusScheduled, models.StatusInProgress, models.StatusCompleted, models.StatusCancelled, models.StatusNoShow:
-			validStatus = true
-		}
-		
-		if !validStatus {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+	before := appointment
+	if request.Notes != "" {
+		appointment.Notes = request.Notes
+	}
+	
+	// Save updated appointment to database and record what changed
+	actor := services.Actor{ID: userID.(uint), Role: models.UserRole(userRole.(string))}
+	if err := saveAppointment(db, &before, &appointment, actor); err != nil {
+		if config.IsExclusionViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "This appointment now overlaps another booking"})
 			return
 		}
-		
-		appointment.Status = models.AppointmentStatus(request.Status)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update appointment"})
+		return
 	}
 	
-	if request.Notes != "" {
-		appointment.Notes = request.Notes
+	// Load related entities for notification
+	db.Preload("Patient").Preload("Doctor").First(&appointment, appointment.ID)
+	
+	// Let the patient know the appointment details changed
+	go ac.NotificationService.SendAppointmentNotification(&appointment, services.NotificationTypeAppointmentUpdate)
+	
+	// Return updated appointment
+	c.JSON(http.StatusOK, gin.H{
+		"appointment": gin.H{
+			"id":        appointment.ID,
+			"patientId": appointment.PatientID,
+			"doctorId":  appointment.DoctorID,
+			"startTime": appointment.StartTime,
+			"endTime":   appointment.EndTime,
+			"status":    appointment.Status,
+			"reason":    appointment.Reason,
+			"notes":     appointment.Notes,
+			"videoRoomId": appointment.VideoRoomID,
+			"updatedAt": appointment.UpdatedAt,
+		},
+	})
+}
+
+// PatchAppointment applies a JSON Merge Patch (RFC 7396) to an appointment
+func (ac *AppointmentController) PatchAppointment(c *gin.Context) {
+	// Scope queries to the current organization
+	db := ac.DB.WithContext(c.Request.Context())
+	
+	// Get appointment ID from URL parameter
+	id := c.Param("id")
+	appointmentID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return
+	}
+	
+	// Get authenticated user ID and role from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userRole, _ := c.Get("userRole")
+	
+	// Decode the patch document
+	patch, err := bindMergePatch(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	// Find appointment by ID
+	var appointment models.Appointment
+	if err := db.First(&appointment, appointmentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return
+	}
+	
+	// Check if user is authorized to update this appointment
+	if userRole != string(models.RoleAdmin) && 
+	   appointment.PatientID != userID.(uint) && 
+	   appointment.DoctorID != userID.(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to update this appointment"})
+		return
 	}
 	
-	if request.RoomID != "" {
-		appointment.VideoRoomID = request.RoomID
+	// Apply the patch
+	before := appointment
+	fieldErrors, err := applyMergePatch(patch, appointmentPatchRules(&appointment, userRole.(string)), userRole.(string))
+	if errors.Is(err, errPatchUnknownField) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown fields", "fields": fieldErrors})
+		return
+	}
+	if errors.Is(err, errPatchForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to change some of these fields", "fields": fieldErrors})
+		return
+	}
+	if len(fieldErrors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": fieldErrors})
+		return
 	}
 	
-	// Save updated appointment to database
-	if err := ac.DB.Save(&appointment).Error; err != nil {
+	// Save updated appointment to database and record what changed
+	actor := services.Actor{ID: userID.(uint), Role: models.UserRole(userRole.(string))}
+	if err := saveAppointment(db, &before, &appointment, actor); err != nil {
+		if config.IsExclusionViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "This appointment now overlaps another booking"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update appointment"})
 		return
 	}
 	
 	// Load related entities for notification
-	ac.DB.Preload("Patient").Preload("Doctor").First(&appointment, appointment.ID)
+	db.Preload("Patient").Preload("Doctor").First(&appointment, appointment.ID)
 	
-	// Send appropriate notification based on status change
-	if request.Status == string(models.StatusCancelled) {
-		go ac.NotificationService.SendAppointmentNotification(&appointment, services.NotificationTypeAppointmentCancellation)
-	} else if request.Status != "" {
-		go ac.NotificationService.SendAppointmentNotification(&appointment, services.NotificationTypeAppointmentUpdate)
-	}
 	
 	// Return updated appointment
 	c.JSON(http.StatusOK, gin.H{
@@ -299,8 +513,49 @@ func (ac *AppointmentController) UpdateAppointment(c *gin.Context) {
 	})
 }
 
+// saveAppointment saves an edited appointment together with a history entry
+// for the fields that changed
+func saveAppointment(db *gorm.DB, before, appointment *models.Appointment, actor services.Actor) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(appointment).Error; err != nil {
+			return err
+		}
+		return services.RecordAppointmentEvent(tx, appointment, models.AppointmentEventUpdated, actor, models.DiffAppointment(before, appointment), "")
+	})
+}
+
+// appointmentPatchRules lists the appointment fields that can be patched and who may change them
+func appointmentPatchRules(appointment *models.Appointment, role string) map[string]patchRule {
+	return withReadOnly(map[string]patchRule{
+		"reason": {
+			Roles: []models.UserRole{models.RolePatient, models.RoleAdmin},
+			Apply: func(raw json.RawMessage) (err error) {
+				appointment.Reason, err = patchRequiredString(raw, 500)
+				return err
+			},
+		},
+		"notes": {
+			Roles:    []models.UserRole{models.RoleDoctor, models.RoleAdmin},
+			Nullable: true,
+			Apply: func(raw json.RawMessage) (err error) {
+				if raw == nil {
+					appointment.Notes = ""
+					return nil
+				}
+				appointment.Notes, err = patchString(raw, 1000)
+				return err
+			},
+		},
+	}, "id", "organizationId", "patientId", "patient", "doctorId", "doctor", "startTime", "endTime",
+		"status", "videoRoomId", "isPaid", "price", "seriesId", "appointmentTypeId", "appointmentType",
+		"modality", "holdExpiresAt", "createdAt", "updatedAt")
+}
+
 // ListUserAppointments retrieves all appointments for a user
 func (ac *AppointmentController) ListUserAppointments(c *gin.Context) {
+	// Scope queries to the current organization
+	db := ac.DB.WithContext(c.Request.Context())
+	
 	// Get authenticated user ID from context
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -309,8 +564,28 @@ func (ac *AppointmentController) ListUserAppointments(c *gin.Context) {
 	}
 	userRole, _ := c.Get("userRole")
 	
+	// Read paging and sorting parameters
+	limit, err := pageLimit(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sort := c.DefaultQuery("sort", "startTime")
+	order, ok := appointmentSorts[sort]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be one of startTime, -startTime, createdAt, -createdAt"})
+		return
+	}
+	var cursor *pageCursor
+	if value := c.Query("cursor"); value != "" {
+		if cursor, err = decodePageCursor(value, sort); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+	}
+	
 	// Initialize query
-	query := ac.DB.Model(&models.Appointment{}).Preload("Patient").Preload("Doctor")
+	query := db.Model(&models.Appointment{})
 	
 	// Filter by user role
 	if userRole == string(models.RolePatient) {
@@ -319,21 +594,89 @@ func (ac *AppointmentController) ListUserAppointments(c *gin.Context) {
 		query = query.Where("doctor_id = ?", userID)
 	}
 	
-	// Get query parameters
-	status := c.Query("status")
-	if status != "" {
-		query = query.Where("status = ?", status)
+	// Filter by participants
+	for _, filter := range [][2]string{{"doctorId", "doctor_id"}, {"patientId", "patient_id"}} {
+		param, column := filter[0], filter[1]
+		if value := c.Query(param); value != "" {
+			id, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return
+			}
+			query = query.Where(column+" = ?", id)
+		}
+	}
+	
+	// Filter by one or more statuses
+	if statuses := queryList(c, "status"); len(statuses) > 0 {
+		for _, status := range statuses {
+			if !models.AppointmentStatus(status).Valid() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status: " + status})
+				return
+			}
+		}
+		query = query.Where("status IN ?", statuses)
+	}
+	
+	// Filter by paid state
+	if value := c.Query("paid"); value != "" {
+		paid, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "paid must be true or false"})
+			return
+		}
+		query = query.Where("is_paid = ?", paid)
 	}
 	
-	// Order by start time (upcoming first)
-	query = query.Order("start_time ASC")
+	// Filter by start time; dates without a time are read in the user's time zone
+	location := ac.AvailabilityService.UserLocation(userID.(uint))
+	if value := c.Query("from"); value != "" {
+		from, err := parseRangeBound(value, location, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date (YYYY-MM-DD) or an RFC3339 time"})
+			return
+		}
+		query = query.Where("start_time >= ?", from)
+	}
+	if value := c.Query("to"); value != "" {
+		to, err := parseRangeBound(value, location, true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date (YYYY-MM-DD) or an RFC3339 time"})
+			return
+		}
+		query = query.Where("start_time < ?", to)
+	}
+	
+	// Count every match before paging
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve appointments"})
+		return
+	}
 	
-	// Execute query
+	// Continue after the cursor, in the requested order
+	direction, comparison := "ASC", ">"
+	if order.desc {
+		direction, comparison = "DESC", "<"
+	}
+	if cursor != nil {
+		query = query.Where("("+order.column+", id) "+comparison+" (?, ?)", cursor.Value, cursor.ID)
+	}
+	query = query.Order(order.column + " " + direction).Order("id " + direction)
+	
+	// Fetch one extra row to know whether there is another page
 	var appointments []models.Appointment
-	if err := query.Find(&appointments).Error; err != nil {
+	if err := query.Preload("Patient").Preload("Doctor").Limit(limit + 1).Find(&appointments).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve appointments"})
 		return
 	}
+	var nextCursor *string
+	if len(appointments) > limit {
+		appointments = appointments[:limit]
+		last := appointments[limit-1]
+		next := pageCursor{Sort: sort, Value: order.value(&last), ID: last.ID}.encode()
+		nextCursor = &next
+	}
 	
 	// Transform to response format
 	response := make([]gin.H, len(appointments))
@@ -344,6 +687,7 @@ func (ac *AppointmentController) ListUserAppointments(c *gin.Context) {
 			"endTime":   appt.EndTime,
 			"status":    appt.Status,
 			"reason":    appt.Reason,
+			"seriesId":  appt.SeriesID,
 			"patient": gin.H{
 				"id":        appt.Patient.ID,
 				"firstName": appt.Patient.FirstName,
@@ -360,5 +704,343 @@ func (ac *AppointmentController) ListUserAppointments(c *gin.Context) {
 	// Return appointments list
 	c.JSON(http.StatusOK, gin.H{
 		"appointments": response,
+		"pagination": gin.H{
+			"total":      total,
+			"limit":      limit,
+			"nextCursor": nextCursor,
+		},
+	})
+}
+
+// appointmentSort is a listing order and the column it pages on
+type appointmentSort struct {
+	column string
+	desc   bool
+	value  func(*models.Appointment) time.Time
+}
+
+// appointmentSorts are the orders ListUserAppointments accepts
+var appointmentSorts = map[string]appointmentSort{
+	"startTime":  {column: "start_time", value: func(a *models.Appointment) time.Time { return a.StartTime }},
+	"-startTime": {column: "start_time", desc: true, value: func(a *models.Appointment) time.Time { return a.StartTime }},
+	"createdAt":  {column: "created_at", value: func(a *models.Appointment) time.Time { return a.CreatedAt }},
+	"-createdAt": {column: "created_at", desc: true, value: func(a *models.Appointment) time.Time { return a.CreatedAt }},
+}
+
+// TransitionAppointment changes an appointment's status through the lifecycle rules
+func (ac *AppointmentController) TransitionAppointment(c *gin.Context) {
+	// Scope queries to the current organization
+	db := ac.DB.WithContext(c.Request.Context())
+	
+	// Get appointment ID from URL parameter
+	id := c.Param("id")
+	appointmentID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return
+	}
+	
+	// Get authenticated user ID and role from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userRole, _ := c.Get("userRole")
+	
+	// Bind and validate request body
+	var request TransitionAppointmentRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	// Find appointment by ID
+	var appointment models.Appointment
+	if err := db.First(&appointment, appointmentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return
+	}
+	
+	actor := services.Actor{ID: userID.(uint), Role: models.UserRole(userRole.(string))}
+	change, err := ac.AppointmentService.Transition(c.Request.Context(), &appointment, models.AppointmentStatus(request.Status), actor, request.Reason)
+	if respondTransitionError(c, err, appointment.Status) {
+		return
+	}
+	
+	// Return updated appointment and the recorded change
+	c.JSON(http.StatusOK, gin.H{
+		"appointment": gin.H{
+			"id":        appointment.ID,
+			"status":    appointment.Status,
+			"isPaid":    appointment.IsPaid,
+			"updatedAt": appointment.UpdatedAt,
+		},
+		"transition": change,
+	})
+}
+
+// ListAppointmentTransitions returns an appointment's status history
+func (ac *AppointmentController) ListAppointmentTransitions(c *gin.Context) {
+	// Scope queries to the current organization
+	db := ac.DB.WithContext(c.Request.Context())
+	
+	// Get appointment ID from URL parameter
+	id := c.Param("id")
+	appointmentID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return
+	}
+	
+	// Get authenticated user ID and role from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userRole, _ := c.Get("userRole")
+	
+	// Find appointment by ID
+	var appointment models.Appointment
+	if err := db.First(&appointment, appointmentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return
+	}
+	
+	// Check if user is authorized to view this appointment
+	if userRole != string(models.RoleAdmin) && 
+	   appointment.PatientID != userID.(uint) && 
+	   appointment.DoctorID != userID.(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to view this appointment"})
+		return
+	}
+	
+	transitions, err := ac.AppointmentService.History(c.Request.Context(), appointment.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve status history"})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"status":      appointment.Status,
+		"transitions": transitions,
+	})
+}
+
+// ListAppointmentHistory returns every recorded change to an appointment:
+// creation, edits, status changes, reschedules and payment changes
+func (ac *AppointmentController) ListAppointmentHistory(c *gin.Context) {
+	// Scope queries to the current organization
+	db := ac.DB.WithContext(c.Request.Context())
+	
+	// Get appointment ID from URL parameter
+	id := c.Param("id")
+	appointmentID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return
+	}
+	
+	// Get authenticated user ID and role from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userRole, _ := c.Get("userRole")
+	
+	// Find appointment by ID
+	var appointment models.Appointment
+	if err := db.First(&appointment, appointmentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return
+	}
+	
+	// Check if user is authorized to view this appointment
+	if userRole != string(models.RoleAdmin) && 
+	   appointment.PatientID != userID.(uint) && 
+	   appointment.DoctorID != userID.(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to view this appointment"})
+		return
+	}
+	
+	events, err := ac.AppointmentService.Events(c.Request.Context(), appointment.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve appointment history"})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"appointmentId": appointment.ID,
+		"events":        events,
 	})
-}
\ No newline at end of file
+}
+
+// RescheduleAppointment moves an appointment to a new time slot
+func (ac *AppointmentController) RescheduleAppointment(c *gin.Context) {
+	// Scope queries to the current organization
+	db := ac.DB.WithContext(c.Request.Context())
+	
+	// Get appointment ID from URL parameter
+	id := c.Param("id")
+	appointmentID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return
+	}
+	
+	// Get authenticated user ID and role from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userRole, _ := c.Get("userRole")
+	
+	// Bind and validate request body
+	var request RescheduleAppointmentRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	// Find appointment by ID
+	var appointment models.Appointment
+	if err := db.First(&appointment, appointmentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return
+	}
+	
+	// Parse start and end times; a visit type keeps its length
+	startTime, err := time.Parse(time.RFC3339, request.StartTime)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start time format. Use RFC3339 format"})
+		return
+	}
+	endTime, err := time.Parse(time.RFC3339, visitEndTime(&appointment, startTime, request.EndTime))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end time format. Use RFC3339 format"})
+		return
+	}
+	if !startTime.Before(endTime) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start time must be before end time"})
+		return
+	}
+	if startTime.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Appointments cannot be moved into the past"})
+		return
+	}
+	
+	actor := services.Actor{ID: userID.(uint), Role: models.UserRole(userRole.(string))}
+	reschedule, err := ac.AppointmentService.Reschedule(c.Request.Context(), &appointment, startTime, endTime, actor, request.Reason)
+	if respondRescheduleError(c, err) {
+		return
+	}
+	
+	// Return moved appointment and the recorded reschedule
+	c.JSON(http.StatusOK, gin.H{
+		"appointment": gin.H{
+			"id":        appointment.ID,
+			"status":    appointment.Status,
+			"startTime": appointment.StartTime,
+			"endTime":   appointment.EndTime,
+			"isPaid":    appointment.IsPaid,
+			"updatedAt": appointment.UpdatedAt,
+		},
+		"reschedule": reschedule,
+	})
+}
+
+// ListAppointmentReschedules returns the times an appointment has been moved
+func (ac *AppointmentController) ListAppointmentReschedules(c *gin.Context) {
+	// Scope queries to the current organization
+	db := ac.DB.WithContext(c.Request.Context())
+	
+	// Get appointment ID from URL parameter
+	id := c.Param("id")
+	appointmentID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return
+	}
+	
+	// Get authenticated user ID and role from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userRole, _ := c.Get("userRole")
+	
+	// Find appointment by ID
+	var appointment models.Appointment
+	if err := db.First(&appointment, appointmentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return
+	}
+	
+	// Check if user is authorized to view this appointment
+	if userRole != string(models.RoleAdmin) && 
+	   appointment.PatientID != userID.(uint) && 
+	   appointment.DoctorID != userID.(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to view this appointment"})
+		return
+	}
+	
+	reschedules, err := ac.AppointmentService.Reschedules(c.Request.Context(), appointment.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve reschedule history"})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"startTime":   appointment.StartTime,
+		"endTime":     appointment.EndTime,
+		"reschedules": reschedules,
+	})
+}
+
+// respondRescheduleError writes the response for a failed reschedule and
+// reports whether there was an error
+func respondRescheduleError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, services.ErrTransitionForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to reschedule this appointment"})
+	case errors.Is(err, services.ErrSlotOutsideAvailability),
+		errors.Is(err, services.ErrBookingTooSoon),
+		errors.Is(err, services.ErrBookingTooFar):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrBufferConflict), errors.Is(err, services.ErrDailyLimitReached):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNotReschedulable),
+		errors.Is(err, services.ErrRescheduleTooLate),
+		errors.Is(err, services.ErrRescheduleLimitReached):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSlotUnavailable), errors.Is(err, services.ErrTransitionConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reschedule appointment"})
+	}
+	return true
+}
+
+// respondTransitionError writes the response for a failed status change and
+// reports whether there was an error
+func respondTransitionError(c *gin.Context, err error, status models.AppointmentStatus) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, services.ErrTransitionForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidTransition), errors.Is(err, services.ErrTransitionTooEarly):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "status": status})
+	case errors.Is(err, services.ErrTransitionConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change appointment status"})
+	}
+	return true
+}
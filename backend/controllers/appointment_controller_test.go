@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/encryption"
+	"github.com/adrianmcmains/telehealth-platform/migrations"
+	"github.com/adrianmcmains/telehealth-platform/models"
+	"github.com/adrianmcmains/telehealth-platform/tenancy"
+)
+
+// testDatabaseDSN names the variable holding a throwaway Postgres database
+// for tests that need the real overlap constraint
+const testDatabaseDSN = "TEST_DATABASE_DSN"
+
+// openTestDB connects to the test database and migrates it, skipping the
+// test when no database is configured
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv(testDatabaseDSN)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDatabaseDSN)
+	}
+
+	keyProvider, err := encryption.NewLocalFileKeyProvider(filepath.Join(t.TempDir(), "field_keys.json"))
+	if err != nil {
+		t.Fatalf("failed to create field encryption keys: %v", err)
+	}
+	encryption.Configure(keyProvider)
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	if err := tenancy.RegisterCallbacks(db); err != nil {
+		t.Fatalf("failed to register tenancy callbacks: %v", err)
+	}
+	if err := config.AutoMigrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	config.DB = db
+	if err := migrations.AddAppointmentOverlapConstraint(); err != nil {
+		t.Fatalf("failed to add overlap constraint: %v", err)
+	}
+	return db
+}
+
+// createMember creates a user who belongs to the organization with the given role
+func createMember(t *testing.T, db *gorm.DB, organizationID uint, role models.UserRole, email string) models.User {
+	t.Helper()
+
+	user := models.User{Email: email, PasswordHash: "!", FirstName: "Test", LastName: string(role), Role: role}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create %s: %v", role, err)
+	}
+	membership := models.OrganizationMembership{OrganizationID: organizationID, UserID: user.ID, Role: role}
+	if err := db.Create(&membership).Error; err != nil {
+		t.Fatalf("failed to add %s to organization: %v", role, err)
+	}
+	return user
+}
+
+func TestCreateAppointmentConcurrentBookingsForOneSlot(t *testing.T) {
+	db := openTestDB(t)
+	gin.SetMode(gin.TestMode)
+
+	const bookings = 10
+	suffix := time.Now().UnixNano()
+
+	organization := models.Organization{Name: "Concurrent bookings", Slug: fmt.Sprintf("concurrent-bookings-%d", suffix)}
+	if err := db.Create(&organization).Error; err != nil {
+		t.Fatalf("failed to create organization: %v", err)
+	}
+	doctor := createMember(t, db, organization.ID, models.RoleDoctor, fmt.Sprintf("doctor-%d@example.test", suffix))
+	patients := make([]models.User, bookings)
+	for i := range patients {
+		patients[i] = createMember(t, db, organization.ID, models.RolePatient, fmt.Sprintf("patient-%d-%d@example.test", suffix, i))
+	}
+
+	// A week out, inside a working day that covers the whole slot
+	start := time.Now().UTC().AddDate(0, 0, 7).Truncate(24 * time.Hour).Add(10 * time.Hour)
+	end := start.Add(30 * time.Minute)
+	rule := models.AvailabilityRule{
+		OrganizationID: organization.ID,
+		DoctorID:       doctor.ID,
+		Weekday:        start.Weekday(),
+		StartTime:      "08:00",
+		EndTime:        "18:00",
+	}
+	if err := db.Create(&rule).Error; err != nil {
+		t.Fatalf("failed to create availability: %v", err)
+	}
+
+	body, err := json.Marshal(CreateAppointmentRequest{
+		DoctorID:  doctor.ID,
+		StartTime: start.Format(time.RFC3339),
+		EndTime:   end.Format(time.RFC3339),
+		Reason:    "Concurrent booking",
+	})
+	if err != nil {
+		t.Fatalf("failed to encode request: %v", err)
+	}
+
+	controller := NewAppointmentController()
+	codes := make([]int, bookings)
+	ready := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range patients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/appointments", bytes.NewReader(body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Request = c.Request.WithContext(tenancy.WithOrganization(c.Request.Context(), organization.ID))
+			c.Set("userID", patients[i].ID)
+			c.Set("userRole", string(models.RolePatient))
+			c.Set("organizationID", organization.ID)
+
+			<-ready
+			controller.CreateAppointment(c)
+			codes[i] = w.Code
+		}(i)
+	}
+	close(ready)
+	wg.Wait()
+
+	var created, conflicts int
+	for i, code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+			conflicts++
+		default:
+			t.Errorf("booking %d: got status %d, want %d or %d", i, code, http.StatusCreated, http.StatusConflict)
+		}
+	}
+	if created != 1 || conflicts != bookings-1 {
+		t.Errorf("got %d created and %d conflicts, want 1 and %d", created, conflicts, bookings-1)
+	}
+
+	var active int64
+	if err := db.Model(&models.Appointment{}).
+		Where("doctor_id = ? AND status <> ?", doctor.ID, models.StatusCancelled).
+		Count(&active).Error; err != nil {
+		t.Fatalf("failed to count appointments: %v", err)
+	}
+	if active != 1 {
+		t.Errorf("got %d active appointments for the slot, want 1", active)
+	}
+}
@@ -0,0 +1,357 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+	"github.com/adrianmcmains/telehealth-platform/services"
+	"github.com/adrianmcmains/telehealth-platform/tenancy"
+)
+
+// CreateSeriesRequest represents the create appointment series request body.
+// Exactly one of Until (YYYY-MM-DD, in the doctor's time zone) and Count is required.
+type CreateSeriesRequest struct {
+	DoctorID          uint   `json:"doctorId" binding:"required"`
+	AppointmentTypeID uint   `json:"appointmentTypeId"`
+	StartTime         string `json:"startTime" binding:"required"`
+	EndTime           string `json:"endTime"`
+	Reason            string `json:"reason" binding:"required,max=500"`
+	Frequency         string `json:"frequency" binding:"required"`
+	Until             string `json:"until"`
+	Count             int    `json:"count" binding:"min=0"`
+	SkipConflicts     bool   `json:"skipConflicts"`
+}
+
+// CancelOccurrencesRequest represents the cancel series occurrences request body
+type CancelOccurrencesRequest struct {
+	Scope  string `json:"scope" binding:"required"`
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// RescheduleOccurrencesRequest represents the reschedule series occurrences request body
+type RescheduleOccurrencesRequest struct {
+	Scope     string `json:"scope" binding:"required"`
+	StartTime string `json:"startTime" binding:"required"`
+	EndTime   string `json:"endTime"`
+	Reason    string `json:"reason" binding:"max=500"`
+}
+
+// AppointmentSeriesController handles recurring appointment requests
+type AppointmentSeriesController struct {
+	DB                  *gorm.DB
+	AppointmentService  *services.AppointmentService
+	AvailabilityService *services.AvailabilityService
+}
+
+// NewAppointmentSeriesController creates a new instance of AppointmentSeriesController
+func NewAppointmentSeriesController() *AppointmentSeriesController {
+	return &AppointmentSeriesController{
+		DB:                  config.DB,
+		AppointmentService:  services.NewAppointmentService(),
+		AvailabilityService: services.NewAvailabilityService(),
+	}
+}
+
+// CreateSeries books a recurring series of appointments
+func (sc *AppointmentSeriesController) CreateSeries(c *gin.Context) {
+	// Scope queries to the current organization
+	db := sc.DB.WithContext(c.Request.Context())
+
+	// Get authenticated user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Bind and validate request body
+	var request CreateSeriesRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	frequency := models.RecurrenceFrequency(request.Frequency)
+	if _, ok := frequency.IntervalWeeks(); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "frequency must be weekly or biweekly"})
+		return
+	}
+	if (request.Until == "") == (request.Count == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Give either until or count"})
+		return
+	}
+	if request.Count > models.MaxSeriesOccurrences {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A series can have at most 52 appointments"})
+		return
+	}
+
+	// Check the doctor belongs to the current organization
+	organizationID, _ := c.Get("organizationID")
+	var doctor models.User
+	if err := db.Scopes(tenancy.MembersWithRole(organizationID.(uint), string(models.RoleDoctor))).
+		First(&doctor, request.DoctorID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Doctor not found"})
+		return
+	}
+
+	// The visit type sets each occurrence's length and price
+	appointmentType, ok := bookingType(c, db, doctor.ID, request.AppointmentTypeID)
+	if !ok {
+		return
+	}
+	if appointmentType != nil {
+		if start, err := time.Parse(time.RFC3339, request.StartTime); err == nil {
+			request.EndTime = start.Add(appointmentType.Duration()).Format(time.RFC3339)
+		}
+	}
+	startTime, endTime, ok := parseTimeRange(c, request.StartTime, request.EndTime)
+	if !ok {
+		return
+	}
+
+	series := models.AppointmentSeries{
+		PatientID:       userID.(uint),
+		DoctorID:        doctor.ID,
+		Frequency:       frequency,
+		StartTime:       startTime,
+		EndTime:         endTime,
+		Count:           request.Count,
+		Reason:          request.Reason,
+		AppointmentType: appointmentType,
+	}
+	if appointmentType != nil {
+		series.AppointmentTypeID = &appointmentType.ID
+	}
+	if request.Until != "" {
+		// The series runs to the end of that day in the doctor's time zone
+		until, err := parseRangeBound(request.Until, sc.AvailabilityService.DoctorLocation(doctor.ID), true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "until must be a date (YYYY-MM-DD)"})
+			return
+		}
+		until = until.Add(-time.Second)
+		series.Until = &until
+	}
+
+	userRole, _ := c.Get("userRole")
+	actor := services.Actor{ID: userID.(uint), Role: models.UserRole(userRole.(string))}
+	appointments, conflicts, err := sc.AppointmentService.CreateSeries(c.Request.Context(), &series, request.SkipConflicts, actor)
+	switch {
+	case errors.Is(err, services.ErrInvalidRecurrence), errors.Is(err, services.ErrPaidSeries):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrSeriesConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "conflicts": conflicts})
+		return
+	case errors.Is(err, services.ErrSlotUnavailable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create appointment series"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"series":       series,
+		"appointments": seriesAppointmentsResponse(appointments),
+		"skipped":      conflicts,
+	})
+}
+
+// GetSeries returns a series and its appointments
+func (sc *AppointmentSeriesController) GetSeries(c *gin.Context) {
+	// Scope queries to the current organization
+	db := sc.DB.WithContext(c.Request.Context())
+
+	seriesID, err := strconv.ParseUint(c.Param("seriesId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid series ID"})
+		return
+	}
+
+	// Get authenticated user ID and role from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userRole, _ := c.Get("userRole")
+
+	var series models.AppointmentSeries
+	if err := db.First(&series, seriesID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Series not found"})
+		return
+	}
+	if userRole != string(models.RoleAdmin) &&
+		series.PatientID != userID.(uint) &&
+		series.DoctorID != userID.(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to view this series"})
+		return
+	}
+
+	var appointments []models.Appointment
+	if err := db.Where("series_id = ?", series.ID).Order("start_time ASC").Find(&appointments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve series appointments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"series":       series,
+		"appointments": seriesAppointmentsResponse(appointments),
+	})
+}
+
+// CancelOccurrences cancels one occurrence of a series, or it and all that follow
+func (sc *AppointmentSeriesController) CancelOccurrences(c *gin.Context) {
+	// Bind and validate request body
+	var request CancelOccurrencesRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	scope := models.SeriesScope(request.Scope)
+	if !scope.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scope must be this or following"})
+		return
+	}
+
+	appointment, actor, ok := sc.loadOccurrence(c)
+	if !ok {
+		return
+	}
+
+	changes, err := sc.AppointmentService.CancelOccurrences(c.Request.Context(), appointment, scope, actor, request.Reason)
+	if errors.Is(err, services.ErrNotInSeries) || errors.Is(err, services.ErrNotReschedulable) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	// Report what was cancelled before a failure part way through
+	if err != nil && len(changes) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "cancelled": changes})
+		return
+	}
+	if respondTransitionError(c, err, appointment.Status) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"cancelled": changes,
+	})
+}
+
+// RescheduleOccurrences moves one occurrence of a series, or it and all that follow
+func (sc *AppointmentSeriesController) RescheduleOccurrences(c *gin.Context) {
+	// Bind and validate request body
+	var request RescheduleOccurrencesRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	scope := models.SeriesScope(request.Scope)
+	if !scope.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scope must be this or following"})
+		return
+	}
+	appointment, actor, ok := sc.loadOccurrence(c)
+	if !ok {
+		return
+	}
+
+	// A visit type keeps its length
+	if start, err := time.Parse(time.RFC3339, request.StartTime); err == nil {
+		request.EndTime = visitEndTime(appointment, start, request.EndTime)
+	}
+	startTime, endTime, ok := parseTimeRange(c, request.StartTime, request.EndTime)
+	if !ok {
+		return
+	}
+
+	reschedules, conflicts, err := sc.AppointmentService.RescheduleOccurrences(c.Request.Context(), appointment, scope, startTime, endTime, actor, request.Reason)
+	switch {
+	case errors.Is(err, services.ErrSeriesConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "conflicts": conflicts})
+		return
+	case errors.Is(err, services.ErrNotInSeries):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if respondRescheduleError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reschedules": reschedules,
+	})
+}
+
+// loadOccurrence finds the appointment in the URL and the acting user
+func (sc *AppointmentSeriesController) loadOccurrence(c *gin.Context) (*models.Appointment, services.Actor, bool) {
+	// Scope queries to the current organization
+	db := sc.DB.WithContext(c.Request.Context())
+
+	appointmentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return nil, services.Actor{}, false
+	}
+
+	// Get authenticated user ID and role from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, services.Actor{}, false
+	}
+	userRole, _ := c.Get("userRole")
+
+	var appointment models.Appointment
+	if err := db.First(&appointment, appointmentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return nil, services.Actor{}, false
+	}
+
+	return &appointment, services.Actor{ID: userID.(uint), Role: models.UserRole(userRole.(string))}, true
+}
+
+// parseTimeRange parses RFC3339 start and end times for a future appointment
+func parseTimeRange(c *gin.Context, start, end string) (time.Time, time.Time, bool) {
+	startTime, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start time format. Use RFC3339 format"})
+		return time.Time{}, time.Time{}, false
+	}
+	endTime, err := time.Parse(time.RFC3339, end)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end time format. Use RFC3339 format"})
+		return time.Time{}, time.Time{}, false
+	}
+	if !startTime.Before(endTime) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start time must be before end time"})
+		return time.Time{}, time.Time{}, false
+	}
+	if !startTime.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Appointments must be booked in the future"})
+		return time.Time{}, time.Time{}, false
+	}
+	return startTime, endTime, true
+}
+
+// seriesAppointmentsResponse formats the appointments of a series
+func seriesAppointmentsResponse(appointments []models.Appointment) []gin.H {
+	response := make([]gin.H, len(appointments))
+	for i, appointment := range appointments {
+		response[i] = gin.H{
+			"id":        appointment.ID,
+			"startTime": appointment.StartTime,
+			"endTime":   appointment.EndTime,
+			"status":    appointment.Status,
+		}
+	}
+	return response
+}
@@ -0,0 +1,239 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// AppointmentTypeRequest represents the create or update appointment type request body
+type AppointmentTypeRequest struct {
+	Name            string                     `json:"name" binding:"required,max=100"`
+	Description     string                     `json:"description" binding:"max=500"`
+	DurationMinutes int                        `json:"durationMinutes" binding:"required,min=5,max=240"`
+	Modality        models.AppointmentModality `json:"modality"`
+	Price           *float64                   `json:"price" binding:"required,min=0"`
+	IntakeFormURL   string                     `json:"intakeFormUrl" binding:"omitempty,url,max=500"`
+	QuestionnaireID *uint                      `json:"questionnaireId"`
+	Active          *bool                      `json:"active"`
+}
+
+// AppointmentTypeController handles the visit types doctors offer
+type AppointmentTypeController struct {
+	DB *gorm.DB
+}
+
+// NewAppointmentTypeController creates a new instance of AppointmentTypeController
+func NewAppointmentTypeController() *AppointmentTypeController {
+	return &AppointmentTypeController{
+		DB: config.DB,
+	}
+}
+
+// ListAppointmentTypes returns the visit types a doctor offers. The doctor and
+// admins also see inactive types.
+func (tc *AppointmentTypeController) ListAppointmentTypes(c *gin.Context) {
+	// Scope queries to the current organization
+	db := tc.DB.WithContext(c.Request.Context())
+
+	doctorID, ok := loadDoctor(c, db)
+	if !ok {
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	userRole, _ := c.Get("userRole")
+	query := db.Where("doctor_id = ?", doctorID)
+	if userID.(uint) != doctorID && userRole != string(models.RoleAdmin) {
+		query = query.Where("active = ?", true)
+	}
+
+	var types []models.AppointmentType
+	if err := query.Order("duration_minutes ASC, name ASC").Find(&types).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve appointment types"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"appointmentTypes": types,
+	})
+}
+
+// CreateAppointmentType adds a visit type to a doctor's offering
+func (tc *AppointmentTypeController) CreateAppointmentType(c *gin.Context) {
+	// Scope queries to the current organization
+	db := tc.DB.WithContext(c.Request.Context())
+
+	doctorID, ok := loadDoctor(c, db)
+	if !ok || !authorizeDoctorOrAdmin(c, doctorID) {
+		return
+	}
+
+	// Bind and validate request body
+	var request AppointmentTypeRequest
+	if !bindAppointmentType(c, &request) || !checkTypeQuestionnaire(c, db, doctorID, request.QuestionnaireID) {
+		return
+	}
+
+	appointmentType := models.AppointmentType{DoctorID: doctorID}
+	applyAppointmentType(&appointmentType, request)
+	if err := db.Create(&appointmentType).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create appointment type"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"appointmentType": appointmentType,
+	})
+}
+
+// UpdateAppointmentType replaces a visit type's settings. Appointments already
+// booked keep the length and price they were booked with.
+func (tc *AppointmentTypeController) UpdateAppointmentType(c *gin.Context) {
+	// Scope queries to the current organization
+	db := tc.DB.WithContext(c.Request.Context())
+
+	appointmentType, ok := tc.loadAppointmentType(c, db)
+	if !ok {
+		return
+	}
+
+	// Bind and validate request body
+	var request AppointmentTypeRequest
+	if !bindAppointmentType(c, &request) || !checkTypeQuestionnaire(c, db, appointmentType.DoctorID, request.QuestionnaireID) {
+		return
+	}
+
+	applyAppointmentType(appointmentType, request)
+	if err := db.Save(appointmentType).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update appointment type"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"appointmentType": appointmentType,
+	})
+}
+
+// DeleteAppointmentType removes a visit type; booked appointments are not affected
+func (tc *AppointmentTypeController) DeleteAppointmentType(c *gin.Context) {
+	// Scope queries to the current organization
+	db := tc.DB.WithContext(c.Request.Context())
+
+	appointmentType, ok := tc.loadAppointmentType(c, db)
+	if !ok {
+		return
+	}
+
+	if err := db.Delete(appointmentType).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete appointment type"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Appointment type deleted"})
+}
+
+// loadAppointmentType finds the doctor's type in the URL and checks the caller may manage it
+func (tc *AppointmentTypeController) loadAppointmentType(c *gin.Context, db *gorm.DB) (*models.AppointmentType, bool) {
+	doctorID, ok := loadDoctor(c, db)
+	if !ok || !authorizeDoctorOrAdmin(c, doctorID) {
+		return nil, false
+	}
+
+	typeID, err := strconv.ParseUint(c.Param("typeId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment type ID"})
+		return nil, false
+	}
+
+	var appointmentType models.AppointmentType
+	if err := db.Where("doctor_id = ?", doctorID).First(&appointmentType, typeID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment type not found"})
+		return nil, false
+	}
+	return &appointmentType, true
+}
+
+// bindAppointmentType binds the request body and defaults the modality to video
+func bindAppointmentType(c *gin.Context, request *AppointmentTypeRequest) bool {
+	if err := c.ShouldBindJSON(request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if request.Modality == "" {
+		request.Modality = models.ModalityVideo
+	}
+	if !request.Modality.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "modality must be video or audio"})
+		return false
+	}
+	return true
+}
+
+// checkTypeQuestionnaire checks a type's questionnaire is the doctor's own or shared by the organization
+func checkTypeQuestionnaire(c *gin.Context, db *gorm.DB, doctorID uint, questionnaireID *uint) bool {
+	if questionnaireID == nil {
+		return true
+	}
+	var questionnaire models.Questionnaire
+	if err := db.Where("doctor_id IN ?", []uint{0, doctorID}).First(&questionnaire, *questionnaireID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Questionnaire not found"})
+		return false
+	}
+	return true
+}
+
+// applyAppointmentType copies the request onto a type
+func applyAppointmentType(appointmentType *models.AppointmentType, request AppointmentTypeRequest) {
+	appointmentType.Name = request.Name
+	appointmentType.Description = request.Description
+	appointmentType.DurationMinutes = request.DurationMinutes
+	appointmentType.Modality = request.Modality
+	appointmentType.Price = *request.Price
+	appointmentType.IntakeFormURL = request.IntakeFormURL
+	appointmentType.QuestionnaireID = request.QuestionnaireID
+	appointmentType.Active = request.Active == nil || *request.Active
+}
+
+// bookingType finds the visit type a booking asks for. Doctors who offer
+// types must be booked through one of them; for other doctors the type is
+// nil and the client's end time is used.
+func bookingType(c *gin.Context, db *gorm.DB, doctorID, typeID uint) (*models.AppointmentType, bool) {
+	if typeID == 0 {
+		var offered int64
+		if err := db.Model(&models.AppointmentType{}).Where("doctor_id = ? AND active = ?", doctorID, true).
+			Count(&offered).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve appointment types"})
+			return nil, false
+		}
+		if offered > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "appointmentTypeId is required for this doctor"})
+			return nil, false
+		}
+		return nil, true
+	}
+
+	var appointmentType models.AppointmentType
+	if err := db.Where("doctor_id = ? AND active = ?", doctorID, true).First(&appointmentType, typeID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment type not found"})
+		return nil, false
+	}
+	return &appointmentType, true
+}
+
+// visitEndTime returns the end time for moving an appointment to start. A
+// typed appointment keeps the length it was booked with, whatever the client
+// sent, even if the visit type has changed since; an untyped one uses the
+// client's end time.
+func visitEndTime(appointment *models.Appointment, start time.Time, end string) string {
+	if appointment.AppointmentTypeID == nil {
+		return end
+	}
+	return start.Add(appointment.EndTime.Sub(appointment.StartTime)).Format(time.RFC3339)
+}
@@ -24,7 +24,7 @@ type RegisterRequest struct {
 	Password  string `json:"password" binding:"required,min=8"`
 	FirstName string `json:"firstName" binding:"required"`
 	LastName  string `json:"lastName" binding:"required"`
-	Role      string `json:"role"`
+	Organization string `json:"organization"`
 }
 
 // AuthController handles authentication related requests
@@ -115,20 +115,13 @@ func (ac *AuthController) Register(c *gin.Context) {
 		return
 	}
 	
-	// Create new user
+	// Create new user; self-registered users are always patients, and only an
+	// organization admin can make someone a doctor or admin
 	user := models.User{
 		Email:     request.Email,
 		FirstName: request.FirstName,
 		LastName:  request.LastName,
-	}
-	
-	// Set role (default to patient if not specified or invalid)
-	if request.Role == string(models.RoleDoctor) {
-		user.Role = models.RoleDoctor
-	} else if request.Role == string(models.RoleAdmin) {
-		user.Role = models.RoleAdmin
-	} else {
-		user.Role = models.RolePatient
+		Role:      models.RolePatient,
 	}
 	
 	// Hash password
@@ -137,8 +130,29 @@ func (ac *AuthController) Register(c *gin.Context) {
 		return
 	}
 	
-	// Save user to database
-	if err := ac.DB.Create(&user).Error; err != nil {
+	// Find the organization to join (the default clinic if none was given)
+	organizationSlug := request.Organization
+	if organizationSlug == "" {
+		organizationSlug = models.DefaultOrganizationSlug
+	}
+	var organization models.Organization
+	if err := ac.DB.Where("slug = ?", organizationSlug).First(&organization).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Organization not found"})
+		return
+	}
+	
+	// Save user and their membership to database
+	err := ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.OrganizationMembership{
+			OrganizationID: organization.ID,
+			UserID:         user.ID,
+			Role:           models.RolePatient,
+		}).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
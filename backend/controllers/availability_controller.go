@@ -0,0 +1,397 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+	"github.com/adrianmcmains/telehealth-platform/services"
+	"github.com/adrianmcmains/telehealth-platform/tenancy"
+)
+
+// maxSlotRange limits how far ahead a single slot search may look
+const maxSlotRange = 31 * 24 * time.Hour
+
+// WeeklyHoursRequest represents one recurring weekly working window
+type WeeklyHoursRequest struct {
+	Weekday   time.Weekday `json:"weekday" binding:"min=0,max=6"`
+	StartTime string       `json:"startTime" binding:"required"`
+	EndTime   string       `json:"endTime" binding:"required"`
+}
+
+// UpdateWeeklyHoursRequest represents the replace weekly hours request body
+type UpdateWeeklyHoursRequest struct {
+	Hours []WeeklyHoursRequest `json:"hours" binding:"dive"`
+}
+
+// CreateExceptionRequest represents the create availability exception request body
+type CreateExceptionRequest struct {
+	Date      string `json:"date" binding:"required"`
+	Available bool   `json:"available"`
+	StartTime string `json:"startTime"`
+	EndTime   string `json:"endTime"`
+	Reason    string `json:"reason" binding:"max=255"`
+}
+
+// SchedulingRulesRequest represents the set scheduling rules request body.
+// Zero switches a rule off.
+type SchedulingRulesRequest struct {
+	BufferBeforeMinutes int `json:"bufferBeforeMinutes" binding:"min=0,max=240"`
+	BufferAfterMinutes  int `json:"bufferAfterMinutes" binding:"min=0,max=240"`
+	MinLeadMinutes      int `json:"minLeadMinutes" binding:"min=0,max=43200"`
+	MaxHorizonDays      int `json:"maxHorizonDays" binding:"min=0,max=730"`
+	MaxPerDay           int `json:"maxPerDay" binding:"min=0,max=100"`
+}
+
+// AvailabilityController handles doctor working hours and slot requests
+type AvailabilityController struct {
+	DB                  *gorm.DB
+	AvailabilityService *services.AvailabilityService
+}
+
+// NewAvailabilityController creates a new instance of AvailabilityController
+func NewAvailabilityController() *AvailabilityController {
+	return &AvailabilityController{
+		DB:                  config.DB,
+		AvailabilityService: services.NewAvailabilityService(),
+	}
+}
+
+// GetAvailability returns a doctor's weekly hours and upcoming exceptions
+func (ac *AvailabilityController) GetAvailability(c *gin.Context) {
+	// Scope queries to the current organization
+	db := ac.DB.WithContext(c.Request.Context())
+
+	doctorID, ok := loadDoctor(c, db)
+	if !ok {
+		return
+	}
+
+	var rules []models.AvailabilityRule
+	if err := db.Where("doctor_id = ?", doctorID).Order("weekday ASC, start_time ASC").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve availability"})
+		return
+	}
+
+	location := ac.AvailabilityService.DoctorLocation(doctorID)
+	today := time.Now().In(location).Format(models.ExceptionDateFormat)
+	var exceptions []models.AvailabilityException
+	if err := db.Where("doctor_id = ? AND date >= ?", doctorID, today).Order("date ASC, start_time ASC").
+		Find(&exceptions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve availability"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"timeZone":   location.String(),
+		"hours":      rules,
+		"exceptions": exceptions,
+	})
+}
+
+// UpdateWeeklyHours replaces a doctor's recurring weekly hours
+func (ac *AvailabilityController) UpdateWeeklyHours(c *gin.Context) {
+	// Scope queries to the current organization
+	db := ac.DB.WithContext(c.Request.Context())
+
+	doctorID, ok := loadDoctor(c, db)
+	if !ok || !authorizeDoctorOrAdmin(c, doctorID) {
+		return
+	}
+
+	// Bind and validate request body
+	var request UpdateWeeklyHoursRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rules := make([]models.AvailabilityRule, len(request.Hours))
+	for i, hours := range request.Hours {
+		if !validClockRange(hours.StartTime, hours.EndTime) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Each window needs HH:MM start and end times with the start before the end"})
+			return
+		}
+		rules[i] = models.AvailabilityRule{
+			DoctorID:  doctorID,
+			Weekday:   hours.Weekday,
+			StartTime: hours.StartTime,
+			EndTime:   hours.EndTime,
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("doctor_id = ?", doctorID).Delete(&models.AvailabilityRule{}).Error; err != nil {
+			return err
+		}
+		if len(rules) == 0 {
+			return nil
+		}
+		return tx.Create(&rules).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update availability"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"hours": rules,
+	})
+}
+
+// CreateException adds a date-specific change to a doctor's hours
+func (ac *AvailabilityController) CreateException(c *gin.Context) {
+	// Scope queries to the current organization
+	db := ac.DB.WithContext(c.Request.Context())
+
+	doctorID, ok := loadDoctor(c, db)
+	if !ok || !authorizeDoctorOrAdmin(c, doctorID) {
+		return
+	}
+
+	// Bind and validate request body
+	var request CreateExceptionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := time.Parse(models.ExceptionDateFormat, request.Date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Date must be in YYYY-MM-DD format"})
+		return
+	}
+	wholeDay := request.StartTime == "" && request.EndTime == ""
+	if (request.Available || !wholeDay) && !validClockRange(request.StartTime, request.EndTime) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Exceptions need HH:MM start and end times with the start before the end, unless they block the whole day"})
+		return
+	}
+
+	exception := models.AvailabilityException{
+		DoctorID:  doctorID,
+		Date:      request.Date,
+		Available: request.Available,
+		StartTime: request.StartTime,
+		EndTime:   request.EndTime,
+		Reason:    request.Reason,
+	}
+	if err := db.Create(&exception).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create exception"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"exception": exception,
+	})
+}
+
+// DeleteException removes a date-specific change to a doctor's hours
+func (ac *AvailabilityController) DeleteException(c *gin.Context) {
+	// Scope queries to the current organization
+	db := ac.DB.WithContext(c.Request.Context())
+
+	doctorID, ok := loadDoctor(c, db)
+	if !ok || !authorizeDoctorOrAdmin(c, doctorID) {
+		return
+	}
+
+	exceptionID, err := strconv.ParseUint(c.Param("exceptionId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exception ID"})
+		return
+	}
+
+	result := db.Where("id = ? AND doctor_id = ?", exceptionID, doctorID).Delete(&models.AvailabilityException{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete exception"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exception not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Exception deleted"})
+}
+
+// ListSlots returns the doctor's free slots in a date range
+func (ac *AvailabilityController) ListSlots(c *gin.Context) {
+	// Scope queries to the current organization
+	db := ac.DB.WithContext(c.Request.Context())
+
+	doctorID, ok := loadDoctor(c, db)
+	if !ok {
+		return
+	}
+
+	// Dates without a time are read in the doctor's time zone
+	location := ac.AvailabilityService.DoctorLocation(doctorID)
+	from, err := parseRangeBound(c.Query("from"), location, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date (YYYY-MM-DD) or an RFC3339 time"})
+		return
+	}
+	to, err := parseRangeBound(c.Query("to"), location, true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date (YYYY-MM-DD) or an RFC3339 time"})
+		return
+	}
+	if !from.Before(to) || to.Sub(from) > maxSlotRange {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to, at most 31 days apart"})
+		return
+	}
+
+	// Slots are as long as the chosen visit type, or durationMinutes
+	durationMinutes := 30
+	if value := c.Query("appointmentTypeId"); value != "" {
+		typeID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid appointmentTypeId"})
+			return
+		}
+		var appointmentType models.AppointmentType
+		if err := db.Where("doctor_id = ? AND active = ?", doctorID, true).First(&appointmentType, typeID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Appointment type not found"})
+			return
+		}
+		durationMinutes = appointmentType.DurationMinutes
+	} else if value := c.Query("durationMinutes"); value != "" {
+		durationMinutes, err = strconv.Atoi(value)
+		if err != nil || durationMinutes < 5 || durationMinutes > 240 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "durationMinutes must be between 5 and 240"})
+			return
+		}
+	}
+
+	slots, err := ac.AvailabilityService.FreeSlots(c.Request.Context(), doctorID, from, to, time.Duration(durationMinutes)*time.Minute)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate free slots"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"doctorId": doctorID,
+		"timeZone": location.String(),
+		"slots":    slots,
+	})
+}
+
+// GetSchedulingRules returns a doctor's scheduling rules
+func (ac *AvailabilityController) GetSchedulingRules(c *gin.Context) {
+	// Scope queries to the current organization
+	db := ac.DB.WithContext(c.Request.Context())
+
+	doctorID, ok := loadDoctor(c, db)
+	if !ok {
+		return
+	}
+
+	rules, err := ac.AvailabilityService.SchedulingRules(c.Request.Context(), doctorID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scheduling rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// UpdateSchedulingRules replaces a doctor's scheduling rules. Existing
+// appointments are kept even if they break the new rules.
+func (ac *AvailabilityController) UpdateSchedulingRules(c *gin.Context) {
+	// Scope queries to the current organization
+	db := ac.DB.WithContext(c.Request.Context())
+
+	doctorID, ok := loadDoctor(c, db)
+	if !ok || !authorizeDoctorOrAdmin(c, doctorID) {
+		return
+	}
+
+	// Bind and validate request body
+	var request SchedulingRulesRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	organizationID, _ := c.Get("organizationID")
+	rules := models.SchedulingRules{
+		OrganizationID:      organizationID.(uint),
+		DoctorID:            doctorID,
+		BufferBeforeMinutes: request.BufferBeforeMinutes,
+		BufferAfterMinutes:  request.BufferAfterMinutes,
+		MinLeadMinutes:      request.MinLeadMinutes,
+		MaxHorizonDays:      request.MaxHorizonDays,
+		MaxPerDay:           request.MaxPerDay,
+	}
+	err := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "organization_id"}, {Name: "doctor_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"buffer_before_minutes", "buffer_after_minutes", "min_lead_minutes",
+			"max_horizon_days", "max_per_day", "updated_at",
+		}),
+	}).Create(&rules).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scheduling rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// loadDoctor checks the doctor in the URL belongs to the current organization
+func loadDoctor(c *gin.Context, db *gorm.DB) (uint, bool) {
+	doctorID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid doctor ID"})
+		return 0, false
+	}
+
+	organizationID, _ := c.Get("organizationID")
+	var doctor models.User
+	if err := db.Scopes(tenancy.MembersWithRole(organizationID.(uint), string(models.RoleDoctor))).
+		First(&doctor, doctorID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Doctor not found"})
+		return 0, false
+	}
+
+	return doctor.ID, true
+}
+
+// authorizeDoctorOrAdmin allows the doctor themselves or an admin to manage their schedule
+func authorizeDoctorOrAdmin(c *gin.Context, doctorID uint) bool {
+	userID, _ := c.Get("userID")
+	userRole, _ := c.Get("userRole")
+	if userID.(uint) != doctorID && userRole != string(models.RoleAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only manage your own schedule"})
+		return false
+	}
+	return true
+}
+
+// validClockRange reports whether two HH:MM times form a non-empty window
+func validClockRange(start, end string) bool {
+	startMinutes, okStart := models.ParseClock(start)
+	endMinutes, okEnd := models.ParseClock(end)
+	return okStart && okEnd && startMinutes < endMinutes
+}
+
+// parseRangeBound parses an RFC3339 time, or a date in the given location.
+// A date used as an end bound covers that whole day.
+func parseRangeBound(value string, location *time.Location, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation(models.ExceptionDateFormat, value, location)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		return day.AddDate(0, 0, 1), nil
+	}
+	return day, nil
+}
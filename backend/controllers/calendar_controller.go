@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+	"github.com/adrianmcmains/telehealth-platform/services"
+)
+
+// calendarContentType is the media type of iCalendar responses
+const calendarContentType = "text/calendar; charset=utf-8"
+
+// CalendarController handles iCalendar downloads and feed subscriptions
+type CalendarController struct {
+	DB              *gorm.DB
+	CalendarService *services.CalendarService
+}
+
+// NewCalendarController creates a new instance of CalendarController
+func NewCalendarController() *CalendarController {
+	return &CalendarController{
+		DB:              config.DB,
+		CalendarService: services.NewCalendarService(),
+	}
+}
+
+// GetFeed serves a user's calendar feed. The token in the URL is the only
+// credential, so calendar apps can subscribe without logging in.
+func (cc *CalendarController) GetFeed(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	calendar, err := cc.CalendarService.Feed(token)
+	if errors.Is(err, services.ErrFeedNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Calendar feed not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build calendar feed"})
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Data(http.StatusOK, calendarContentType, []byte(calendar.String()))
+}
+
+// DownloadAppointment returns a single appointment as an .ics file
+func (cc *CalendarController) DownloadAppointment(c *gin.Context) {
+	// Scope queries to the current organization
+	db := cc.DB.WithContext(c.Request.Context())
+
+	appointmentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return
+	}
+
+	// Get authenticated user ID and role from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userRole, _ := c.Get("userRole")
+
+	var appointment models.Appointment
+	if err := db.Preload("Patient").Preload("Doctor").First(&appointment, appointmentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return
+	}
+
+	// Participants see the appointment from their side; admins see the patient's
+	viewer := &appointment.Patient
+	switch {
+	case appointment.DoctorID == userID.(uint):
+		viewer = &appointment.Doctor
+	case appointment.PatientID == userID.(uint), userRole == string(models.RoleAdmin):
+	default:
+		// Invited participants can download it while their access lasts
+		if _, ok := services.ActiveParticipant(db, &appointment, userID.(uint)); !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to view this appointment"})
+			return
+		}
+		viewer = &models.User{ID: userID.(uint)}
+	}
+
+	calendar := cc.CalendarService.AppointmentCalendar(&appointment, viewer)
+	c.Header("Content-Disposition", `attachment; filename="appointment-`+strconv.FormatUint(appointmentID, 10)+`.ics"`)
+	c.Data(http.StatusOK, calendarContentType, []byte(calendar.String()))
+}
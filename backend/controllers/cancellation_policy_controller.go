@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+	"github.com/adrianmcmains/telehealth-platform/services"
+)
+
+// CancellationPolicyRequest represents the set cancellation policy request body
+type CancellationPolicyRequest struct {
+	FullRefundHours      *int `json:"fullRefundHours" binding:"required,min=0,max=720"`
+	PartialRefundPercent *int `json:"partialRefundPercent" binding:"required,min=0,max=100"`
+}
+
+// CancellationPolicyController handles doctors' cancellation policy requests
+type CancellationPolicyController struct {
+	DB *gorm.DB
+}
+
+// NewCancellationPolicyController creates a new instance of CancellationPolicyController
+func NewCancellationPolicyController() *CancellationPolicyController {
+	return &CancellationPolicyController{
+		DB: config.DB,
+	}
+}
+
+// GetDoctorPolicy returns the cancellation policy that applies to a doctor's appointments
+func (cc *CancellationPolicyController) GetDoctorPolicy(c *gin.Context) {
+	// Scope queries to the current organization
+	db := cc.DB.WithContext(c.Request.Context())
+
+	doctorID, ok := loadDoctor(c, db)
+	if !ok {
+		return
+	}
+
+	organizationID, _ := c.Get("organizationID")
+	policy, err := services.EffectiveCancellationPolicy(db, organizationID.(uint), doctorID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve cancellation policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, cancellationPolicyResponse(&policy))
+}
+
+// UpdateDoctorPolicy sets a doctor's own cancellation policy
+func (cc *CancellationPolicyController) UpdateDoctorPolicy(c *gin.Context) {
+	// Scope queries to the current organization
+	db := cc.DB.WithContext(c.Request.Context())
+
+	doctorID, ok := loadDoctor(c, db)
+	if !ok || !authorizeDoctorOrAdmin(c, doctorID) {
+		return
+	}
+
+	// Bind and validate request body
+	var request CancellationPolicyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	organizationID, _ := c.Get("organizationID")
+	policy, err := saveCancellationPolicy(db, organizationID.(uint), doctorID, request)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cancellation policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, cancellationPolicyResponse(policy))
+}
+
+// DeleteDoctorPolicy removes a doctor's own policy so the clinic's applies again
+func (cc *CancellationPolicyController) DeleteDoctorPolicy(c *gin.Context) {
+	// Scope queries to the current organization
+	db := cc.DB.WithContext(c.Request.Context())
+
+	doctorID, ok := loadDoctor(c, db)
+	if !ok || !authorizeDoctorOrAdmin(c, doctorID) {
+		return
+	}
+
+	if err := db.Where("doctor_id = ?", doctorID).Delete(&models.CancellationPolicy{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete cancellation policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Cancellation policy removed"})
+}
+
+// saveCancellationPolicy creates or replaces the policy for an organization,
+// or for one of its doctors when doctorID is set
+func saveCancellationPolicy(db *gorm.DB, organizationID, doctorID uint, request CancellationPolicyRequest) (*models.CancellationPolicy, error) {
+	policy := models.CancellationPolicy{
+		OrganizationID:       organizationID,
+		DoctorID:             doctorID,
+		FullRefundHours:      *request.FullRefundHours,
+		PartialRefundPercent: *request.PartialRefundPercent,
+	}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "organization_id"}, {Name: "doctor_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"full_refund_hours", "partial_refund_percent", "updated_at"}),
+	}).Create(&policy).Error
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// cancellationPolicyResponse formats a policy along with where it comes from
+func cancellationPolicyResponse(policy *models.CancellationPolicy) gin.H {
+	return gin.H{
+		"source": policy.Source(),
+		"policy": gin.H{
+			"fullRefundHours":      policy.FullRefundHours,
+			"partialRefundPercent": policy.PartialRefundPercent,
+			"noShowRefundPercent":  0,
+		},
+	}
+}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+	"github.com/adrianmcmains/telehealth-platform/services"
+)
+
+// ExportController handles personal data export requests
+type ExportController struct {
+	DB            *gorm.DB
+	ExportService *services.ExportService
+}
+
+// NewExportController creates a new instance of ExportController
+func NewExportController() *ExportController {
+	return &ExportController{
+		DB:            config.DB,
+		ExportService: services.NewExportService(),
+	}
+}
+
+// RequestExport starts a new data export for the authenticated user
+func (ec *ExportController) RequestExport(c *gin.Context) {
+	// Get authenticated user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Queue the export job
+	export, err := ec.ExportService.RequestExport(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request data export"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"export": exportResponse(export, ""),
+	})
+}
+
+// ListExports lists the authenticated user's data exports
+func (ec *ExportController) ListExports(c *gin.Context) {
+	// Get authenticated user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var exports []models.DataExport
+	if err := ec.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&exports).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data exports"})
+		return
+	}
+
+	response := make([]gin.H, len(exports))
+	for i := range exports {
+		response[i] = exportResponse(&exports[i], ec.downloadURL(&exports[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"exports": response,
+	})
+}
+
+// GetExport returns the status of one of the authenticated user's exports
+func (ec *ExportController) GetExport(c *gin.Context) {
+	// Get export ID from URL parameter
+	id := c.Param("id")
+	exportID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export ID"})
+		return
+	}
+
+	// Get authenticated user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var export models.DataExport
+	if err := ec.DB.Where("id = ? AND user_id = ?", exportID, userID).First(&export).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"export": exportResponse(&export, ec.downloadURL(&export)),
+	})
+}
+
+// DownloadExport serves a ready export archive to the holder of its download token
+func (ec *ExportController) DownloadExport(c *gin.Context) {
+	// Get export ID from URL parameter
+	id := c.Param("id")
+	exportID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export ID"})
+		return
+	}
+
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Download token is required"})
+		return
+	}
+
+	var export models.DataExport
+	if err := ec.DB.First(&export, exportID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	}
+
+	// Check the token and that the link is still valid
+	if export.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(export.Token)) != 1 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid download token"})
+		return
+	}
+	if export.Status != models.ExportStatusReady || export.IsExpired() {
+		c.JSON(http.StatusGone, gin.H{"error": "This download link has expired"})
+		return
+	}
+
+	c.FileAttachment(export.FilePath, fmt.Sprintf("telehealth-data-export-%d.zip", export.ID))
+}
+
+// downloadURL returns the download link for an export that is ready
+func (ec *ExportController) downloadURL(export *models.DataExport) string {
+	if export.Status != models.ExportStatusReady || export.IsExpired() {
+		return ""
+	}
+	return ec.ExportService.DownloadURL(export)
+}
+
+// exportResponse formats an export for API responses
+func exportResponse(export *models.DataExport, downloadURL string) gin.H {
+	response := gin.H{
+		"id":          export.ID,
+		"status":      export.Status,
+		"createdAt":   export.CreatedAt,
+		"completedAt": export.CompletedAt,
+		"expiresAt":   export.ExpiresAt,
+	}
+	if downloadURL != "" {
+		response["downloadUrl"] = downloadURL
+	}
+	return response
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// e164Pattern matches phone numbers in E.164 format, e.g. +256773388441
+var e164Pattern = regexp.MustCompile(`^\+[1-9]\d{1,14}$`)
+
+// errPatchUnknownField is returned when a patch names fields the resource does not have
+var errPatchUnknownField = errors.New("unknown fields in patch")
+
+// errPatchForbidden is returned when a patch touches fields the caller may not change
+var errPatchForbidden = errors.New("not allowed to change one or more fields")
+
+// MergePatch is a decoded JSON Merge Patch (RFC 7396) document. A key mapped to
+// null clears the field; a missing key leaves it unchanged.
+type MergePatch map[string]json.RawMessage
+
+// patchRule describes who may change a field and how to apply a new value to it
+type patchRule struct {
+	// Roles that may change the field; read-only fields have none
+	Roles []models.UserRole
+
+	// Nullable fields may be cleared with null
+	Nullable bool
+
+	// Apply sets the field; raw is nil when the field is being cleared
+	Apply func(raw json.RawMessage) error
+}
+
+// PatchErrors maps patch fields to validation messages
+type PatchErrors map[string]string
+
+// bindMergePatch reads a JSON Merge Patch document from the request body
+func bindMergePatch(c *gin.Context) (MergePatch, error) {
+	var patch MergePatch
+	if err := json.NewDecoder(c.Request.Body).Decode(&patch); err != nil || patch == nil {
+		return nil, fmt.Errorf("request body must be a JSON object")
+	}
+
+	return patch, nil
+}
+
+// applyMergePatch applies a patch using per-field rules for the caller's role. It
+// returns errPatchUnknownField if any field has no rule, errPatchForbidden if
+// any field is off limits, otherwise per-field validation errors.
+func applyMergePatch(patch MergePatch, rules map[string]patchRule, role string) (PatchErrors, error) {
+	fieldErrors := PatchErrors{}
+
+	// Check every field is known and permitted before changing anything
+	for field := range patch {
+		if _, ok := rules[field]; !ok {
+			fieldErrors[field] = "unknown field"
+		}
+	}
+	if len(fieldErrors) > 0 {
+		return fieldErrors, errPatchUnknownField
+	}
+	for field := range patch {
+		if !roleAllowed(rules[field].Roles, role) {
+			fieldErrors[field] = "you are not allowed to change this field"
+		}
+	}
+	if len(fieldErrors) > 0 {
+		return fieldErrors, errPatchForbidden
+	}
+
+	for field, raw := range patch {
+		rule := rules[field]
+
+		if isJSONNull(raw) {
+			if !rule.Nullable {
+				fieldErrors[field] = "cannot be cleared"
+				continue
+			}
+			raw = nil
+		}
+
+		if err := rule.Apply(raw); err != nil {
+			fieldErrors[field] = err.Error()
+		}
+	}
+
+	return fieldErrors, nil
+}
+
+// withReadOnly adds rules for fields the resource has but nobody may patch
+func withReadOnly(rules map[string]patchRule, fields ...string) map[string]patchRule {
+	for _, field := range fields {
+		rules[field] = patchRule{}
+	}
+	return rules
+}
+
+// roleAllowed reports whether a role is in the allowed list
+func roleAllowed(allowed []models.UserRole, role string) bool {
+	for _, r := range allowed {
+		if string(r) == role {
+			return true
+		}
+	}
+	return false
+}
+
+// isJSONNull reports whether a raw JSON value is null
+func isJSONNull(raw json.RawMessage) bool {
+	return strings.TrimSpace(string(raw)) == "null"
+}
+
+// patchString decodes a string patch value, trimming whitespace and enforcing a maximum length
+func patchString(raw json.RawMessage, maxLen int) (string, error) {
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", fmt.Errorf("must be a string")
+	}
+
+	value = strings.TrimSpace(value)
+	if maxLen > 0 && len(value) > maxLen {
+		return "", fmt.Errorf("must be at most %d characters", maxLen)
+	}
+
+	return value, nil
+}
+
+// patchRequiredString decodes a string patch value that may not be empty
+func patchRequiredString(raw json.RawMessage, maxLen int) (string, error) {
+	value, err := patchString(raw, maxLen)
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		return "", fmt.Errorf("cannot be empty")
+	}
+	return value, nil
+}
+
+// validatePhoneNumber checks a phone number is in E.164 format
+func validatePhoneNumber(phone string) error {
+	if !e164Pattern.MatchString(phone) {
+		return fmt.Errorf("must be an E.164 phone number such as +256773388441")
+	}
+	return nil
+}
+
+// parseBirthDate parses a YYYY-MM-DD or RFC 3339 birth date and checks it is in the past
+func parseBirthDate(value string) (time.Time, error) {
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		date, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("must be a date in YYYY-MM-DD format")
+		}
+	}
+
+	if !date.Before(time.Now()) {
+		return time.Time{}, fmt.Errorf("must be in the past")
+	}
+	if date.Before(time.Now().AddDate(-150, 0, 0)) {
+		return time.Time{}, fmt.Errorf("is not a plausible birth date")
+	}
+
+	return date, nil
+}
@@ -0,0 +1,430 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+	"github.com/adrianmcmains/telehealth-platform/services"
+)
+
+// CreateOrganizationRequest represents the create organization request body
+type CreateOrganizationRequest struct {
+	Name         string `json:"name" binding:"required"`
+	Slug         string `json:"slug" binding:"required,max=64"`
+	LogoURL      string `json:"logoUrl"`
+	PrimaryColor string `json:"primaryColor"`
+	SupportEmail string `json:"supportEmail"`
+	Currency     string `json:"currency"`
+}
+
+// UpdateOrganizationRequest represents the update organization request body
+type UpdateOrganizationRequest struct {
+	Name           string  `json:"name"`
+	LogoURL        *string `json:"logoUrl"`
+	PrimaryColor   string  `json:"primaryColor"`
+	SupportEmail   *string `json:"supportEmail"`
+	PaymentEnabled *bool   `json:"paymentEnabled"`
+	Currency       string  `json:"currency"`
+	EversendAPIKey *string `json:"eversendApiKey"`
+}
+
+// AddMemberRequest represents the add organization member request body
+type AddMemberRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required"`
+}
+
+// OrganizationController handles organization and membership requests
+type OrganizationController struct {
+	DB *gorm.DB
+}
+
+// NewOrganizationController creates a new instance of OrganizationController
+func NewOrganizationController() *OrganizationController {
+	return &OrganizationController{
+		DB: config.DB,
+	}
+}
+
+// ListMyOrganizations lists the organizations the authenticated user belongs to
+func (oc *OrganizationController) ListMyOrganizations(c *gin.Context) {
+	// Get authenticated user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var memberships []models.OrganizationMembership
+	if err := oc.DB.Preload("Organization").Where("user_id = ?", userID).Find(&memberships).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve organizations"})
+		return
+	}
+
+	response := make([]gin.H, len(memberships))
+	for i, membership := range memberships {
+		response[i] = gin.H{
+			"organization": brandingResponse(&membership.Organization),
+			"role":         membership.Role,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"organizations": response,
+	})
+}
+
+// CreateOrganization creates a new organization and makes the creator its admin
+func (oc *OrganizationController) CreateOrganization(c *gin.Context) {
+	// Get authenticated user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Bind and validate request body
+	var request CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	organization := models.Organization{
+		Name:         request.Name,
+		Slug:         strings.ToLower(request.Slug),
+		LogoURL:      request.LogoURL,
+		PrimaryColor: request.PrimaryColor,
+		SupportEmail: request.SupportEmail,
+		Currency:     strings.ToUpper(request.Currency),
+	}
+	if organization.Currency == "" {
+		organization.Currency = "USD"
+	}
+
+	err := oc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&organization).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.OrganizationMembership{
+			OrganizationID: organization.ID,
+			UserID:         userID.(uint),
+			Role:           models.RoleAdmin,
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Failed to create organization; the slug may already be in use"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"organization": settingsResponse(&organization),
+	})
+}
+
+// GetBranding returns an organization's public branding by slug
+func (oc *OrganizationController) GetBranding(c *gin.Context) {
+	var organization models.Organization
+	if err := oc.DB.Where("slug = ?", strings.ToLower(c.Param("slug"))).First(&organization).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"organization": brandingResponse(&organization),
+	})
+}
+
+// GetOrganization returns an organization; admins also see its payment settings
+func (oc *OrganizationController) GetOrganization(c *gin.Context) {
+	organization, role, ok := oc.loadOrganization(c)
+	if !ok {
+		return
+	}
+
+	response := brandingResponse(organization)
+	if role == models.RoleAdmin {
+		response = settingsResponse(organization)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"organization": response,
+	})
+}
+
+// UpdateOrganization updates an organization's branding and payment settings
+func (oc *OrganizationController) UpdateOrganization(c *gin.Context) {
+	organization, role, ok := oc.loadOrganization(c)
+	if !ok {
+		return
+	}
+	if role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only organization admins can change settings"})
+		return
+	}
+
+	// Bind and validate request body
+	var request UpdateOrganizationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Update organization fields if provided
+	if request.Name != "" {
+		organization.Name = request.Name
+	}
+	if request.LogoURL != nil {
+		organization.LogoURL = *request.LogoURL
+	}
+	if request.PrimaryColor != "" {
+		organization.PrimaryColor = request.PrimaryColor
+	}
+	if request.SupportEmail != nil {
+		organization.SupportEmail = *request.SupportEmail
+	}
+	if request.PaymentEnabled != nil {
+		organization.PaymentEnabled = *request.PaymentEnabled
+	}
+	if request.Currency != "" {
+		organization.Currency = strings.ToUpper(request.Currency)
+	}
+	if request.EversendAPIKey != nil {
+		organization.EversendAPIKey = *request.EversendAPIKey
+	}
+
+	if err := oc.DB.Save(organization).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update organization"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"organization": settingsResponse(organization),
+	})
+}
+
+// ListMembers lists an organization's members
+func (oc *OrganizationController) ListMembers(c *gin.Context) {
+	organization, role, ok := oc.loadOrganization(c)
+	if !ok {
+		return
+	}
+	if role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only organization admins can view members"})
+		return
+	}
+
+	var memberships []models.OrganizationMembership
+	if err := oc.DB.Preload("User").Where("organization_id = ?", organization.ID).Find(&memberships).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve members"})
+		return
+	}
+
+	response := make([]gin.H, len(memberships))
+	for i, membership := range memberships {
+		response[i] = gin.H{
+			"userId":    membership.UserID,
+			"email":     membership.User.Email,
+			"firstName": membership.User.FirstName,
+			"lastName":  membership.User.LastName,
+			"role":      membership.Role,
+			"joinedAt":  membership.CreatedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"members": response,
+	})
+}
+
+// AddMember adds an existing user to an organization, or changes their role
+func (oc *OrganizationController) AddMember(c *gin.Context) {
+	organization, role, ok := oc.loadOrganization(c)
+	if !ok {
+		return
+	}
+	if role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only organization admins can add members"})
+		return
+	}
+
+	// Bind and validate request body
+	var request AddMemberRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	memberRole := models.UserRole(request.Role)
+	switch memberRole {
+	case models.RolePatient, models.RoleDoctor, models.RoleAdmin:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+
+	var user models.User
+	if err := oc.DB.Where("email = ?", request.Email).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	membership := models.OrganizationMembership{
+		OrganizationID: organization.ID,
+		UserID:         user.ID,
+	}
+	if err := oc.DB.Where(&membership).Assign(models.OrganizationMembership{Role: memberRole}).
+		FirstOrCreate(&membership).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"member": gin.H{
+			"userId": membership.UserID,
+			"email":  user.Email,
+			"role":   membership.Role,
+		},
+	})
+}
+
+// RemoveMember removes a user from an organization
+func (oc *OrganizationController) RemoveMember(c *gin.Context) {
+	organization, role, ok := oc.loadOrganization(c)
+	if !ok {
+		return
+	}
+	if role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only organization admins can remove members"})
+		return
+	}
+
+	memberID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	result := oc.DB.Where("organization_id = ? AND user_id = ?", organization.ID, memberID).
+		Delete(&models.OrganizationMembership{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed"})
+}
+
+// GetCancellationPolicy returns the organization's cancellation policy
+func (oc *OrganizationController) GetCancellationPolicy(c *gin.Context) {
+	organization, _, ok := oc.loadOrganization(c)
+	if !ok {
+		return
+	}
+
+	policy, err := services.EffectiveCancellationPolicy(oc.DB, organization.ID, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve cancellation policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, cancellationPolicyResponse(&policy))
+}
+
+// UpdateCancellationPolicy sets the policy for doctors without their own
+func (oc *OrganizationController) UpdateCancellationPolicy(c *gin.Context) {
+	organization, role, ok := oc.loadOrganization(c)
+	if !ok {
+		return
+	}
+	if role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only organization admins can change settings"})
+		return
+	}
+
+	// Bind and validate request body
+	var request CancellationPolicyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy, err := saveCancellationPolicy(oc.DB, organization.ID, 0, request)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cancellation policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, cancellationPolicyResponse(policy))
+}
+
+// loadOrganization loads the organization in the URL and the caller's role in it.
+// Platform admins are treated as admins of every organization.
+func (oc *OrganizationController) loadOrganization(c *gin.Context) (*models.Organization, models.UserRole, bool) {
+	// Get organization ID from URL parameter
+	organizationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		return nil, "", false
+	}
+
+	// Get authenticated user ID and role from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, "", false
+	}
+	userRole, _ := c.Get("userRole")
+
+	var organization models.Organization
+	if err := oc.DB.First(&organization, organizationID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return nil, "", false
+	}
+
+	if userRole == string(models.RoleAdmin) {
+		return &organization, models.RoleAdmin, true
+	}
+
+	var membership models.OrganizationMembership
+	if err := oc.DB.Where("organization_id = ? AND user_id = ?", organization.ID, userID).
+		First(&membership).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this organization"})
+		return nil, "", false
+	}
+
+	return &organization, membership.Role, true
+}
+
+// brandingResponse formats the public view of an organization
+func brandingResponse(organization *models.Organization) gin.H {
+	return gin.H{
+		"id":           organization.ID,
+		"name":         organization.Name,
+		"slug":         organization.Slug,
+		"logoUrl":      organization.LogoURL,
+		"primaryColor": organization.PrimaryColor,
+		"supportEmail": organization.SupportEmail,
+	}
+}
+
+// settingsResponse formats the admin view of an organization, including payment settings
+func settingsResponse(organization *models.Organization) gin.H {
+	response := brandingResponse(organization)
+	response["paymentEnabled"] = organization.PaymentEnabled
+	response["currency"] = organization.Currency
+	response["hasEversendApiKey"] = organization.EversendAPIKey != ""
+	response["createdAt"] = organization.CreatedAt
+	response["updatedAt"] = organization.UpdatedAt
+	return response
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultPageSize is used when a listing request sets no limit
+	defaultPageSize = 20
+
+	// maxPageSize caps the limit a listing request may ask for
+	maxPageSize = 100
+)
+
+// errInvalidCursor is returned for a cursor that was not issued for the current sort
+var errInvalidCursor = errors.New("invalid cursor")
+
+// pageCursor marks the last row of a page in a keyset-paginated listing.
+// The sort is part of the cursor so it cannot be replayed against another order.
+type pageCursor struct {
+	Sort  string
+	Value time.Time
+	ID    uint
+}
+
+// encode returns the cursor as an opaque URL-safe string
+func (pc pageCursor) encode() string {
+	raw := fmt.Sprintf("%s|%s|%d", pc.Sort, pc.Value.UTC().Format(time.RFC3339Nano), pc.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodePageCursor parses a cursor and checks it belongs to the given sort
+func decodePageCursor(value, sort string) (*pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 || parts[0] != sort {
+		return nil, errInvalidCursor
+	}
+	at, err := time.Parse(time.RFC3339Nano, parts[1])
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	id, err := strconv.ParseUint(parts[2], 10, 32)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	return &pageCursor{Sort: sort, Value: at, ID: uint(id)}, nil
+}
+
+// pageLimit reads the limit query parameter
+func pageLimit(c *gin.Context) (int, error) {
+	value := c.Query("limit")
+	if value == "" {
+		return defaultPageSize, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+	}
+	return limit, nil
+}
+
+// queryList reads a query parameter that may be repeated or comma-separated
+func queryList(c *gin.Context, key string) []string {
+	var values []string
+	for _, value := range c.QueryArray(key) {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPageCursorRoundTrip(t *testing.T) {
+	cursor := pageCursor{
+		Sort:  "start_time_desc",
+		Value: time.Date(2025, 3, 10, 9, 30, 0, 123456789, time.FixedZone("EAT", 3*60*60)),
+		ID:    42,
+	}
+
+	decoded, err := decodePageCursor(cursor.encode(), cursor.Sort)
+	if err != nil {
+		t.Fatalf("decodePageCursor() error = %v", err)
+	}
+	if decoded.Sort != cursor.Sort || decoded.ID != cursor.ID || !decoded.Value.Equal(cursor.Value) {
+		t.Errorf("decodePageCursor() = %+v, want %+v", *decoded, cursor)
+	}
+}
+
+func TestDecodePageCursorRejectsInvalidCursors(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+	valid := pageCursor{Sort: "start_time_asc", Value: time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC), ID: 7}.encode()
+
+	tests := []struct {
+		name  string
+		value string
+		sort  string
+	}{
+		{"not base64", "not a cursor!", "start_time_asc"},
+		{"other sort", valid, "start_time_desc"},
+		{"missing parts", encode("start_time_asc|2025-03-10T09:00:00Z"), "start_time_asc"},
+		{"extra parts", encode("start_time_asc|2025-03-10T09:00:00Z|7|8"), "start_time_asc"},
+		{"bad time", encode("start_time_asc|yesterday|7"), "start_time_asc"},
+		{"bad id", encode("start_time_asc|2025-03-10T09:00:00Z|seven"), "start_time_asc"},
+		{"negative id", encode("start_time_asc|2025-03-10T09:00:00Z|-7"), "start_time_asc"},
+		{"id out of range", encode("start_time_asc|2025-03-10T09:00:00Z|4294967296"), "start_time_asc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodePageCursor(tt.value, tt.sort); !errors.Is(err, errInvalidCursor) {
+				t.Errorf("decodePageCursor(%q) error = %v, want %v", tt.value, err, errInvalidCursor)
+			}
+		})
+	}
+}
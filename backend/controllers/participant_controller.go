@@ -0,0 +1,319 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+	"github.com/adrianmcmains/telehealth-platform/services"
+)
+
+// InviteParticipantRequest represents the invite participant request body
+type InviteParticipantRequest struct {
+	UserID uint   `json:"userId" binding:"required"`
+	Role   string `json:"role" binding:"required"`
+}
+
+// CreateGuestLinkRequest represents the create guest link request body
+type CreateGuestLinkRequest struct {
+	DisplayName string `json:"displayName" binding:"required,max=100"`
+	PIN         string `json:"pin" binding:"omitempty,numeric,min=4,max=8"`
+}
+
+// ParticipantController handles interpreters, caregivers and other clinicians
+// invited to appointments, and guest links for people without an account
+type ParticipantController struct {
+	DB                 *gorm.DB
+	ParticipantService *services.ParticipantService
+	GuestLinkService   *services.GuestLinkService
+}
+
+// NewParticipantController creates a new instance of ParticipantController
+func NewParticipantController() *ParticipantController {
+	return &ParticipantController{
+		DB:                 config.DB,
+		ParticipantService: services.NewParticipantService(),
+		GuestLinkService:   services.NewGuestLinkService(),
+	}
+}
+
+// ListParticipants returns everyone on an appointment. Invited participants
+// can see the list while their access lasts.
+func (pc *ParticipantController) ListParticipants(c *gin.Context) {
+	appointment, actor, ok := pc.loadAppointment(c)
+	if !ok {
+		return
+	}
+	if !isAppointmentParty(appointment, actor) {
+		if _, ok := services.ActiveParticipant(pc.DB.WithContext(c.Request.Context()), appointment, actor.ID); !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to view this appointment"})
+			return
+		}
+	}
+
+	participants, err := pc.ParticipantService.Participants(c.Request.Context(), appointment.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve participants"})
+		return
+	}
+
+	result := make([]gin.H, len(participants))
+	for i, participant := range participants {
+		result[i] = participantResponse(&participant)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"patientId":    appointment.PatientID,
+		"doctorId":     appointment.DoctorID,
+		"participants": result,
+	})
+}
+
+// InviteParticipant adds a member of the organization to an appointment and
+// sends them an invitation
+func (pc *ParticipantController) InviteParticipant(c *gin.Context) {
+	// Bind and validate request body
+	var request InviteParticipantRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	role := models.ParticipantRole(request.Role)
+	if !role.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be interpreter, caregiver or clinician"})
+		return
+	}
+
+	appointment, actor, ok := pc.loadAppointment(c)
+	if !ok {
+		return
+	}
+	if !isAppointmentParty(appointment, actor) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to invite participants to this appointment"})
+		return
+	}
+
+	participant, err := pc.ParticipantService.Invite(c.Request.Context(), appointment, request.UserID, role, actor)
+	switch {
+	case errors.Is(err, services.ErrParticipantEnded), errors.Is(err, services.ErrParticipantIsParty):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrParticipantNotMember):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrParticipantExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to invite participant"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"participant": participantResponse(participant)})
+}
+
+// RemoveParticipant takes a participant off an appointment. Participants can
+// also remove themselves.
+func (pc *ParticipantController) RemoveParticipant(c *gin.Context) {
+	participantID, err := strconv.ParseUint(c.Param("participantId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid participant ID"})
+		return
+	}
+
+	appointment, actor, ok := pc.loadAppointment(c)
+	if !ok {
+		return
+	}
+	if !isAppointmentParty(appointment, actor) {
+		participant, ok := services.ActiveParticipant(pc.DB.WithContext(c.Request.Context()), appointment, actor.ID)
+		if !ok || participant.ID != uint(participantID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to remove this participant"})
+			return
+		}
+	}
+
+	err = pc.ParticipantService.Remove(c.Request.Context(), appointment, uint(participantID), actor)
+	if errors.Is(err, services.ErrParticipantNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Participant not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove participant"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Participant removed"})
+}
+
+// ListGuestLinks returns an appointment's guest links
+func (pc *ParticipantController) ListGuestLinks(c *gin.Context) {
+	appointment, actor, ok := pc.loadAppointment(c)
+	if !ok {
+		return
+	}
+	if !isAppointmentParty(appointment, actor) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to view this appointment"})
+		return
+	}
+
+	links, err := pc.GuestLinkService.Links(c.Request.Context(), appointment.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve guest links"})
+		return
+	}
+
+	result := make([]gin.H, len(links))
+	for i, link := range links {
+		result[i] = guestLinkResponse(appointment, &link)
+	}
+	c.JSON(http.StatusOK, gin.H{"guestLinks": result})
+}
+
+// CreateGuestLink makes a link that lets someone without an account join the
+// appointment's video call
+func (pc *ParticipantController) CreateGuestLink(c *gin.Context) {
+	// Bind and validate request body
+	var request CreateGuestLinkRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	appointment, actor, ok := pc.loadAppointment(c)
+	if !ok {
+		return
+	}
+	if !isAppointmentParty(appointment, actor) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to invite guests to this appointment"})
+		return
+	}
+
+	link, err := pc.GuestLinkService.Create(c.Request.Context(), appointment, request.DisplayName, request.PIN, actor)
+	if errors.Is(err, services.ErrGuestLinkEnded) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create guest link"})
+		return
+	}
+
+	// The link is only shown once; share it with the guest
+	response := guestLinkResponse(appointment, link)
+	response["url"] = pc.GuestLinkService.URL(link)
+	c.JSON(http.StatusCreated, gin.H{"guestLink": response})
+}
+
+// RevokeGuestLink stops a guest link from working
+func (pc *ParticipantController) RevokeGuestLink(c *gin.Context) {
+	linkID, err := strconv.ParseUint(c.Param("linkId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid guest link ID"})
+		return
+	}
+
+	appointment, actor, ok := pc.loadAppointment(c)
+	if !ok {
+		return
+	}
+	if !isAppointmentParty(appointment, actor) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to revoke this guest link"})
+		return
+	}
+
+	link, err := pc.GuestLinkService.Revoke(c.Request.Context(), appointment, uint(linkID), actor)
+	if errors.Is(err, services.ErrGuestLinkNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Guest link not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke guest link"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"guestLink": guestLinkResponse(appointment, link)})
+}
+
+// GetGuestLink tells a guest when their call is and whether they need a PIN.
+// The token in the URL is the only credential.
+func (pc *ParticipantController) GetGuestLink(c *gin.Context) {
+	link, appointment, err := pc.GuestLinkService.Lookup(c.Param("token"))
+	if errors.Is(err, services.ErrGuestLinkNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Guest link not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load guest link"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"guestLink": gin.H{
+			"displayName": link.DisplayName,
+			"startTime":   appointment.StartTime,
+			"endTime":     appointment.EndTime,
+			"pinRequired": link.HasPIN(),
+			"open":        link.IsOpen(appointment, time.Now()),
+		},
+	})
+}
+
+// guestLinkResponse formats a guest link for the appointment's patient and doctor
+func guestLinkResponse(appointment *models.Appointment, link *models.GuestLink) gin.H {
+	return gin.H{
+		"id":          link.ID,
+		"displayName": link.DisplayName,
+		"pinRequired": link.HasPIN(),
+		"open":        link.IsOpen(appointment, time.Now()),
+		"createdById": link.CreatedByID,
+		"revokedAt":   link.RevokedAt,
+		"createdAt":   link.CreatedAt,
+	}
+}
+
+// loadAppointment finds the appointment in the URL and identifies the caller
+func (pc *ParticipantController) loadAppointment(c *gin.Context) (*models.Appointment, services.Actor, bool) {
+	// Scope queries to the current organization
+	db := pc.DB.WithContext(c.Request.Context())
+
+	appointmentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return nil, services.Actor{}, false
+	}
+
+	userID, _ := c.Get("userID")
+	userRole, _ := c.Get("userRole")
+
+	var appointment models.Appointment
+	if err := db.First(&appointment, appointmentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return nil, services.Actor{}, false
+	}
+	return &appointment, services.Actor{ID: userID.(uint), Role: models.UserRole(userRole.(string))}, true
+}
+
+// isAppointmentParty reports whether the actor is the appointment's patient or
+// doctor, or an admin
+func isAppointmentParty(appointment *models.Appointment, actor services.Actor) bool {
+	return actor.Role == models.RoleAdmin || appointment.PatientID == actor.ID || appointment.DoctorID == actor.ID
+}
+
+// participantResponse formats a participant with only the contact details the
+// other people on the call need
+func participantResponse(participant *models.AppointmentParticipant) gin.H {
+	return gin.H{
+		"id":        participant.ID,
+		"userId":    participant.UserID,
+		"role":      participant.Role,
+		"firstName": participant.User.FirstName,
+		"lastName":  participant.User.LastName,
+		"createdAt": participant.CreatedAt,
+	}
+}
@@ -1,9 +1,12 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"fmt"
+	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -17,6 +20,7 @@ import (
 type PaymentController struct {
 	DB             *gorm.DB
 	PaymentService *services.PaymentService
+	NotificationService *services.NotificationService
 }
 
 // CreatePaymentRequest represents the request to create a payment
@@ -39,11 +43,15 @@ func NewPaymentController() *PaymentController {
 	return &PaymentController{
 		DB:             config.DB,
 		PaymentService: services.NewPaymentService(),
+		NotificationService: services.NewNotificationService(config.DB),
 	}
 }
 
 // CreatePayment creates a new payment
 func (pc *PaymentController) CreatePayment(c *gin.Context) {
+	// Scope queries to the current organization
+	db := pc.DB.WithContext(c.Request.Context())
+	
 	// Get authenticated user ID from context
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -60,7 +68,7 @@ func (pc *PaymentController) CreatePayment(c *gin.Context) {
 	
 	// Find appointment by ID
 	var appointment models.Appointment
-	if err := pc.DB.Preload("Patient").Preload("Doctor").First(&appointment, request.AppointmentID).Error; err != nil {
+	if err := db.Preload("Patient").Preload("Doctor").First(&appointment, request.AppointmentID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
 		return
 	}
@@ -71,8 +79,24 @@ func (pc *PaymentController) CreatePayment(c *gin.Context) {
 		return
 	}
 	
-	// Create payment with Eversend
-	paymentResponse, err := pc.PaymentService.CreatePayment(&appointment, &request.PaymentDetails)
+	// A held slot can only be paid for until the hold expires
+	if appointment.HoldExpiresAt != nil && !appointment.HoldOpen(time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{"error": "The hold on this slot has expired; please book again"})
+		return
+	}
+	
+	// Appointments booked as a visit type are charged the type's price
+	if appointment.Price > 0 {
+		request.PaymentDetails.Amount = appointment.Price
+	}
+	
+	// Create payment with Eversend using the organization's payment settings
+	paymentService, err := pc.paymentServiceFor(appointment.OrganizationID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load organization payment settings"})
+		return
+	}
+	paymentResponse, err := paymentService.CreatePayment(&appointment, &request.PaymentDetails)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment: " + err.Error()})
 		return
@@ -88,7 +112,15 @@ func (pc *PaymentController) CreatePayment(c *gin.Context) {
 		PaymentMethod: request.PaymentDetails.PaymentMethod,
 	}
 	
-	if err := pc.DB.Create(&payment).Error; err != nil {
+	userRole, _ := c.Get("userRole")
+	actor := services.Actor{ID: userID.(uint), Role: models.UserRole(userRole.(string))}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&payment).Error; err != nil {
+			return err
+		}
+		return services.RecordPaymentEvent(tx, &appointment, &payment, actor, models.DiffPayment(nil, &payment), "")
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save payment record"})
 		return
 	}
@@ -116,53 +148,89 @@ func (pc *PaymentController) HandlePaymentCallback(c *gin.Context) {
 		return
 	}
 	
-	// Verify payment with Eversend
-	paymentResponse, err := pc.PaymentService.VerifyPayment(request.PaymentID)
+	// Find the payment by its Eversend ID, or by the appointment in the reference ID (format: "appointment-{id}")
+	var payment models.Payment
+	if err := pc.DB.Where("payment_id = ?", request.PaymentID).First(&payment).Error; err != nil {
+		var appointmentID uint64
+		if _, err := fmt.Sscanf(request.ReferenceID, "appointment-%d", &appointmentID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reference format: " + err.Error()})
+			return
+		}
+		if err := pc.DB.Where("appointment_id = ?", appointmentID).First(&payment).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+			return
+		}
+	}
+	
+	// Verify payment with Eversend using the organization's payment settings
+	paymentService, err := pc.paymentServiceFor(payment.OrganizationID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load organization payment settings"})
+		return
+	}
+	paymentResponse, err := paymentService.VerifyPayment(request.PaymentID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify payment: " + err.Error()})
 		return
 	}
 	
-	// Extract appointment ID from reference ID (format: "appointment-{id}")
-	var appointmentID uint64
-	referenceFormat := "appointment-%d"
-	_, err = fmt.Sscanf(paymentResponse.Reference, referenceFormat, &appointmentID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reference format: " + err.Error()})
+	// Make sure the verified payment belongs to this appointment
+	if paymentResponse.Reference != fmt.Sprintf("appointment-%d", payment.AppointmentID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment reference does not match appointment"})
 		return
 	}
 	
-	// Update payment status in database
-	var payment models.Payment
-	if err := pc.DB.Where("payment_id = ?", request.PaymentID).First(&payment).Error; err != nil {
-		// If payment not found by payment_id, try to find by appointment_id
-		if err := pc.DB.Where("appointment_id = ?", appointmentID).First(&payment).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
-			return
-		}
+	var appointment models.Appointment
+	if err := pc.DB.First(&appointment, payment.AppointmentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return
 	}
 	
-	// Update payment status
+	// Update payment status, and mark the appointment paid once the payment
+	// completes; a completed payment also confirms a held slot
+	previousPayment, previousAppointment := payment, appointment
 	payment.Status = string(paymentResponse.Status)
-	if err := pc.DB.Save(&payment).Error; err != nil {
+	completed := paymentResponse.Status == services.PaymentStatusCompleted
+	if completed {
+		appointment.IsPaid = true
+		if appointment.Price == 0 {
+			appointment.Price = paymentResponse.Amount
+		}
+	}
+	err = pc.DB.Transaction(func(tx *gorm.DB) error {
+		if completed && previousAppointment.HoldExpiresAt != nil {
+			if err := services.ConfirmHold(tx, &appointment); err != nil {
+				return err
+			}
+		}
+		if err := tx.Save(&payment).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&appointment).Updates(map[string]interface{}{
+			"is_paid": appointment.IsPaid,
+			"price":   appointment.Price,
+		}).Error; err != nil {
+			return err
+		}
+		changes := append(models.DiffPayment(&previousPayment, &payment), models.DiffAppointment(&previousAppointment, &appointment)...)
+		return services.RecordPaymentEvent(tx, &appointment, &payment, services.SystemActor, changes, "")
+	})
+	if errors.Is(err, services.ErrHoldReleased) {
+		// The slot may already be someone else's, so give the money back
+		pc.refundReleasedHold(c, paymentService, &previousAppointment, &previousPayment)
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payment status"})
 		return
 	}
 	
-	// If payment was completed, update appointment status
-	if paymentResponse.Status == services.PaymentStatusCompleted {
-		var appointment models.Appointment
-		if err := pc.DB.First(&appointment, payment.AppointmentID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
-			return
-		}
-		
-		// Update appointment payment status
-		appointment.IsPaid = true
-		appointment.Price = paymentResponse.Amount
-		if err := pc.DB.Save(&appointment).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update appointment payment status"})
-			return
+	// Confirm a held slot to the patient and doctor now that it is paid for
+	if previousAppointment.Status == models.StatusHeld && appointment.Status == models.StatusScheduled {
+		if err := pc.DB.Preload("Patient").Preload("Doctor").First(&appointment, appointment.ID).Error; err != nil {
+			log.Printf("Failed to load appointment %d for notification: %v", appointment.ID, err)
+		} else {
+			go pc.NotificationService.SendAppointmentNotification(&appointment, services.NotificationTypeAppointmentConfirmation)
 		}
 	}
 	
@@ -170,8 +238,37 @@ func (pc *PaymentController) HandlePaymentCallback(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "success"})
 }
 
+// refundReleasedHold refunds a payment that completed after its slot hold
+// was released
+func (pc *PaymentController) refundReleasedHold(c *gin.Context, paymentService *services.PaymentService, appointment *models.Appointment, payment *models.Payment) {
+	reason := services.ErrHoldReleased.Error()
+	if err := paymentService.RefundPayment(payment.PaymentID, reason); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refund payment: " + err.Error()})
+		return
+	}
+	
+	previousPayment := *payment
+	payment.Status = string(services.PaymentStatusRefunded)
+	payment.RefundedAmount = payment.Amount
+	err := pc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(payment).Error; err != nil {
+			return err
+		}
+		return services.RecordPaymentEvent(tx, appointment, payment, services.SystemActor, models.DiffPayment(&previousPayment, payment), reason)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payment status"})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{"status": "refunded"})
+}
+
 // GetPayment gets payment information
 func (pc *PaymentController) GetPayment(c *gin.Context) {
+	// Scope queries to the current organization
+	db := pc.DB.WithContext(c.Request.Context())
+	
 	// Get payment ID from URL parameter
 	id := c.Param("id")
 	paymentID, err := strconv.ParseUint(id, 10, 32)
@@ -190,7 +287,7 @@ func (pc *PaymentController) GetPayment(c *gin.Context) {
 	
 	// Find payment by ID
 	var payment models.Payment
-	if err := pc.DB.Preload("Appointment").First(&payment, paymentID).Error; err != nil {
+	if err := db.Preload("Appointment").First(&payment, paymentID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
 		return
 	}
@@ -220,6 +317,9 @@ func (pc *PaymentController) GetPayment(c *gin.Context) {
 
 // GetPaymentByAppointment gets payment information for an appointment
 func (pc *PaymentController) GetPaymentByAppointment(c *gin.Context) {
+	// Scope queries to the current organization
+	db := pc.DB.WithContext(c.Request.Context())
+	
 	// Get appointment ID from URL parameter
 	id := c.Param("id")
 	appointmentID, err := strconv.ParseUint(id, 10, 32)
@@ -238,7 +338,7 @@ func (pc *PaymentController) GetPaymentByAppointment(c *gin.Context) {
 	
 	// Find appointment to check authorization
 	var appointment models.Appointment
-	if err := pc.DB.First(&appointment, appointmentID).Error; err != nil {
+	if err := db.First(&appointment, appointmentID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
 		return
 	}
@@ -253,7 +353,7 @@ func (pc *PaymentController) GetPaymentByAppointment(c *gin.Context) {
 	
 	// Find payment for this appointment
 	var payment models.Payment
-	if err := pc.DB.Where("appointment_id = ?", appointmentID).First(&payment).Error; err != nil {
+	if err := db.Where("appointment_id = ?", appointmentID).First(&payment).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "No payment found for this appointment"})
 		return
 	}
@@ -275,6 +375,9 @@ func (pc *PaymentController) GetPaymentByAppointment(c *gin.Context) {
 
 // RefundPayment refunds a payment
 func (pc *PaymentController) RefundPayment(c *gin.Context) {
+	// Scope queries to the current organization
+	db := pc.DB.WithContext(c.Request.Context())
+	
 	// Get payment ID from URL parameter
 	id := c.Param("id")
 	paymentID, err := strconv.ParseUint(id, 10, 32)
@@ -298,7 +401,7 @@ func (pc *PaymentController) RefundPayment(c *gin.Context) {
 	
 	// Find payment by ID
 	var payment models.Payment
-	if err := pc.DB.First(&payment, paymentID).Error; err != nil {
+	if err := db.First(&payment, paymentID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
 		return
 	}
@@ -309,31 +412,44 @@ func (pc *PaymentController) RefundPayment(c *gin.Context) {
 		return
 	}
 	
-	// Refund payment
-	err = pc.PaymentService.RefundPayment(payment.PaymentID, "Refunded by provider")
+	// Refund payment using the organization's payment settings
+	paymentService, err := pc.paymentServiceFor(payment.OrganizationID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refund payment: " + err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load organization payment settings"})
 		return
 	}
-	
-	// Update payment status
-	payment.Status = string(services.PaymentStatusRefunded)
-	if err := pc.DB.Save(&payment).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payment status"})
+	err = paymentService.RefundPayment(payment.PaymentID, "Refunded by provider")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refund payment: " + err.Error()})
 		return
 	}
 	
-	// Find appointment and update payment status
+	// Find appointment
 	var appointment models.Appointment
-	if err := pc.DB.First(&appointment, payment.AppointmentID).Error; err != nil {
+	if err := db.First(&appointment, payment.AppointmentID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
 		return
 	}
 	
-	// Update appointment payment status
+	// Update payment and appointment payment status, recording who refunded it
+	previousPayment, previousAppointment := payment, appointment
+	payment.Status = string(services.PaymentStatusRefunded)
+	payment.RefundedAmount = payment.Amount
 	appointment.IsPaid = false
-	if err := pc.DB.Save(&appointment).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update appointment payment status"})
+	userID, _ := c.Get("userID")
+	actor := services.Actor{ID: userID.(uint), Role: models.UserRole(userRole.(string))}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&payment).Error; err != nil {
+			return err
+		}
+		if err := tx.Save(&appointment).Error; err != nil {
+			return err
+		}
+		changes := append(models.DiffPayment(&previousPayment, &payment), models.DiffAppointment(&previousAppointment, &appointment)...)
+		return services.RecordPaymentEvent(tx, &appointment, &payment, actor, changes, "Refunded by provider")
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payment status"})
 		return
 	}
 	
@@ -345,4 +461,13 @@ func (pc *PaymentController) RefundPayment(c *gin.Context) {
 			"refundedAt":  payment.UpdatedAt,
 		},
 	})
-}
\ No newline at end of file
+}
+
+// paymentServiceFor returns the payment service configured for an organization
+func (pc *PaymentController) paymentServiceFor(organizationID uint) (*services.PaymentService, error) {
+	var organization models.Organization
+	if err := pc.DB.First(&organization, organizationID).Error; err != nil {
+		return nil, err
+	}
+	return pc.PaymentService.ForOrganization(&organization), nil
+}
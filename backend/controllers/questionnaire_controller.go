@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+	"github.com/adrianmcmains/telehealth-platform/services"
+	"github.com/adrianmcmains/telehealth-platform/tenancy"
+)
+
+// QuestionnaireRequest represents the create or update questionnaire request body
+type QuestionnaireRequest struct {
+	Name      string            `json:"name" binding:"required,max=200"`
+	DoctorID  uint              `json:"doctorId"`
+	Questions []models.Question `json:"questions" binding:"required"`
+}
+
+// SubmitIntakeRequest represents the submit intake answers request body
+type SubmitIntakeRequest struct {
+	Answers map[string]interface{} `json:"answers" binding:"required"`
+}
+
+// QuestionnaireController handles intake questionnaires and patients' answers
+type QuestionnaireController struct {
+	DB            *gorm.DB
+	IntakeService *services.IntakeService
+}
+
+// NewQuestionnaireController creates a new instance of QuestionnaireController
+func NewQuestionnaireController() *QuestionnaireController {
+	return &QuestionnaireController{
+		DB:            config.DB,
+		IntakeService: services.NewIntakeService(),
+	}
+}
+
+// ListQuestionnaires returns the organization's questionnaires; doctors see
+// their own and the shared ones
+func (qc *QuestionnaireController) ListQuestionnaires(c *gin.Context) {
+	// Scope queries to the current organization
+	db := qc.DB.WithContext(c.Request.Context())
+
+	userID, _ := c.Get("userID")
+	userRole, _ := c.Get("userRole")
+	query := db.Order("name ASC")
+	if userRole == string(models.RoleDoctor) {
+		query = query.Where("doctor_id IN ?", []uint{0, userID.(uint)})
+	}
+
+	var questionnaires []models.Questionnaire
+	if err := query.Find(&questionnaires).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve questionnaires"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"questionnaires": questionnaires,
+	})
+}
+
+// CreateQuestionnaire defines a new questionnaire. Doctors create their own;
+// admins may create one for a doctor or, without doctorId, for the organization.
+func (qc *QuestionnaireController) CreateQuestionnaire(c *gin.Context) {
+	// Scope queries to the current organization
+	db := qc.DB.WithContext(c.Request.Context())
+
+	// Bind and validate request body
+	var request QuestionnaireRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	userRole, _ := c.Get("userRole")
+	doctorID := request.DoctorID
+	if userRole == string(models.RoleDoctor) {
+		doctorID = userID.(uint)
+	} else if doctorID != 0 {
+		organizationID, _ := c.Get("organizationID")
+		var doctor models.User
+		if err := db.Scopes(tenancy.MembersWithRole(organizationID.(uint), string(models.RoleDoctor))).
+			First(&doctor, doctorID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Doctor not found"})
+			return
+		}
+	}
+
+	questionnaire := models.Questionnaire{DoctorID: doctorID, Name: request.Name}
+	version, problems, err := qc.IntakeService.CreateQuestionnaire(c.Request.Context(), &questionnaire, request.Questions, userID.(uint))
+	if errors.Is(err, services.ErrInvalidQuestions) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "fields": problems})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create questionnaire"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, questionnaireResponse(&questionnaire, version))
+}
+
+// GetQuestionnaire returns a questionnaire's current questions, or those of
+// an earlier version with ?version=
+func (qc *QuestionnaireController) GetQuestionnaire(c *gin.Context) {
+	questionnaire, ok := qc.loadQuestionnaire(c, false)
+	if !ok {
+		return
+	}
+
+	number := questionnaire.CurrentVersion
+	if value := c.Query("version"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+			return
+		}
+		number = parsed
+	}
+
+	version, err := qc.IntakeService.Version(c.Request.Context(), questionnaire.ID, number)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Questionnaire version not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, questionnaireResponse(questionnaire, version))
+}
+
+// UpdateQuestionnaire saves new questions as the next version
+func (qc *QuestionnaireController) UpdateQuestionnaire(c *gin.Context) {
+	questionnaire, ok := qc.loadQuestionnaire(c, true)
+	if !ok {
+		return
+	}
+
+	// Bind and validate request body
+	var request QuestionnaireRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	version, problems, err := qc.IntakeService.UpdateQuestionnaire(c.Request.Context(), questionnaire, request.Name, request.Questions, userID.(uint))
+	if errors.Is(err, services.ErrInvalidQuestions) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "fields": problems})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update questionnaire"})
+		return
+	}
+
+	c.JSON(http.StatusOK, questionnaireResponse(questionnaire, version))
+}
+
+// GetIntake returns the questions for an appointment and any answers given
+func (qc *QuestionnaireController) GetIntake(c *gin.Context) {
+	appointment, ok := qc.loadIntakeAppointment(c)
+	if !ok {
+		return
+	}
+
+	version, err := qc.IntakeService.AppointmentQuestionnaire(c.Request.Context(), appointment)
+	if errors.Is(err, services.ErrNoQuestionnaire) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve questionnaire"})
+		return
+	}
+
+	response, err := qc.IntakeService.Response(c.Request.Context(), appointment.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve intake answers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"questionnaire": version,
+		"response":      response,
+	})
+}
+
+// SubmitIntake stores the patient's answers for an appointment
+func (qc *QuestionnaireController) SubmitIntake(c *gin.Context) {
+	appointment, ok := qc.loadIntakeAppointment(c)
+	if !ok {
+		return
+	}
+
+	// Only the patient answers the questionnaire
+	userID, _ := c.Get("userID")
+	if appointment.PatientID != userID.(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the patient can answer the intake questionnaire"})
+		return
+	}
+
+	// Bind and validate request body
+	var request SubmitIntakeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, problems, err := qc.IntakeService.Submit(c.Request.Context(), appointment, request.Answers)
+	switch {
+	case errors.Is(err, services.ErrInvalidAnswers):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "fields": problems})
+		return
+	case errors.Is(err, services.ErrNoQuestionnaire):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrIntakeClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save intake answers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"response": response,
+	})
+}
+
+// loadQuestionnaire finds the questionnaire in the URL. Doctors can see their
+// own and shared questionnaires but only edit their own.
+func (qc *QuestionnaireController) loadQuestionnaire(c *gin.Context, edit bool) (*models.Questionnaire, bool) {
+	// Scope queries to the current organization
+	db := qc.DB.WithContext(c.Request.Context())
+
+	questionnaireID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid questionnaire ID"})
+		return nil, false
+	}
+
+	var questionnaire models.Questionnaire
+	if err := db.First(&questionnaire, questionnaireID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Questionnaire not found"})
+		return nil, false
+	}
+
+	userID, _ := c.Get("userID")
+	userRole, _ := c.Get("userRole")
+	if userRole == string(models.RoleDoctor) {
+		own := questionnaire.DoctorID == userID.(uint)
+		if !own && (edit || questionnaire.DoctorID != 0) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only manage your own questionnaires"})
+			return nil, false
+		}
+	}
+	return &questionnaire, true
+}
+
+// loadIntakeAppointment finds the appointment in the URL and checks the caller is on it
+func (qc *QuestionnaireController) loadIntakeAppointment(c *gin.Context) (*models.Appointment, bool) {
+	// Scope queries to the current organization
+	db := qc.DB.WithContext(c.Request.Context())
+
+	appointmentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		return nil, false
+	}
+
+	userID, _ := c.Get("userID")
+	userRole, _ := c.Get("userRole")
+
+	var appointment models.Appointment
+	if err := db.First(&appointment, appointmentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return nil, false
+	}
+	if userRole != string(models.RoleAdmin) &&
+		appointment.PatientID != userID.(uint) &&
+		appointment.DoctorID != userID.(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to view this appointment"})
+		return nil, false
+	}
+	return &appointment, true
+}
+
+// questionnaireResponse formats a questionnaire with one of its versions
+func questionnaireResponse(questionnaire *models.Questionnaire, version *models.QuestionnaireVersion) gin.H {
+	return gin.H{
+		"questionnaire": questionnaire,
+		"version":       version.Version,
+		"questions":     version.Questions,
+	}
+}
@@ -0,0 +1,410 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// CreateReviewRequest represents the create review request body
+type CreateReviewRequest struct {
+	AppointmentID uint   `json:"appointmentId" binding:"required"`
+	Rating        int    `json:"rating" binding:"required,min=1,max=5"`
+	Comment       string `json:"comment" binding:"max=2000"`
+}
+
+// ReviewReplyRequest represents the doctor reply request body
+type ReviewReplyRequest struct {
+	Reply string `json:"reply" binding:"required,max=2000"`
+}
+
+// ReportReviewRequest represents the report review request body
+type ReportReviewRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// ModerateReviewRequest represents the moderation decision request body
+type ModerateReviewRequest struct {
+	Status string `json:"status" binding:"required,oneof=published hidden"`
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// RatingSummary is a doctor's aggregate rating
+type RatingSummary struct {
+	DoctorID      uint    `json:"-"`
+	AverageRating float64 `json:"averageRating"`
+	ReviewCount   int64   `json:"reviewCount"`
+}
+
+// ReviewController handles doctor rating and review requests
+type ReviewController struct {
+	DB *gorm.DB
+}
+
+// NewReviewController creates a new instance of ReviewController
+func NewReviewController() *ReviewController {
+	return &ReviewController{
+		DB: config.DB,
+	}
+}
+
+// CreateReview rates a completed appointment
+func (rc *ReviewController) CreateReview(c *gin.Context) {
+	// Scope queries to the current organization
+	db := rc.DB.WithContext(c.Request.Context())
+
+	// Get authenticated user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Bind and validate request body
+	var request CreateReviewRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Find appointment by ID
+	var appointment models.Appointment
+	if err := db.First(&appointment, request.AppointmentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return
+	}
+
+	// Only the patient can review their own appointment, once it is completed
+	if appointment.PatientID != userID.(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only review your own appointments"})
+		return
+	}
+	if appointment.Status != models.StatusCompleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only completed appointments can be reviewed"})
+		return
+	}
+
+	// Allow one review per appointment
+	var existing models.Review
+	if err := db.Where("appointment_id = ?", appointment.ID).First(&existing).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "This appointment has already been reviewed"})
+		return
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	review := models.Review{
+		AppointmentID: appointment.ID,
+		PatientID:     appointment.PatientID,
+		DoctorID:      appointment.DoctorID,
+		Rating:        request.Rating,
+		Comment:       request.Comment,
+		Status:        models.ReviewStatusPublished,
+	}
+	if err := db.Create(&review).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create review"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"review": review,
+	})
+}
+
+// ListDoctorReviews lists a doctor's visible reviews with their aggregate rating
+func (rc *ReviewController) ListDoctorReviews(c *gin.Context) {
+	// Scope queries to the current organization
+	db := rc.DB.WithContext(c.Request.Context())
+
+	doctorID, err := strconv.ParseUint(c.Query("doctorId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "doctorId is required"})
+		return
+	}
+
+	var reviews []models.Review
+	if err := db.Preload("Patient").
+		Where("doctor_id = ? AND status <> ?", doctorID, models.ReviewStatusHidden).
+		Order("created_at DESC").Find(&reviews).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve reviews"})
+		return
+	}
+
+	summaries, err := loadRatingSummaries(db, []uint{uint(doctorID)})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve rating"})
+		return
+	}
+
+	response := make([]gin.H, len(reviews))
+	for i := range reviews {
+		response[i] = reviewResponse(&reviews[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"summary": summaries[uint(doctorID)],
+		"reviews": response,
+	})
+}
+
+// ReplyToReview lets the reviewed doctor reply publicly
+func (rc *ReviewController) ReplyToReview(c *gin.Context) {
+	// Scope queries to the current organization
+	db := rc.DB.WithContext(c.Request.Context())
+
+	review, ok := rc.loadReview(c, db)
+	if !ok {
+		return
+	}
+
+	// Get authenticated user ID from context
+	userID, _ := c.Get("userID")
+	if review.DoctorID != userID.(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the reviewed doctor can reply"})
+		return
+	}
+
+	// Bind and validate request body
+	var request ReviewReplyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	review.DoctorReply = request.Reply
+	review.RepliedAt = &now
+	if err := db.Save(review).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save reply"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"review": reviewResponse(review),
+	})
+}
+
+// ReportReview flags a review as abusive and puts it in the moderation queue
+func (rc *ReviewController) ReportReview(c *gin.Context) {
+	// Scope queries to the current organization
+	db := rc.DB.WithContext(c.Request.Context())
+
+	review, ok := rc.loadReview(c, db)
+	if !ok {
+		return
+	}
+
+	// Reason is optional
+	var request ReportReviewRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get authenticated user ID from context
+	userID, _ := c.Get("userID")
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Each user can report a review once
+		report := models.ReviewReport{
+			ReviewID: review.ID,
+			UserID:   userID.(uint),
+			Reason:   request.Reason,
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&report)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		updates := map[string]interface{}{"report_count": gorm.Expr("report_count + 1")}
+		// Reviews a moderator already kept stay published
+		if review.Status == models.ReviewStatusPublished && review.ModeratedAt == nil {
+			updates["status"] = models.ReviewStatusFlagged
+		}
+		return tx.Model(review).Updates(updates).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to report review"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Review reported for moderation"})
+}
+
+// ListModerationQueue lists flagged reviews awaiting an admin decision
+func (rc *ReviewController) ListModerationQueue(c *gin.Context) {
+	// Scope queries to the current organization
+	db := rc.DB.WithContext(c.Request.Context())
+
+	var reviews []models.Review
+	if err := db.Preload("Patient").Preload("Doctor").
+		Where("status = ?", models.ReviewStatusFlagged).
+		Order("report_count DESC, created_at ASC").Find(&reviews).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve moderation queue"})
+		return
+	}
+
+	// Attach the reports to each review
+	reviewIDs := make([]uint, len(reviews))
+	for i, review := range reviews {
+		reviewIDs[i] = review.ID
+	}
+	var reports []models.ReviewReport
+	if len(reviewIDs) > 0 {
+		if err := db.Where("review_id IN ?", reviewIDs).Order("created_at ASC").Find(&reports).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve reports"})
+			return
+		}
+	}
+	reportsByReview := make(map[uint][]models.ReviewReport)
+	for _, report := range reports {
+		reportsByReview[report.ReviewID] = append(reportsByReview[report.ReviewID], report)
+	}
+
+	response := make([]gin.H, len(reviews))
+	for i := range reviews {
+		item := moderationResponse(&reviews[i])
+		item["reports"] = reportsByReview[reviews[i].ID]
+		response[i] = item
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reviews": response,
+	})
+}
+
+// ModerateReview publishes or hides a review
+func (rc *ReviewController) ModerateReview(c *gin.Context) {
+	// Scope queries to the current organization
+	db := rc.DB.WithContext(c.Request.Context())
+
+	review, ok := rc.loadReview(c, db)
+	if !ok {
+		return
+	}
+
+	// Bind and validate request body
+	var request ModerateReviewRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get authenticated user ID from context
+	userID, _ := c.Get("userID")
+	moderatorID := userID.(uint)
+	now := time.Now()
+
+	review.Status = models.ReviewStatus(request.Status)
+	review.ModerationReason = request.Reason
+	review.ModeratedByID = &moderatorID
+	review.ModeratedAt = &now
+	if err := db.Save(review).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to moderate review"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"review": moderationResponse(review),
+	})
+}
+
+// loadReview loads the review in the URL
+func (rc *ReviewController) loadReview(c *gin.Context, db *gorm.DB) (*models.Review, bool) {
+	reviewID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review ID"})
+		return nil, false
+	}
+
+	var review models.Review
+	if err := db.Preload("Patient").Preload("Doctor").First(&review, reviewID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return nil, false
+	}
+
+	return &review, true
+}
+
+// loadRatingSummaries returns the aggregate rating of each doctor, ignoring hidden reviews
+func loadRatingSummaries(db *gorm.DB, doctorIDs []uint) (map[uint]RatingSummary, error) {
+	summaries := make(map[uint]RatingSummary, len(doctorIDs))
+	for _, doctorID := range doctorIDs {
+		summaries[doctorID] = RatingSummary{DoctorID: doctorID}
+	}
+	if len(doctorIDs) == 0 {
+		return summaries, nil
+	}
+
+	var rows []RatingSummary
+	if err := db.Model(&models.Review{}).
+		Select("doctor_id, AVG(rating) AS average_rating, COUNT(*) AS review_count").
+		Where("doctor_id IN ? AND status <> ?", doctorIDs, models.ReviewStatusHidden).
+		Group("doctor_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		row.AverageRating = math.Round(row.AverageRating*10) / 10
+		summaries[row.DoctorID] = row
+	}
+	return summaries, nil
+}
+
+// reviewResponse formats a review for the public directory
+func reviewResponse(review *models.Review) gin.H {
+	// Only show the reviewer's first name and last initial
+	reviewer := review.Patient.FirstName
+	if lastName := []rune(review.Patient.LastName); len(lastName) > 0 {
+		reviewer += " " + string(lastName[0]) + "."
+	}
+
+	response := gin.H{
+		"id":        review.ID,
+		"doctorId":  review.DoctorID,
+		"rating":    review.Rating,
+		"comment":   review.Comment,
+		"reviewer":  reviewer,
+		"status":    review.Status,
+		"createdAt": review.CreatedAt,
+	}
+	if review.RepliedAt != nil {
+		response["doctorReply"] = review.DoctorReply
+		response["repliedAt"] = review.RepliedAt
+	}
+	return response
+}
+
+// moderationResponse formats a review for admins, with only the names and
+// IDs of the patient and doctor
+func moderationResponse(review *models.Review) gin.H {
+	response := reviewResponse(review)
+	response["patient"] = gin.H{
+		"id":        review.Patient.ID,
+		"firstName": review.Patient.FirstName,
+		"lastName":  review.Patient.LastName,
+	}
+	response["doctor"] = gin.H{
+		"id":        review.Doctor.ID,
+		"firstName": review.Doctor.FirstName,
+		"lastName":  review.Doctor.LastName,
+	}
+	response["reportCount"] = review.ReportCount
+	if review.ModeratedAt != nil {
+		response["moderationReason"] = review.ModerationReason
+		response["moderatedById"] = review.ModeratedByID
+		response["moderatedAt"] = review.ModeratedAt
+	}
+	return response
+}
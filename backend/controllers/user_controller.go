@@ -1,14 +1,21 @@
 package controllers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	
 	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/encryption"
 	"github.com/adrianmcmains/telehealth-platform/models"
+	"github.com/adrianmcmains/telehealth-platform/services"
+	"github.com/adrianmcmains/telehealth-platform/tenancy"
 )
 
 // UpdateUserRequest represents the update user request body
@@ -20,15 +27,33 @@ type UpdateUserRequest struct {
 	DateOfBirth *string    `json:"dateOfBirth"`
 }
 
+// AccountDeletionRequestBody represents the account deletion request body
+type AccountDeletionRequestBody struct {
+	Reason string `json:"reason"`
+}
+
+// UpdatePreferencesRequest represents the update preferences request body
+type UpdatePreferencesRequest struct {
+	TimeZone        *string                                  `json:"timeZone"`
+	Language        *string                                  `json:"language"`
+	Channels        map[string][]models.NotificationChannel `json:"channels"`
+	QuietHoursStart *string                                  `json:"quietHoursStart"`
+	QuietHoursEnd   *string                                  `json:"quietHoursEnd"`
+}
+
 // UserController handles user-related requests
 type UserController struct {
-	DB *gorm.DB
+	DB               *gorm.DB
+	RetentionService *services.RetentionService
+	CalendarService  *services.CalendarService
 }
 
 // NewUserController creates a new instance of UserController
 func NewUserController() *UserController {
 	return &UserController{
-		DB: config.DB,
+		DB:               config.DB,
+		RetentionService: services.NewRetentionService(),
+		CalendarService:  services.NewCalendarService(),
 	}
 }
 
@@ -118,6 +143,14 @@ func (uc *UserController) UpdateUser(c *gin.Context) {
 	if request.Address != "" {
 		user.Address = request.Address
 	}
+	if request.DateOfBirth != nil && *request.DateOfBirth != "" {
+		dateOfBirth, err := parseBirthDate(*request.DateOfBirth)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Date of birth " + err.Error()})
+			return
+		}
+		user.DateOfBirth = &dateOfBirth
+	}
 	
 	// Save updated user to database
 	if err := uc.DB.Save(&user).Error; err != nil {
@@ -142,16 +175,203 @@ func (uc *UserController) UpdateUser(c *gin.Context) {
 	})
 }
 
-/**  // ListDoctors retrieves all doctors
+// PatchUser applies a JSON Merge Patch (RFC 7396) to a user's profile
+func (uc *UserController) PatchUser(c *gin.Context) {
+	userID, _, ok := uc.authorizeSelfOrAdmin(c)
+	if !ok {
+		return
+	}
+	userRole, _ := c.Get("userRole")
+	
+	// Decode the patch document
+	patch, err := bindMergePatch(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	// Find user by ID
+	var user models.User
+	if err := uc.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	
+	// Apply the patch
+	fieldErrors, err := applyMergePatch(patch, userPatchRules(&user), userRole.(string))
+	if errors.Is(err, errPatchUnknownField) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown fields", "fields": fieldErrors})
+		return
+	}
+	if errors.Is(err, errPatchForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to change some of these fields", "fields": fieldErrors})
+		return
+	}
+	if len(fieldErrors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": fieldErrors})
+		return
+	}
+	
+	// Save updated user to database
+	if err := uc.DB.Save(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+	
+	// Return updated user info
+	c.JSON(http.StatusOK, gin.H{
+		"user": gin.H{
+			"id":        user.ID,
+			"email":     user.Email,
+			"firstName": user.FirstName,
+			"lastName":  user.LastName,
+			"role":      user.Role,
+			"phoneNumber": user.PhoneNumber,
+			"address":   user.Address,
+			"dateOfBirth": user.DateOfBirth,
+			"createdAt": user.CreatedAt,
+			"updatedAt": user.UpdatedAt,
+		},
+	})
+}
+
+// userPatchRules lists the profile fields that can be patched and who may change them.
+// A user's role in an organization is their membership's, which organization
+// admins change through the members endpoint, so role is read-only here.
+func userPatchRules(user *models.User) map[string]patchRule {
+	anyRole := []models.UserRole{models.RolePatient, models.RoleDoctor, models.RoleAdmin}
+	
+	return withReadOnly(map[string]patchRule{
+		"firstName": {
+			Roles: anyRole,
+			Apply: func(raw json.RawMessage) (err error) {
+				user.FirstName, err = patchRequiredString(raw, 100)
+				return err
+			},
+		},
+		"lastName": {
+			Roles: anyRole,
+			Apply: func(raw json.RawMessage) (err error) {
+				user.LastName, err = patchRequiredString(raw, 100)
+				return err
+			},
+		},
+		"phoneNumber": {
+			Roles:    anyRole,
+			Nullable: true,
+			Apply: func(raw json.RawMessage) error {
+				if raw == nil {
+					user.PhoneNumber = ""
+					return nil
+				}
+				phone, err := patchRequiredString(raw, 16)
+				if err != nil {
+					return err
+				}
+				if err := validatePhoneNumber(phone); err != nil {
+					return err
+				}
+				user.PhoneNumber = phone
+				return nil
+			},
+		},
+		"address": {
+			Roles:    anyRole,
+			Nullable: true,
+			Apply: func(raw json.RawMessage) (err error) {
+				if raw == nil {
+					user.Address = ""
+					return nil
+				}
+				user.Address, err = patchString(raw, 500)
+				return err
+			},
+		},
+		"dateOfBirth": {
+			Roles:    anyRole,
+			Nullable: true,
+			Apply: func(raw json.RawMessage) error {
+				if raw == nil {
+					user.DateOfBirth = nil
+					return nil
+				}
+				value, err := patchRequiredString(raw, 0)
+				if err != nil {
+					return err
+				}
+				dateOfBirth, err := parseBirthDate(value)
+				if err != nil {
+					return err
+				}
+				user.DateOfBirth = &dateOfBirth
+				return nil
+			},
+		},
+	}, "id", "email", "role", "twoFactorEnabled", "createdAt", "updatedAt")
+}
+
+// SearchUsers finds users by phone number using the phone number blind index
+func (uc *UserController) SearchUsers(c *gin.Context) {
+	phone := c.Query("phone")
+	if phone == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "phone query parameter is required"})
+		return
+	}
+	
+	// Phone numbers are encrypted, so match on their keyed hash
+	phoneIndex, err := encryption.BlindIndex(phone)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search users"})
+		return
+	}
+	
+	var users []models.User
+	if err := uc.DB.Where("phone_number_index = ?", phoneIndex).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search users"})
+		return
+	}
+	
+	// Transform to response format
+	response := make([]gin.H, len(users))
+	for i, user := range users {
+		response[i] = gin.H{
+			"id":        user.ID,
+			"email":     user.Email,
+			"firstName": user.FirstName,
+			"lastName":  user.LastName,
+			"role":      user.Role,
+			"phoneNumber": user.PhoneNumber,
+		}
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"users": response,
+	})
+}
+
+// ListDoctors retrieves the doctors in the current organization
 func (uc *UserController) ListDoctors(c *gin.Context) {
-	var doctors []models.User
+	organizationID, _ := c.Get("organizationID")
 	
-	// Find all users with role 'doctor'
-	if err := uc.DB.Where("role = ?", models.RoleDoctor).Find(&doctors).Error; err != nil {
+	// Find all doctors who are members of the organization
+	var doctors []models.User
+	if err := uc.DB.Scopes(tenancy.MembersWithRole(organizationID.(uint), string(models.RoleDoctor))).
+		Order("last_name ASC").Find(&doctors).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve doctors"})
 		return
 	}
 	
+	// Load each doctor's aggregate rating
+	doctorIDs := make([]uint, len(doctors))
+	for i, doctor := range doctors {
+		doctorIDs[i] = doctor.ID
+	}
+	ratings, err := loadRatingSummaries(uc.DB.WithContext(c.Request.Context()), doctorIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve ratings"})
+		return
+	}
+	
 	// Transform to response format
 	response := make([]gin.H, len(doctors))
 	for i, doctor := range doctors {
@@ -161,6 +381,8 @@ func (uc *UserController) ListDoctors(c *gin.Context) {
 			"lastName":  doctor.LastName,
 			"email":     doctor.Email,
 			"phoneNumber": doctor.PhoneNumber,
+			"averageRating": ratings[doctor.ID].AverageRating,
+			"reviewCount": ratings[doctor.ID].ReviewCount,
 		}
 	}
 	
@@ -168,28 +390,279 @@ func (uc *UserController) ListDoctors(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"doctors": response,
 	})
-}**/
+}
 
-// ListDoctors retrieves the default doctor
-func (uc *UserController) ListDoctors(c *gin.Context) {
-	var doctor models.User
+// RequestAccountDeletion schedules a user's account for deletion after the cooling-off period
+func (uc *UserController) RequestAccountDeletion(c *gin.Context) {
+	userID, authUserID, ok := uc.authorizeSelfOrAdmin(c)
+	if !ok {
+		return
+	}
+	
+	// Reason is optional
+	var request AccountDeletionRequestBody
+	c.ShouldBindJSON(&request)
+	
+	// Make sure the user exists
+	var user models.User
+	if err := uc.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	
+	deletion, err := uc.RetentionService.RequestDeletion(user.ID, authUserID, request.Reason)
+	if errors.Is(err, services.ErrDeletionAlreadyRequested) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    "Account deletion has already been requested",
+			"deletion": deletion,
+		})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request account deletion"})
+		return
+	}
+	
+	c.JSON(http.StatusAccepted, gin.H{
+		"deletion": deletion,
+	})
+}
+
+// GetAccountDeletion returns the most recent deletion request for a user
+func (uc *UserController) GetAccountDeletion(c *gin.Context) {
+	userID, _, ok := uc.authorizeSelfOrAdmin(c)
+	if !ok {
+		return
+	}
 	
-	// Find the default doctor
-	if err := uc.DB.Where("role = ?", models.RoleDoctor).First(&doctor).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve doctor"})
+	var deletion models.AccountDeletionRequest
+	if err := uc.DB.Where("user_id = ?", userID).Order("created_at DESC").First(&deletion).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No account deletion request found"})
 		return
 	}
 	
-	// Return doctor info
 	c.JSON(http.StatusOK, gin.H{
-		"doctors": []gin.H{
-			{
-				"id":        doctor.ID,
-				"firstName": doctor.FirstName,
-				"lastName":  doctor.LastName,
-				"email":     doctor.Email,
-				"phoneNumber": doctor.PhoneNumber,
-			},
-		},
+		"deletion": deletion,
+	})
+}
+
+// CancelAccountDeletion cancels a pending deletion request during the cooling-off period
+func (uc *UserController) CancelAccountDeletion(c *gin.Context) {
+	userID, _, ok := uc.authorizeSelfOrAdmin(c)
+	if !ok {
+		return
+	}
+	
+	deletion, err := uc.RetentionService.CancelDeletion(userID)
+	if errors.Is(err, services.ErrNoPendingDeletion) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No pending account deletion request found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel account deletion"})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"deletion": deletion,
 	})
-}
\ No newline at end of file
+}
+
+// GetCalendarFeed returns the user's calendar subscription link, creating it on first use
+func (uc *UserController) GetCalendarFeed(c *gin.Context) {
+	userID, _, ok := uc.authorizeSelfOrAdmin(c)
+	if !ok {
+		return
+	}
+	
+	feed, err := uc.CalendarService.EnsureFeed(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve calendar feed"})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"feedUrl": uc.CalendarService.FeedURL(feed),
+	})
+}
+
+// RotateCalendarFeed replaces the user's calendar link so the old one stops working
+func (uc *UserController) RotateCalendarFeed(c *gin.Context) {
+	userID, _, ok := uc.authorizeSelfOrAdmin(c)
+	if !ok {
+		return
+	}
+	
+	feed, err := uc.CalendarService.RotateFeed(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate calendar feed"})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"feedUrl": uc.CalendarService.FeedURL(feed),
+	})
+}
+
+// DeleteCalendarFeed revokes the user's calendar link
+func (uc *UserController) DeleteCalendarFeed(c *gin.Context) {
+	userID, _, ok := uc.authorizeSelfOrAdmin(c)
+	if !ok {
+		return
+	}
+	
+	if err := uc.DB.Where("user_id = ?", userID).Delete(&models.CalendarFeed{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke calendar feed"})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Calendar feed revoked",
+	})
+}
+
+// authorizeSelfOrAdmin parses the user ID parameter and checks the caller may act on it
+func (uc *UserController) authorizeSelfOrAdmin(c *gin.Context) (uint, uint, bool) {
+	// Get user ID from URL parameter
+	id := c.Param("id")
+	userID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, 0, false
+	}
+	
+	// Get authenticated user ID and role from context
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return 0, 0, false
+	}
+	userRole, _ := c.Get("userRole")
+	
+	if authUserID.(uint) != uint(userID) && userRole != string(models.RoleAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only manage your own account"})
+		return 0, 0, false
+	}
+	
+	return uint(userID), authUserID.(uint), true
+}
+
+// GetPreferences returns a user's time zone, language and notification preferences
+func (uc *UserController) GetPreferences(c *gin.Context) {
+	userID, _, ok := uc.authorizeSelfOrAdmin(c)
+	if !ok {
+		return
+	}
+	
+	preferences, err := uc.loadPreferences(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve preferences"})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"preferences": preferences,
+	})
+}
+
+// UpdatePreferences updates a user's time zone, language and notification preferences
+func (uc *UserController) UpdatePreferences(c *gin.Context) {
+	userID, _, ok := uc.authorizeSelfOrAdmin(c)
+	if !ok {
+		return
+	}
+	
+	// Bind request body
+	var request UpdatePreferencesRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	preferences, err := uc.loadPreferences(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve preferences"})
+		return
+	}
+	
+	// Validate and apply each provided field
+	fieldErrors := PatchErrors{}
+	if request.TimeZone != nil {
+		if _, err := time.LoadLocation(*request.TimeZone); err != nil || *request.TimeZone == "" || *request.TimeZone == "Local" {
+			fieldErrors["timeZone"] = "must be an IANA time zone such as Africa/Kampala"
+		} else {
+			preferences.TimeZone = *request.TimeZone
+		}
+	}
+	if request.Language != nil {
+		if !services.IsSupportedLanguage(*request.Language) {
+			fieldErrors["language"] = fmt.Sprintf("must be one of %v", services.SupportedLanguages)
+		} else {
+			preferences.Language = *request.Language
+		}
+	}
+	if request.Channels != nil {
+		if err := validateChannelPreferences(request.Channels); err != nil {
+			fieldErrors["channels"] = err.Error()
+		} else {
+			preferences.Channels = request.Channels
+		}
+	}
+	if request.QuietHoursStart != nil {
+		preferences.QuietHoursStart = *request.QuietHoursStart
+	}
+	if request.QuietHoursEnd != nil {
+		preferences.QuietHoursEnd = *request.QuietHoursEnd
+	}
+	if (preferences.QuietHoursStart == "") != (preferences.QuietHoursEnd == "") {
+		fieldErrors["quietHours"] = "quietHoursStart and quietHoursEnd must be set together"
+	} else if preferences.QuietHoursStart != "" &&
+		(!models.ValidClock(preferences.QuietHoursStart) || !models.ValidClock(preferences.QuietHoursEnd)) {
+		fieldErrors["quietHours"] = "must be 24-hour times in HH:MM format"
+	}
+	if len(fieldErrors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": fieldErrors})
+		return
+	}
+	
+	if err := uc.DB.Save(&preferences).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update preferences"})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"preferences": preferences,
+	})
+}
+
+// loadPreferences returns a user's saved preferences, or the defaults if they have none
+func (uc *UserController) loadPreferences(userID uint) (models.UserPreferences, error) {
+	var saved []models.UserPreferences
+	if err := uc.DB.Where("user_id = ?", userID).Limit(1).Find(&saved).Error; err != nil {
+		return models.UserPreferences{}, err
+	}
+	if len(saved) == 0 {
+		return models.DefaultUserPreferences(userID), nil
+	}
+	return saved[0], nil
+}
+
+// validateChannelPreferences checks that channel preferences only name known types and channels
+func validateChannelPreferences(channels map[string][]models.NotificationChannel) error {
+	for notificationType, selected := range channels {
+		known := false
+		for _, t := range services.NotificationTypes {
+			if string(t) == notificationType {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown notification type %q", notificationType)
+		}
+		for _, channel := range selected {
+			if channel != models.ChannelEmail && channel != models.ChannelSMS {
+				return fmt.Errorf("unknown channel %q for %s", channel, notificationType)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+	"github.com/adrianmcmains/telehealth-platform/services"
+	"github.com/adrianmcmains/telehealth-platform/tenancy"
+)
+
+// maxWaitlistRange limits how far apart a waitlist entry's dates may be
+const maxWaitlistRange = 90 * 24 * time.Hour
+
+// JoinWaitlistRequest represents the join waitlist request body
+type JoinWaitlistRequest struct {
+	DoctorID uint   `json:"doctorId" binding:"required"`
+	FromDate string `json:"fromDate" binding:"required"`
+	ToDate   string `json:"toDate" binding:"required"`
+	Reason   string `json:"reason" binding:"required,max=500"`
+}
+
+// WaitlistController handles waitlist and slot offer requests
+type WaitlistController struct {
+	DB              *gorm.DB
+	WaitlistService *services.WaitlistService
+}
+
+// NewWaitlistController creates a new instance of WaitlistController
+func NewWaitlistController() *WaitlistController {
+	return &WaitlistController{
+		DB:              config.DB,
+		WaitlistService: services.NewWaitlistService(),
+	}
+}
+
+// JoinWaitlist adds the patient to a doctor's waitlist
+func (wc *WaitlistController) JoinWaitlist(c *gin.Context) {
+	// Scope queries to the current organization
+	db := wc.DB.WithContext(c.Request.Context())
+
+	// Get authenticated user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Bind and validate request body
+	var request JoinWaitlistRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Check the doctor belongs to the current organization
+	organizationID, _ := c.Get("organizationID")
+	var doctor models.User
+	if err := db.Scopes(tenancy.MembersWithRole(organizationID.(uint), string(models.RoleDoctor))).
+		First(&doctor, request.DoctorID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Doctor not found"})
+		return
+	}
+
+	fromDate, errFrom := time.Parse(models.ExceptionDateFormat, request.FromDate)
+	toDate, errTo := time.Parse(models.ExceptionDateFormat, request.ToDate)
+	if errFrom != nil || errTo != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dates must be in YYYY-MM-DD format"})
+		return
+	}
+	if toDate.Before(fromDate) || toDate.Sub(fromDate) > maxWaitlistRange {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fromDate must not be after toDate, at most 90 days apart"})
+		return
+	}
+	if request.ToDate < time.Now().Format(models.ExceptionDateFormat) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The preferred dates have already passed"})
+		return
+	}
+
+	// One active entry per patient and doctor
+	var active int64
+	if err := db.Model(&models.WaitlistEntry{}).
+		Where("doctor_id = ? AND patient_id = ? AND status IN ?", doctor.ID, userID,
+			[]models.WaitlistStatus{models.WaitlistStatusWaiting, models.WaitlistStatusOffered}).
+		Count(&active).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join waitlist"})
+		return
+	}
+	if active > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "You are already on this doctor's waitlist"})
+		return
+	}
+
+	entry := models.WaitlistEntry{
+		DoctorID:  doctor.ID,
+		PatientID: userID.(uint),
+		FromDate:  request.FromDate,
+		ToDate:    request.ToDate,
+		Reason:    request.Reason,
+		Status:    models.WaitlistStatusWaiting,
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join waitlist"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"entry": waitlistEntryResponse(&entry),
+	})
+}
+
+// ListWaitlist lists the patient's own entries, a doctor's waiting patients,
+// or every entry for admins
+func (wc *WaitlistController) ListWaitlist(c *gin.Context) {
+	// Scope queries to the current organization
+	db := wc.DB.WithContext(c.Request.Context())
+
+	// Get authenticated user ID and role from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userRole, _ := c.Get("userRole")
+
+	query := db.Preload("Patient").Preload("Doctor")
+	switch userRole {
+	case string(models.RolePatient):
+		query = query.Where("patient_id = ?", userID)
+	case string(models.RoleDoctor):
+		query = query.Where("doctor_id = ?", userID)
+	default:
+		if doctorID := c.Query("doctorId"); doctorID != "" {
+			query = query.Where("doctor_id = ?", doctorID)
+		}
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	} else if userRole != string(models.RolePatient) {
+		query = query.Where("status IN ?", []models.WaitlistStatus{models.WaitlistStatusWaiting, models.WaitlistStatusOffered})
+	}
+
+	var entries []models.WaitlistEntry
+	if err := query.Order("created_at ASC").Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve waitlist"})
+		return
+	}
+
+	response := make([]gin.H, len(entries))
+	for i := range entries {
+		response[i] = waitlistEntryResponse(&entries[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": response,
+	})
+}
+
+// LeaveWaitlist removes an entry from the waitlist
+func (wc *WaitlistController) LeaveWaitlist(c *gin.Context) {
+	// Scope queries to the current organization
+	db := wc.DB.WithContext(c.Request.Context())
+
+	entryID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid waitlist entry ID"})
+		return
+	}
+
+	// Get authenticated user ID and role from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userRole, _ := c.Get("userRole")
+
+	var entry models.WaitlistEntry
+	if err := db.First(&entry, entryID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Waitlist entry not found"})
+		return
+	}
+	if entry.PatientID != userID.(uint) && userRole != string(models.RoleAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only leave your own waitlist entries"})
+		return
+	}
+	if entry.Status != models.WaitlistStatusWaiting && entry.Status != models.WaitlistStatusOffered {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "This waitlist entry is no longer active", "status": entry.Status})
+		return
+	}
+
+	if err := wc.WaitlistService.Leave(c.Request.Context(), &entry); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave waitlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Removed from waitlist"})
+}
+
+// GetOffer shows the slot behind a claim link
+func (wc *WaitlistController) GetOffer(c *gin.Context) {
+	offer, ok := wc.loadOffer(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"offer": offer,
+	})
+}
+
+// ClaimOffer books the offered slot
+func (wc *WaitlistController) ClaimOffer(c *gin.Context) {
+	offer, ok := wc.loadOffer(c)
+	if !ok {
+		return
+	}
+
+	appointment, err := wc.WaitlistService.Claim(c.Request.Context(), offer)
+	switch {
+	case errors.Is(err, services.ErrOfferClosed), errors.Is(err, services.ErrOfferExpired):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error(), "status": offer.Status})
+		return
+	case errors.Is(err, services.ErrSlotUnavailable), errors.Is(err, services.ErrSlotOutsideAvailability),
+		errors.Is(err, services.ErrBookingTooSoon), errors.Is(err, services.ErrBookingTooFar),
+		errors.Is(err, services.ErrBufferConflict), errors.Is(err, services.ErrDailyLimitReached):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim slot"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"appointment": gin.H{
+			"id":                appointment.ID,
+			"patientId":         appointment.PatientID,
+			"doctorId":          appointment.DoctorID,
+			"startTime":         appointment.StartTime,
+			"endTime":           appointment.EndTime,
+			"status":            appointment.Status,
+			"reason":            appointment.Reason,
+			"appointmentTypeId": appointment.AppointmentTypeID,
+			"modality":          appointment.Modality,
+			"price":             appointment.Price,
+			"holdExpiresAt":     appointment.HoldExpiresAt,
+			"createdAt":         appointment.CreatedAt,
+		},
+	})
+}
+
+// DeclineOffer turns the slot down so it goes to the next patient
+func (wc *WaitlistController) DeclineOffer(c *gin.Context) {
+	offer, ok := wc.loadOffer(c)
+	if !ok {
+		return
+	}
+
+	if err := wc.WaitlistService.Decline(offer); err != nil {
+		if errors.Is(err, services.ErrOfferClosed) {
+			c.JSON(http.StatusGone, gin.H{"error": err.Error(), "status": offer.Status})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decline offer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Offer declined; you keep your place on the waitlist"})
+}
+
+// loadOffer finds the offer behind a claim token; only the patient it was made to may use it
+func (wc *WaitlistController) loadOffer(c *gin.Context) (*models.WaitlistOffer, bool) {
+	// Scope queries to the current organization
+	db := wc.DB.WithContext(c.Request.Context())
+
+	// Get authenticated user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	var offer models.WaitlistOffer
+	if err := db.Where("token = ?", c.Param("token")).First(&offer).Error; err != nil ||
+		offer.PatientID != userID.(uint) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Offer not found"})
+		return nil, false
+	}
+
+	return &offer, true
+}
+
+// waitlistEntryResponse formats a waitlist entry
+func waitlistEntryResponse(entry *models.WaitlistEntry) gin.H {
+	response := gin.H{
+		"id":            entry.ID,
+		"doctorId":      entry.DoctorID,
+		"patientId":     entry.PatientID,
+		"fromDate":      entry.FromDate,
+		"toDate":        entry.ToDate,
+		"reason":        entry.Reason,
+		"status":        entry.Status,
+		"appointmentId": entry.AppointmentID,
+		"createdAt":     entry.CreatedAt,
+	}
+	if entry.Doctor.ID != 0 {
+		response["doctor"] = gin.H{
+			"id":        entry.Doctor.ID,
+			"firstName": entry.Doctor.FirstName,
+			"lastName":  entry.Doctor.LastName,
+		}
+	}
+	if entry.Patient.ID != 0 {
+		response["patient"] = gin.H{
+			"id":        entry.Patient.ID,
+			"firstName": entry.Patient.FirstName,
+			"lastName":  entry.Patient.LastName,
+		}
+	}
+	return response
+}
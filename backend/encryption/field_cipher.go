@@ -0,0 +1,144 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// ciphertextPrefix marks values written by this package, followed by the key ID
+const ciphertextPrefix = "enc:v1:"
+
+// ErrNotConfigured is returned when encryption is used before Configure is called
+var ErrNotConfigured = errors.New("field encryption is not configured")
+
+var provider KeyProvider
+
+// Configure sets the key provider used for all field encryption
+func Configure(p KeyProvider) {
+	provider = p
+}
+
+// IsEncrypted reports whether a stored value was produced by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, ciphertextPrefix)
+}
+
+// Encrypt encrypts a value with the active key using AES-256-GCM
+func Encrypt(plaintext []byte) (string, error) {
+	if provider == nil {
+		return "", ErrNotConfigured
+	}
+
+	keyID, key, err := provider.ActiveKey()
+	if err != nil {
+		return "", fmt.Errorf("failed to get active key: %w", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("failed to create nonce: %w", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plaintext, nil)
+	return ciphertextPrefix + keyID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value produced by Encrypt
+func Decrypt(value string) ([]byte, error) {
+	if provider == nil {
+		return nil, ErrNotConfigured
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(value, ciphertextPrefix), ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("malformed ciphertext")
+	}
+
+	key, err := provider.Key(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ciphertext: %w", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := gcm.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// BlindIndex returns a keyed hash of a phone number so it can be matched without decrypting
+func BlindIndex(phoneNumber string) (string, error) {
+	normalized := NormalizePhoneNumber(phoneNumber)
+	if normalized == "" {
+		return "", nil
+	}
+	if provider == nil {
+		return "", ErrNotConfigured
+	}
+
+	key, err := provider.BlindIndexKey()
+	if err != nil {
+		return "", fmt.Errorf("failed to get blind index key: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(normalized))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// NormalizePhoneNumber strips formatting so equivalent numbers share a blind index
+func NormalizePhoneNumber(phoneNumber string) string {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(phoneNumber) {
+		if unicode.IsDigit(r) || (r == '+' && i == 0) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// newGCM creates an AES-GCM cipher for a key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher block: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	return gcm, nil
+}
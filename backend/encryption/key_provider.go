@@ -0,0 +1,164 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// KeyProvider supplies the keys used for field-level encryption
+type KeyProvider interface {
+	// ActiveKey returns the ID and value of the key used to encrypt new data
+	ActiveKey() (string, []byte, error)
+
+	// Key returns the key with the given ID, used to decrypt existing data
+	Key(id string) ([]byte, error)
+
+	// BlindIndexKey returns the key used to compute searchable blind indexes
+	BlindIndexKey() ([]byte, error)
+}
+
+// keyFile is the on-disk format read by LocalFileKeyProvider
+type keyFile struct {
+	ActiveKeyID   string            `json:"activeKeyId"`
+	Keys          map[string]string `json:"keys"`
+	BlindIndexKey string            `json:"blindIndexKey"`
+}
+
+// LocalFileKeyProvider reads base64-encoded keys from a JSON file. Intended for development.
+type LocalFileKeyProvider struct {
+	activeKeyID   string
+	keys          map[string][]byte
+	blindIndexKey []byte
+}
+
+// NewLocalFileKeyProvider loads keys from a file. A missing file is created
+// with fresh keys outside production, or when FIELD_ENCRYPTION_GENERATE_KEYS
+// is true; in production it is an error, because data encrypted with the
+// lost keys could no longer be read.
+func NewLocalFileKeyProvider(path string) (*LocalFileKeyProvider, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		if !keyGenerationAllowed() {
+			return nil, fmt.Errorf("key file %s not found; restore it, or set FIELD_ENCRYPTION_GENERATE_KEYS=true to create new keys", path)
+		}
+		log.Printf("WARNING: Field encryption key file %s not found. Generating new development keys. DO NOT USE IN PRODUCTION.", path)
+		data, err = generateKeyFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	var file keyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse key file: %w", err)
+	}
+
+	provider := &LocalFileKeyProvider{
+		activeKeyID: file.ActiveKeyID,
+		keys:        make(map[string][]byte),
+	}
+	for id, encoded := range file.Keys {
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s: %w", id, err)
+		}
+		provider.keys[id] = key
+	}
+	if _, ok := provider.keys[provider.activeKeyID]; !ok {
+		return nil, fmt.Errorf("active key %q not found in key file", provider.activeKeyID)
+	}
+
+	provider.blindIndexKey, err = decodeKey(file.BlindIndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid blind index key: %w", err)
+	}
+
+	return provider, nil
+}
+
+// ActiveKey returns the key used to encrypt new data
+func (p *LocalFileKeyProvider) ActiveKey() (string, []byte, error) {
+	return p.activeKeyID, p.keys[p.activeKeyID], nil
+}
+
+// Key returns the key with the given ID
+func (p *LocalFileKeyProvider) Key(id string) ([]byte, error) {
+	key, ok := p.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key %q", id)
+	}
+	return key, nil
+}
+
+// BlindIndexKey returns the key used for blind indexes
+func (p *LocalFileKeyProvider) BlindIndexKey() ([]byte, error) {
+	return p.blindIndexKey, nil
+}
+
+// NewKeyProviderFromEnv creates the key provider selected by FIELD_ENCRYPTION_KEY_PROVIDER
+func NewKeyProviderFromEnv() (KeyProvider, error) {
+	switch os.Getenv("FIELD_ENCRYPTION_KEY_PROVIDER") {
+	case "", "file":
+		path := os.Getenv("FIELD_ENCRYPTION_KEY_FILE")
+		if path == "" {
+			path = "keys/field_keys.json"
+		}
+		return NewLocalFileKeyProvider(path)
+	default:
+		return nil, fmt.Errorf("unsupported key provider %q", os.Getenv("FIELD_ENCRYPTION_KEY_PROVIDER"))
+	}
+}
+
+// keyGenerationAllowed reports whether a missing key file may be replaced
+// with new keys
+func keyGenerationAllowed() bool {
+	return os.Getenv("GO_ENV") != "production" || os.Getenv("FIELD_ENCRYPTION_GENERATE_KEYS") == "true"
+}
+
+// decodeKey decodes a base64 key and checks it is suitable for AES-256
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// generateKeyFile writes a key file with newly generated keys
+func generateKeyFile(path string) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	indexKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(indexKey); err != nil {
+		return nil, err
+	}
+
+	file := keyFile{
+		ActiveKeyID:   "k1",
+		Keys:          map[string]string{"k1": base64.StdEncoding.EncodeToString(dataKey)},
+		BlindIndexKey: base64.StdEncoding.EncodeToString(indexKey),
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
@@ -0,0 +1,109 @@
+package encryption
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+// legacyTimeLayouts are the text forms Postgres produces when a timestamp column is cast to text
+var legacyTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07",
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+func init() {
+	schema.RegisterSerializer("encrypted", EncryptedSerializer{})
+}
+
+// EncryptedSerializer transparently encrypts fields tagged with `gorm:"serializer:encrypted"`
+type EncryptedSerializer struct{}
+
+// Scan decrypts a stored value into the model field
+func (EncryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	fieldValue := reflect.New(field.FieldType)
+
+	if dbValue != nil {
+		var raw string
+		switch v := dbValue.(type) {
+		case []byte:
+			raw = string(v)
+		case string:
+			raw = v
+		case time.Time:
+			raw = v.Format(time.RFC3339Nano)
+		default:
+			return fmt.Errorf("failed to decrypt field %s: unsupported value %#v", field.Name, dbValue)
+		}
+
+		if raw != "" {
+			var plaintext []byte
+			if IsEncrypted(raw) {
+				decrypted, err := Decrypt(raw)
+				if err != nil {
+					return fmt.Errorf("failed to decrypt field %s: %w", field.Name, err)
+				}
+				plaintext = decrypted
+			} else {
+				// Rows written before encryption was enabled
+				plaintext = plaintextJSON(raw, field.FieldType.Kind() != reflect.String)
+			}
+
+			if err := json.Unmarshal(plaintext, fieldValue.Interface()); err != nil {
+				return fmt.Errorf("failed to decode field %s: %w", field.Name, err)
+			}
+		}
+	}
+
+	field.ReflectValueOf(ctx, dst).Set(fieldValue.Elem())
+	return nil
+}
+
+// Value encrypts a model field before it is written
+func (EncryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	plaintext, err := json.Marshal(fieldValue)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep empty values empty so presence checks and NOT NULL columns still work
+	switch string(plaintext) {
+	case "null":
+		return nil, nil
+	case `""`:
+		return "", nil
+	}
+
+	return Encrypt(plaintext)
+}
+
+// EncryptPlaintext encrypts a value stored before encryption was enabled.
+// Set isTime for columns that held timestamps.
+func EncryptPlaintext(raw string, isTime bool) (string, error) {
+	if raw == "" || IsEncrypted(raw) {
+		return raw, nil
+	}
+	return Encrypt(plaintextJSON(raw, isTime))
+}
+
+// plaintextJSON converts a legacy plaintext column value into the JSON form the serializer stores
+func plaintextJSON(raw string, isTime bool) []byte {
+	if isTime {
+		for _, layout := range legacyTimeLayouts {
+			if t, err := time.Parse(layout, raw); err == nil {
+				encoded, _ := json.Marshal(t)
+				return encoded
+			}
+		}
+	}
+
+	encoded, _ := json.Marshal(raw)
+	return encoded
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+	"github.com/adrianmcmains/telehealth-platform/tenancy"
+)
+
+// OrganizationHeader selects the organization a request acts in
+const OrganizationHeader = "X-Organization-ID"
+
+// OrganizationMiddleware resolves the current organization and scopes the request to it.
+// It must run after AuthMiddleware. The user's role in the organization replaces
+// their platform role in the context, except for platform admins.
+func OrganizationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		platformRole, _ := c.Get("userRole")
+
+		var memberships []models.OrganizationMembership
+		query := config.DB.Where("user_id = ?", userID)
+
+		// Use the requested organization, or the user's only organization
+		if header := c.GetHeader(OrganizationHeader); header != "" {
+			organizationID, err := strconv.ParseUint(header, 10, 32)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid " + OrganizationHeader + " header"})
+				return
+			}
+			query = query.Where("organization_id = ?", organizationID)
+
+			// Platform admins may act in any organization
+			if platformRole == string(models.RoleAdmin) {
+				var organization models.Organization
+				if err := config.DB.First(&organization, organizationID).Error; err != nil {
+					c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+					return
+				}
+				setOrganization(c, organization.ID, models.RoleAdmin)
+				c.Next()
+				return
+			}
+		}
+
+		if err := query.Find(&memberships).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to load organization membership"})
+			return
+		}
+
+		switch len(memberships) {
+		case 0:
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You are not a member of this organization"})
+			return
+		case 1:
+			role := memberships[0].Role
+			if platformRole == string(models.RoleAdmin) {
+				role = models.RoleAdmin
+			}
+			setOrganization(c, memberships[0].OrganizationID, role)
+		default:
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": OrganizationHeader + " header is required for members of several organizations"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// setOrganization stores the current organization and role on the request
+func setOrganization(c *gin.Context, organizationID uint, role models.UserRole) {
+	c.Set("organizationID", organizationID)
+	c.Set("userRole", string(role))
+	c.Request = c.Request.WithContext(tenancy.WithOrganization(c.Request.Context(), organizationID))
+}
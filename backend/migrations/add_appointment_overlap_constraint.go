@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+)
+
+// AddAppointmentOverlapConstraint stops a doctor's active appointments from overlapping.
+// The exclusion constraint is checked by Postgres on every insert and update, so two
+// concurrent bookings for the same time cannot both succeed.
+func AddAppointmentOverlapConstraint() error {
+	db := config.DB
+	
+	// Skip if the constraint already exists
+	var exists bool
+	if err := db.Raw(`SELECT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'appointments_doctor_no_overlap')`).
+		Scan(&exists).Error; err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	
+	// btree_gist lets the constraint compare doctor_id with = inside a GiST index
+	if err := db.Exec(`CREATE EXTENSION IF NOT EXISTS btree_gist`).Error; err != nil {
+		return fmt.Errorf("failed to enable btree_gist: %w", err)
+	}
+	
+	// Existing overlaps would make the constraint fail; report them instead
+	var overlaps int64
+	if err := db.Raw(`
+		SELECT COUNT(*) FROM appointments a
+		JOIN appointments b ON a.doctor_id = b.doctor_id AND a.id < b.id
+		WHERE a.status <> 'cancelled' AND b.status <> 'cancelled'
+		AND a.deleted_at IS NULL AND b.deleted_at IS NULL
+		AND tstzrange(a.start_time, a.end_time, '[)') && tstzrange(b.start_time, b.end_time, '[)')
+	`).Scan(&overlaps).Error; err != nil {
+		return err
+	}
+	if overlaps > 0 {
+		return fmt.Errorf("found %d pairs of overlapping active appointments; cancel the duplicates before starting the server", overlaps)
+	}
+	
+	return db.Exec(`
+		ALTER TABLE appointments ADD CONSTRAINT appointments_doctor_no_overlap
+		EXCLUDE USING gist (doctor_id WITH =, tstzrange(start_time, end_time, '[)') WITH &&)
+		WHERE (status <> 'cancelled' AND deleted_at IS NULL)
+	`).Error
+}
@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"os"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// SeedDefaultOrganization creates the default organization and moves existing data into it
+func SeedDefaultOrganization() error {
+	db := config.DB
+	
+	// Create the default organization if none exists
+	var organization models.Organization
+	if err := db.Order("id ASC").First(&organization).Error; err != nil {
+		name := os.Getenv("DEFAULT_ORGANIZATION_NAME")
+		if name == "" {
+			name = "Telehealth Platform"
+		}
+		
+		organization = models.Organization{
+			Name:           name,
+			Slug:           models.DefaultOrganizationSlug,
+			Currency:       "USD",
+			PaymentEnabled: true,
+		}
+		if err := db.Create(&organization).Error; err != nil {
+			return err
+		}
+	}
+	
+	// Give every user without a membership one in the default organization
+	if err := db.Exec(`
+		INSERT INTO organization_memberships (organization_id, user_id, role, created_at, updated_at)
+		SELECT ?, users.id, users.role, NOW(), NOW() FROM users
+		WHERE users.deleted_at IS NULL
+		AND NOT EXISTS (SELECT 1 FROM organization_memberships m WHERE m.user_id = users.id)
+	`, organization.ID).Error; err != nil {
+		return err
+	}
+	
+	// Move appointments and payments created before organizations existed
+	if err := db.Exec(`UPDATE appointments SET organization_id = ? WHERE organization_id IS NULL OR organization_id = 0`,
+		organization.ID).Error; err != nil {
+		return err
+	}
+	if err := db.Exec(`
+		UPDATE payments SET organization_id = appointments.organization_id
+		FROM appointments
+		WHERE payments.appointment_id = appointments.id
+		AND (payments.organization_id IS NULL OR payments.organization_id = 0)
+	`).Error; err != nil {
+		return err
+	}
+	
+	return nil
+}
@@ -0,0 +1,63 @@
+package migrations
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// videoRoomBatchSize is the number of appointments given a room per query
+const videoRoomBatchSize = 500
+
+// AssignVideoRooms gives every existing appointment its own random video room
+// and makes room IDs unique. Rooms used to be named by clients, so old names
+// may be shared or easy to guess; they are all replaced once. It runs before
+// AutoMigrate, which would otherwise fail to create the model's unique index
+// over the old names.
+func AssignVideoRooms() error {
+	db := config.DB
+
+	// Skip on a new database, where AutoMigrate creates the table and index,
+	// or if the rooms were already assigned
+	var skip bool
+	if err := db.Raw(`SELECT to_regclass('appointments') IS NULL
+		OR EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'idx_appointments_video_room')`).
+		Scan(&skip).Error; err != nil {
+		return err
+	}
+	if skip {
+		return nil
+	}
+
+	var lastID uint
+	updated := 0
+	for {
+		var ids []uint
+		if err := db.Raw(`SELECT id FROM appointments WHERE id > ? ORDER BY id LIMIT ?`,
+			lastID, videoRoomBatchSize).Scan(&ids).Error; err != nil {
+			return fmt.Errorf("failed to read appointments: %w", err)
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		for _, id := range ids {
+			lastID = id
+			roomID, err := models.NewVideoRoomID()
+			if err != nil {
+				return err
+			}
+			if err := db.Exec(`UPDATE appointments SET video_room_id = ? WHERE id = ?`, roomID, id).Error; err != nil {
+				return fmt.Errorf("failed to assign a video room to appointment %d: %w", id, err)
+			}
+			updated++
+		}
+	}
+	if updated > 0 {
+		log.Printf("Assigned video rooms to %d appointments", updated)
+	}
+
+	return db.Exec(`CREATE UNIQUE INDEX idx_appointments_video_room ON appointments (video_room_id)`).Error
+}
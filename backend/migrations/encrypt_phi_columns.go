@@ -0,0 +1,148 @@
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/encryption"
+)
+
+// encryptBatchSize is the number of rows encrypted per query
+const encryptBatchSize = 500
+
+// EncryptPHIColumns encrypts PHI columns in rows written before field encryption was enabled
+func EncryptPHIColumns() error {
+	if err := encryptUserColumns(); err != nil {
+		return err
+	}
+
+	return encryptAppointmentColumns()
+}
+
+// encryptUserColumns encrypts phone numbers, addresses and dates of birth and fills the phone blind index
+func encryptUserColumns() error {
+	db := config.DB
+
+	type userRow struct {
+		ID          uint
+		PhoneNumber sql.NullString
+		Address     sql.NullString
+		DateOfBirth sql.NullString
+	}
+
+	var lastID uint
+	updated := 0
+	for {
+		var rows []userRow
+		if err := db.Raw(`SELECT id, phone_number, address, date_of_birth FROM users WHERE id > ? ORDER BY id LIMIT ?`,
+			lastID, encryptBatchSize).Scan(&rows).Error; err != nil {
+			return fmt.Errorf("failed to read users: %w", err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for _, row := range rows {
+			lastID = row.ID
+			if isEncryptedOrEmpty(row.PhoneNumber) && isEncryptedOrEmpty(row.Address) && isEncryptedOrEmpty(row.DateOfBirth) {
+				continue
+			}
+
+			phoneIndex, err := encryption.BlindIndex(row.PhoneNumber.String)
+			if err != nil {
+				return err
+			}
+			phone, err := encryption.EncryptPlaintext(row.PhoneNumber.String, false)
+			if err != nil {
+				return err
+			}
+			address, err := encryption.EncryptPlaintext(row.Address.String, false)
+			if err != nil {
+				return err
+			}
+			dateOfBirth, err := encryptNullable(row.DateOfBirth, true)
+			if err != nil {
+				return err
+			}
+
+			// Only recompute the blind index from a plaintext phone number
+			if encryption.IsEncrypted(row.PhoneNumber.String) {
+				if err := db.Exec(`UPDATE users SET address = ?, date_of_birth = ? WHERE id = ?`,
+					address, dateOfBirth, row.ID).Error; err != nil {
+					return fmt.Errorf("failed to encrypt user %d: %w", row.ID, err)
+				}
+			} else if err := db.Exec(`UPDATE users SET phone_number = ?, phone_number_index = ?, address = ?, date_of_birth = ? WHERE id = ?`,
+				phone, phoneIndex, address, dateOfBirth, row.ID).Error; err != nil {
+				return fmt.Errorf("failed to encrypt user %d: %w", row.ID, err)
+			}
+			updated++
+		}
+	}
+
+	log.Printf("Encrypted PHI columns for %d users", updated)
+	return nil
+}
+
+// encryptAppointmentColumns encrypts appointment reasons and notes
+func encryptAppointmentColumns() error {
+	db := config.DB
+
+	type appointmentRow struct {
+		ID     uint
+		Reason sql.NullString
+		Notes  sql.NullString
+	}
+
+	var lastID uint
+	updated := 0
+	for {
+		var rows []appointmentRow
+		if err := db.Raw(`SELECT id, reason, notes FROM appointments WHERE id > ? ORDER BY id LIMIT ?`,
+			lastID, encryptBatchSize).Scan(&rows).Error; err != nil {
+			return fmt.Errorf("failed to read appointments: %w", err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for _, row := range rows {
+			lastID = row.ID
+			if isEncryptedOrEmpty(row.Reason) && isEncryptedOrEmpty(row.Notes) {
+				continue
+			}
+
+			reason, err := encryption.EncryptPlaintext(row.Reason.String, false)
+			if err != nil {
+				return err
+			}
+			notes, err := encryption.EncryptPlaintext(row.Notes.String, false)
+			if err != nil {
+				return err
+			}
+
+			if err := db.Exec(`UPDATE appointments SET reason = ?, notes = ? WHERE id = ?`,
+				reason, notes, row.ID).Error; err != nil {
+				return fmt.Errorf("failed to encrypt appointment %d: %w", row.ID, err)
+			}
+			updated++
+		}
+	}
+
+	log.Printf("Encrypted PHI columns for %d appointments", updated)
+	return nil
+}
+
+// isEncryptedOrEmpty reports whether a column value needs no encryption
+func isEncryptedOrEmpty(value sql.NullString) bool {
+	return !value.Valid || value.String == "" || encryption.IsEncrypted(value.String)
+}
+
+// encryptNullable encrypts a nullable column value, keeping NULL as NULL
+func encryptNullable(value sql.NullString, isTime bool) (interface{}, error) {
+	if !value.Valid {
+		return nil, nil
+	}
+	return encryption.EncryptPlaintext(value.String, isTime)
+}
@@ -1,18 +1,58 @@
 package migrations
 
+import (
+	"fmt"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+)
+
 // RunMigrations runs all database migrations in order
 func RunMigrations() error {
-	// Run other migrations first...
+	// Create and update tables from the models
+	if err := MigrateSchema(); err != nil {
+		return err
+	}
 	
 	// Add 2FA fields
 	if err := AddTwoFAFields(); err != nil {
 		return err
 	}
 
+	// Prevent overlapping appointments for a doctor
+	if err := AddAppointmentOverlapConstraint(); err != nil {
+		return err
+	}
+
 	// Seed default doctor
 	if err := SeedDefaultDoctor(); err != nil {
 		return err
 	}
 	
+	// Seed default organization and backfill memberships
+	if err := SeedDefaultOrganization(); err != nil {
+		return err
+	}
+	
+	// Give existing doctors default working hours
+	if err := SeedDefaultAvailability(); err != nil {
+		return err
+	}
+	
+	return nil
+}
+
+// MigrateSchema brings the tables up to date with the models. Existing rows
+// that would break a new index are fixed first, because AutoMigrate creates
+// the model's indexes.
+func MigrateSchema() error {
+	// Give each appointment its own unguessable video room before the unique
+	// index on room IDs is created
+	if err := AssignVideoRooms(); err != nil {
+		return err
+	}
+
+	if err := config.AutoMigrate(config.DB); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
 	return nil
-}
\ No newline at end of file
+}
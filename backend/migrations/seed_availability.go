@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// SeedDefaultAvailability gives doctors Monday to Friday 09:00-17:00 hours the first
+// time availability is introduced, so existing doctors stay bookable
+func SeedDefaultAvailability() error {
+	db := config.DB
+	
+	// Only seed an empty table; afterwards doctors manage their own hours
+	var count int64
+	if err := db.Model(&models.AvailabilityRule{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	
+	var memberships []models.OrganizationMembership
+	if err := db.Where("role = ?", models.RoleDoctor).Find(&memberships).Error; err != nil {
+		return err
+	}
+	
+	var rules []models.AvailabilityRule
+	for _, membership := range memberships {
+		for weekday := time.Monday; weekday <= time.Friday; weekday++ {
+			rules = append(rules, models.AvailabilityRule{
+				OrganizationID: membership.OrganizationID,
+				DoctorID:       membership.UserID,
+				Weekday:        weekday,
+				StartTime:      "09:00",
+				EndTime:        "17:00",
+			})
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	
+	return db.Create(&rules).Error
+}
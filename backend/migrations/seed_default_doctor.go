@@ -21,7 +21,7 @@ func SeedDefaultDoctor() error {
 			FirstName: "Dr.",
 			LastName:  "Ndaara",
 			Role:      models.RoleDoctor,
-			PhoneNumber: "+256-773-388-441",
+			PhoneNumber: "+256773388441",
 		}
 		
 		// Set password to "password123" (in production, use a secure password)
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// DeletionStatus represents the status of an account deletion request
+type DeletionStatus string
+
+const (
+	DeletionStatusPending   DeletionStatus = "pending"
+	DeletionStatusCancelled DeletionStatus = "cancelled"
+	DeletionStatusCompleted DeletionStatus = "completed"
+)
+
+// AccountDeletionRequest represents a user's request to delete their account
+type AccountDeletionRequest struct {
+	ID           uint           `gorm:"primaryKey" json:"id"`
+	UserID       uint           `gorm:"not null;index" json:"userId"`
+	RequestedBy  uint           `gorm:"not null" json:"requestedBy"`
+	Status       DeletionStatus `gorm:"not null;default:pending" json:"status"`
+	Reason       string         `gorm:"size:500" json:"reason,omitempty"`
+	ScheduledFor time.Time      `gorm:"not null;index" json:"scheduledFor"`
+	CompletedAt  *time.Time     `json:"completedAt,omitempty"`
+	CancelledAt  *time.Time     `json:"cancelledAt,omitempty"`
+	CreatedAt    time.Time      `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt    time.Time      `gorm:"autoUpdateTime" json:"updatedAt"`
+}
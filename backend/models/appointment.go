@@ -1,6 +1,8 @@
 package models
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"time"
 
 	"gorm.io/gorm"
@@ -9,6 +11,7 @@ import (
 type AppointmentStatus string
 
 const (
+	StatusHeld       AppointmentStatus = "held"
 	StatusScheduled  AppointmentStatus = "scheduled"
 	StatusInProgress AppointmentStatus = "in-progress"
 	StatusCompleted  AppointmentStatus = "completed"
@@ -16,21 +19,41 @@ const (
 	StatusNoShow     AppointmentStatus = "no-show"
 )
 
+// Valid reports whether the status is one of the known statuses
+func (s AppointmentStatus) Valid() bool {
+	switch s {
+	case StatusHeld, StatusScheduled, StatusInProgress, StatusCompleted, StatusCancelled, StatusNoShow:
+		return true
+	}
+	return false
+}
+
+// Appointment listings are paged by (start_time, id) or (created_at, id)
+// within a patient, doctor or organization; the composite indexes below
+// serve those keyset queries.
 type Appointment struct {
-	ID           uint              `gorm:"primaryKey" json:"id"`
-	PatientID    uint              `gorm:"not null" json:"patientId"`
+	ID           uint              `gorm:"primaryKey;index:idx_appointments_patient_start,priority:3;index:idx_appointments_doctor_start,priority:3;index:idx_appointments_org_start,priority:3;index:idx_appointments_org_created,priority:3" json:"id"`
+	OrganizationID uint            `gorm:"index;index:idx_appointments_org_start,priority:1;index:idx_appointments_org_created,priority:1" json:"organizationId"`
+	PatientID    uint              `gorm:"not null;index:idx_appointments_patient_start,priority:1" json:"patientId"`
 	Patient      User              `gorm:"foreignKey:PatientID" json:"patient"`
-	DoctorID     uint              `gorm:"not null" json:"doctorId"`
+	DoctorID     uint              `gorm:"not null;index:idx_appointments_doctor_start,priority:1" json:"doctorId"`
 	Doctor       User              `gorm:"foreignKey:DoctorID" json:"doctor"`
-	StartTime    time.Time         `gorm:"not null" json:"startTime"`
+	StartTime    time.Time         `gorm:"not null;index:idx_appointments_patient_start,priority:2;index:idx_appointments_doctor_start,priority:2;index:idx_appointments_org_start,priority:2" json:"startTime"`
 	EndTime      time.Time         `gorm:"not null" json:"endTime"`
 	Status       AppointmentStatus `gorm:"not null;default:scheduled" json:"status"`
-	Reason       string            `gorm:"size:500" json:"reason"`
-	Notes        string            `gorm:"size:1000" json:"notes,omitempty"`
-	VideoRoomID  string            `json:"videoRoomId,omitempty"`
+	Reason       string            `gorm:"type:text;serializer:encrypted" json:"reason"`
+	Notes        string            `gorm:"type:text;serializer:encrypted" json:"notes,omitempty"`
+	VideoRoomID  string            `gorm:"uniqueIndex:idx_appointments_video_room" json:"videoRoomId,omitempty"`
 	IsPaid       bool              `gorm:"default:false" json:"isPaid"`
 	Price        float64           `gorm:"default:0" json:"price"`
-	CreatedAt    time.Time         `gorm:"autoCreateTime" json:"createdAt"`
+	SeriesID     *uint             `gorm:"index" json:"seriesId,omitempty"`
+	AppointmentTypeID *uint        `gorm:"index" json:"appointmentTypeId,omitempty"`
+	AppointmentType   *AppointmentType `gorm:"foreignKey:AppointmentTypeID" json:"appointmentType,omitempty"`
+	Modality     AppointmentModality `gorm:"not null;default:video" json:"modality"`
+	// HoldExpiresAt is when a held slot is released if checkout has not
+	// completed; it is cleared once the payment confirms the hold
+	HoldExpiresAt *time.Time       `gorm:"index" json:"holdExpiresAt,omitempty"`
+	CreatedAt    time.Time         `gorm:"autoCreateTime;index:idx_appointments_org_created,priority:2" json:"createdAt"`
 	UpdatedAt    time.Time         `gorm:"autoUpdateTime" json:"updatedAt"`
 	DeletedAt    gorm.DeletedAt    `gorm:"index" json:"-"`
 }
@@ -41,7 +64,24 @@ func (a *Appointment) BeforeCreate(tx *gorm.DB) (err error) {
 	if a.StartTime.After(a.EndTime) {
 		return gorm.ErrInvalidData
 	}
-	return nil
+	
+	// Give every appointment its own video room that cannot be guessed
+	a.VideoRoomID, err = NewVideoRoomID()
+	return err
+}
+
+// NewVideoRoomID returns a random video room ID
+func NewVideoRoomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HoldOpen reports whether the appointment is held and the hold has not expired
+func (a *Appointment) HoldOpen(now time.Time) bool {
+	return a.Status == StatusHeld && a.HoldExpiresAt != nil && now.Before(*a.HoldExpiresAt)
 }
 
 // Duration returns the appointment duration in minutes
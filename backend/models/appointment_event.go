@@ -0,0 +1,129 @@
+package models
+
+import (
+	"time"
+)
+
+// AppointmentEventType says what kind of change an appointment event records
+type AppointmentEventType string
+
+const (
+	AppointmentEventCreated       AppointmentEventType = "created"
+	AppointmentEventUpdated       AppointmentEventType = "updated"
+	AppointmentEventStatusChanged AppointmentEventType = "status_changed"
+	AppointmentEventRescheduled   AppointmentEventType = "rescheduled"
+	AppointmentEventPayment       AppointmentEventType = "payment"
+	AppointmentEventParticipants  AppointmentEventType = "participants"
+)
+
+// FieldChange is one field's value before and after a change. Before is nil
+// for fields set when the appointment or payment was created.
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AppointmentEvent is one entry in an appointment's change history. Events are
+// only ever appended; the values can include the reason and clinical notes, so
+// they are encrypted.
+type AppointmentEvent struct {
+	ID             uint                 `gorm:"primaryKey" json:"id"`
+	OrganizationID uint                 `gorm:"index" json:"organizationId"`
+	AppointmentID  uint                 `gorm:"not null;index" json:"appointmentId"`
+	Type           AppointmentEventType `gorm:"not null" json:"type"`
+	// PaymentID is set on payment events
+	PaymentID *uint         `json:"paymentId,omitempty"`
+	ActorID   uint          `json:"actorId"`
+	ActorRole UserRole      `gorm:"not null" json:"actorRole"`
+	Reason    string        `gorm:"type:text;serializer:encrypted" json:"reason,omitempty"`
+	Changes   []FieldChange `gorm:"type:text;serializer:encrypted" json:"changes"`
+	CreatedAt time.Time     `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// trackedField reads one recorded field from a value
+type trackedField[T any] struct {
+	name  string
+	value func(*T) interface{}
+}
+
+// appointmentFields are the appointment fields kept in the history
+var appointmentFields = []trackedField[Appointment]{
+	{"patientId", func(a *Appointment) interface{} { return a.PatientID }},
+	{"doctorId", func(a *Appointment) interface{} { return a.DoctorID }},
+	{"startTime", func(a *Appointment) interface{} { return historyTime(a.StartTime) }},
+	{"endTime", func(a *Appointment) interface{} { return historyTime(a.EndTime) }},
+	{"status", func(a *Appointment) interface{} { return a.Status }},
+	{"reason", func(a *Appointment) interface{} { return a.Reason }},
+	{"notes", func(a *Appointment) interface{} { return a.Notes }},
+	{"videoRoomId", func(a *Appointment) interface{} { return a.VideoRoomID }},
+	{"isPaid", func(a *Appointment) interface{} { return a.IsPaid }},
+	{"price", func(a *Appointment) interface{} { return a.Price }},
+	{"seriesId", func(a *Appointment) interface{} { return historyID(a.SeriesID) }},
+	{"appointmentTypeId", func(a *Appointment) interface{} { return historyID(a.AppointmentTypeID) }},
+	{"modality", func(a *Appointment) interface{} { return a.Modality }},
+	{"holdExpiresAt", func(a *Appointment) interface{} { return historyTimePtr(a.HoldExpiresAt) }},
+}
+
+// paymentFields are the payment fields kept in an appointment's history
+var paymentFields = []trackedField[Payment]{
+	{"payment.amount", func(p *Payment) interface{} { return p.Amount }},
+	{"payment.status", func(p *Payment) interface{} { return p.Status }},
+	{"payment.method", func(p *Payment) interface{} { return p.PaymentMethod }},
+	{"payment.refundedAmount", func(p *Payment) interface{} { return p.RefundedAmount }},
+	{"payment.refundDue", func(p *Payment) interface{} { return p.RefundDue }},
+}
+
+// DiffAppointment returns the fields that differ between two versions of an
+// appointment. With no previous version it returns every field that is set.
+func DiffAppointment(before, after *Appointment) []FieldChange {
+	return diffFields(appointmentFields, before, after)
+}
+
+// DiffPayment returns the fields that differ between two versions of a
+// payment. With no previous version it returns every field that is set.
+func DiffPayment(before, after *Payment) []FieldChange {
+	return diffFields(paymentFields, before, after)
+}
+
+func diffFields[T any](fields []trackedField[T], before, after *T) []FieldChange {
+	var zero T
+	changes := []FieldChange{}
+	for _, field := range fields {
+		value := field.value(after)
+		if before == nil {
+			if value != field.value(&zero) {
+				changes = append(changes, FieldChange{Field: field.name, After: value})
+			}
+			continue
+		}
+		if previous := field.value(before); previous != value {
+			changes = append(changes, FieldChange{Field: field.name, Before: previous, After: value})
+		}
+	}
+	return changes
+}
+
+// historyTime makes times comparable regardless of their zone or monotonic reading
+func historyTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Round(0)
+}
+
+// historyTimePtr unwraps an optional time
+func historyTimePtr(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return historyTime(*t)
+}
+
+// historyID unwraps an optional reference
+func historyID(id *uint) interface{} {
+	if id == nil {
+		return nil
+	}
+	return *id
+}
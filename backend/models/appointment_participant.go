@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+)
+
+// ParticipantRole is why someone besides the patient and doctor joins an appointment
+type ParticipantRole string
+
+const (
+	ParticipantInterpreter ParticipantRole = "interpreter"
+	ParticipantCaregiver   ParticipantRole = "caregiver"
+	ParticipantClinician   ParticipantRole = "clinician"
+)
+
+// Valid reports whether the role is one of the known participant roles
+func (r ParticipantRole) Valid() bool {
+	switch r {
+	case ParticipantInterpreter, ParticipantCaregiver, ParticipantClinician:
+		return true
+	}
+	return false
+}
+
+// AppointmentParticipant is a user invited to an appointment besides its
+// patient and doctor, such as an interpreter, a family caregiver or a second
+// clinician. Participants can view the appointment and join its video room
+// until the appointment ends.
+type AppointmentParticipant struct {
+	ID             uint            `gorm:"primaryKey" json:"id"`
+	OrganizationID uint            `gorm:"index" json:"organizationId"`
+	AppointmentID  uint            `gorm:"not null;uniqueIndex:idx_appointment_participant" json:"appointmentId"`
+	UserID         uint            `gorm:"not null;uniqueIndex:idx_appointment_participant;index" json:"userId"`
+	User           User            `gorm:"foreignKey:UserID" json:"user"`
+	Role           ParticipantRole `gorm:"not null" json:"role"`
+	InvitedByID    uint            `json:"invitedById"`
+	CreatedAt      time.Time       `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// HasAccess reports whether the participant may still open the appointment
+// and join its video room. Access ends at the appointment's end time, or when
+// the call is over if it runs late.
+func (p *AppointmentParticipant) HasAccess(appointment *Appointment, now time.Time) bool {
+	switch appointment.Status {
+	case StatusInProgress:
+		return true
+	case StatusScheduled:
+		return now.Before(appointment.EndTime)
+	}
+	return false
+}
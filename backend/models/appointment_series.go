@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+)
+
+// MaxSeriesOccurrences caps how many appointments one series may create
+const MaxSeriesOccurrences = 52
+
+// RecurrenceFrequency is how often a series repeats
+type RecurrenceFrequency string
+
+const (
+	// FrequencyWeekly repeats every week
+	FrequencyWeekly RecurrenceFrequency = "weekly"
+
+	// FrequencyBiweekly repeats every other week
+	FrequencyBiweekly RecurrenceFrequency = "biweekly"
+)
+
+// IntervalWeeks returns the weeks between occurrences, or false for an unknown frequency
+func (f RecurrenceFrequency) IntervalWeeks() (int, bool) {
+	switch f {
+	case FrequencyWeekly:
+		return 1, true
+	case FrequencyBiweekly:
+		return 2, true
+	}
+	return 0, false
+}
+
+// SeriesScope selects which occurrences of a series a change applies to
+type SeriesScope string
+
+const (
+	// ScopeThis changes only the selected occurrence
+	ScopeThis SeriesScope = "this"
+
+	// ScopeFollowing changes the selected occurrence and every later one
+	ScopeFollowing SeriesScope = "following"
+)
+
+// Valid reports whether the scope is one of the known scopes
+func (s SeriesScope) Valid() bool {
+	return s == ScopeThis || s == ScopeFollowing
+}
+
+// AppointmentSeries is a set of appointments booked together from one
+// recurrence rule. The rule is kept as it was booked; the appointments
+// themselves reflect later changes to single occurrences.
+type AppointmentSeries struct {
+	ID                uint                `gorm:"primaryKey" json:"id"`
+	OrganizationID    uint                `gorm:"index" json:"organizationId"`
+	PatientID         uint                `gorm:"not null;index" json:"patientId"`
+	DoctorID          uint                `gorm:"not null;index" json:"doctorId"`
+	Frequency         RecurrenceFrequency `gorm:"not null" json:"frequency"`
+	StartTime         time.Time           `gorm:"not null" json:"startTime"`
+	EndTime           time.Time           `gorm:"not null" json:"endTime"`
+	Until             *time.Time          `json:"until,omitempty"`
+	Count             int                 `json:"count,omitempty"`
+	Reason            string              `gorm:"type:text;serializer:encrypted" json:"reason"`
+	AppointmentTypeID *uint               `json:"appointmentTypeId,omitempty"`
+	AppointmentType   *AppointmentType    `gorm:"-" json:"-"` // applied to every occurrence when set
+	CreatedAt         time.Time           `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt         time.Time           `gorm:"autoUpdateTime" json:"updatedAt"`
+}
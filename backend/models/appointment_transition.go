@@ -0,0 +1,84 @@
+package models
+
+import (
+	"time"
+)
+
+// AppointmentTransition is an allowed status change and the roles that may make it
+type AppointmentTransition struct {
+	From  AppointmentStatus
+	To    AppointmentStatus
+	Roles []UserRole
+}
+
+// AppointmentTransitions is the appointment lifecycle. Completed, cancelled and
+// no-show appointments are final. The system role is used when attendance in
+// the video room decides the outcome, and when a payment confirms a held slot
+// or an unpaid hold expires.
+var AppointmentTransitions = []AppointmentTransition{
+	{From: StatusHeld, To: StatusScheduled, Roles: []UserRole{RoleSystem}},
+	{From: StatusHeld, To: StatusCancelled, Roles: []UserRole{RolePatient, RoleDoctor, RoleAdmin, RoleSystem}},
+	{From: StatusScheduled, To: StatusInProgress, Roles: []UserRole{RoleDoctor, RoleAdmin, RoleSystem}},
+	{From: StatusScheduled, To: StatusCancelled, Roles: []UserRole{RolePatient, RoleDoctor, RoleAdmin, RoleSystem}},
+	{From: StatusScheduled, To: StatusNoShow, Roles: []UserRole{RoleDoctor, RoleAdmin, RoleSystem}},
+	{From: StatusInProgress, To: StatusCompleted, Roles: []UserRole{RoleDoctor, RoleAdmin, RoleSystem}},
+	{From: StatusInProgress, To: StatusCancelled, Roles: []UserRole{RoleDoctor, RoleAdmin}},
+}
+
+// FindTransition returns the transition between two statuses, if there is one
+func FindTransition(from, to AppointmentStatus) (*AppointmentTransition, bool) {
+	for i := range AppointmentTransitions {
+		if AppointmentTransitions[i].From == from && AppointmentTransitions[i].To == to {
+			return &AppointmentTransitions[i], true
+		}
+	}
+	return nil, false
+}
+
+// Allows reports whether a role may make the transition
+func (t *AppointmentTransition) Allows(role UserRole) bool {
+	for _, allowed := range t.Roles {
+		if allowed == role {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFinal reports whether no transitions leave a status
+func (s AppointmentStatus) IsFinal() bool {
+	for _, transition := range AppointmentTransitions {
+		if transition.From == s {
+			return false
+		}
+	}
+	return true
+}
+
+// AppointmentStatusChange records who changed an appointment's status and why
+type AppointmentStatusChange struct {
+	ID             uint              `gorm:"primaryKey" json:"id"`
+	OrganizationID uint              `gorm:"index" json:"organizationId"`
+	AppointmentID  uint              `gorm:"not null;index" json:"appointmentId"`
+	FromStatus     AppointmentStatus `gorm:"not null" json:"fromStatus"`
+	ToStatus       AppointmentStatus `gorm:"not null" json:"toStatus"`
+	ActorID        uint              `json:"actorId"`
+	ActorRole      UserRole          `gorm:"not null" json:"actorRole"`
+	Reason         string            `gorm:"type:text" json:"reason,omitempty"`
+	CreatedAt      time.Time         `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// AppointmentReschedule records an appointment moving from one time to another
+type AppointmentReschedule struct {
+	ID                uint      `gorm:"primaryKey" json:"id"`
+	OrganizationID    uint      `gorm:"index" json:"organizationId"`
+	AppointmentID     uint      `gorm:"not null;index" json:"appointmentId"`
+	PreviousStartTime time.Time `gorm:"not null" json:"previousStartTime"`
+	PreviousEndTime   time.Time `gorm:"not null" json:"previousEndTime"`
+	NewStartTime      time.Time `gorm:"not null" json:"newStartTime"`
+	NewEndTime        time.Time `gorm:"not null" json:"newEndTime"`
+	ActorID           uint      `json:"actorId"`
+	ActorRole         UserRole  `gorm:"not null" json:"actorRole"`
+	Reason            string    `gorm:"type:text" json:"reason,omitempty"`
+	CreatedAt         time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
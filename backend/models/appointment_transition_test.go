@@ -0,0 +1,63 @@
+package models
+
+import "testing"
+
+func TestFindTransitionAllows(t *testing.T) {
+	tests := []struct {
+		from, to AppointmentStatus
+		role     UserRole
+		want     bool
+	}{
+		{StatusHeld, StatusScheduled, RoleSystem, true},
+		{StatusHeld, StatusScheduled, RolePatient, false},
+		{StatusScheduled, StatusCancelled, RolePatient, true},
+		{StatusScheduled, StatusInProgress, RolePatient, false},
+		{StatusScheduled, StatusInProgress, RoleDoctor, true},
+		{StatusScheduled, StatusNoShow, RoleSystem, true},
+		{StatusInProgress, StatusCompleted, RoleDoctor, true},
+		{StatusInProgress, StatusCancelled, RoleAdmin, true},
+		{StatusInProgress, StatusCancelled, RolePatient, false},
+		{StatusInProgress, StatusCancelled, RoleSystem, false},
+	}
+	for _, tt := range tests {
+		transition, ok := FindTransition(tt.from, tt.to)
+		if !ok {
+			t.Errorf("FindTransition(%s, %s) found no transition", tt.from, tt.to)
+			continue
+		}
+		if got := transition.Allows(tt.role); got != tt.want {
+			t.Errorf("%s to %s Allows(%s) = %v, want %v", tt.from, tt.to, tt.role, got, tt.want)
+		}
+	}
+}
+
+func TestFindTransitionMissing(t *testing.T) {
+	tests := []struct {
+		from, to AppointmentStatus
+	}{
+		{StatusScheduled, StatusCompleted},
+		{StatusCompleted, StatusScheduled},
+		{StatusCancelled, StatusScheduled},
+		{StatusNoShow, StatusCompleted},
+		{StatusHeld, StatusInProgress},
+		{StatusScheduled, StatusScheduled},
+	}
+	for _, tt := range tests {
+		if transition, ok := FindTransition(tt.from, tt.to); ok {
+			t.Errorf("FindTransition(%s, %s) = %+v, want none", tt.from, tt.to, *transition)
+		}
+	}
+}
+
+func TestAppointmentStatusIsFinal(t *testing.T) {
+	for _, status := range []AppointmentStatus{StatusCompleted, StatusCancelled, StatusNoShow} {
+		if !status.IsFinal() {
+			t.Errorf("%s.IsFinal() = false, want true", status)
+		}
+	}
+	for _, status := range []AppointmentStatus{StatusHeld, StatusScheduled, StatusInProgress} {
+		if status.IsFinal() {
+			t.Errorf("%s.IsFinal() = true, want false", status)
+		}
+	}
+}
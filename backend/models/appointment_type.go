@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AppointmentModality is how a visit is held
+type AppointmentModality string
+
+const (
+	// ModalityVideo is a video call
+	ModalityVideo AppointmentModality = "video"
+
+	// ModalityAudio is an audio-only call
+	ModalityAudio AppointmentModality = "audio"
+)
+
+// Valid reports whether the modality is one of the known modalities
+func (m AppointmentModality) Valid() bool {
+	return m == ModalityVideo || m == ModalityAudio
+}
+
+// AppointmentType is a kind of visit a doctor offers, such as a 15-minute
+// follow-up. Booking a type sets the appointment's length, modality and price.
+type AppointmentType struct {
+	ID              uint                `gorm:"primaryKey" json:"id"`
+	OrganizationID  uint                `gorm:"index" json:"organizationId"`
+	DoctorID        uint                `gorm:"not null;index" json:"doctorId"`
+	Name            string              `gorm:"not null" json:"name"`
+	Description     string              `json:"description,omitempty"`
+	DurationMinutes int                 `gorm:"not null" json:"durationMinutes"`
+	Modality        AppointmentModality `gorm:"not null;default:video" json:"modality"`
+	Price           float64             `gorm:"not null;default:0" json:"price"`
+	IntakeFormURL   string              `json:"intakeFormUrl,omitempty"`
+	QuestionnaireID *uint               `json:"questionnaireId,omitempty"`
+	Active          bool                `gorm:"not null" json:"active"`
+	CreatedAt       time.Time           `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt       time.Time           `gorm:"autoUpdateTime" json:"updatedAt"`
+	DeletedAt       gorm.DeletedAt      `gorm:"index" json:"-"`
+}
+
+// Duration returns the length of a visit of this type
+func (t *AppointmentType) Duration() time.Duration {
+	return time.Duration(t.DurationMinutes) * time.Minute
+}
+
+// Apply books an appointment as this type: the server sets its end time,
+// modality and price
+func (t *AppointmentType) Apply(appointment *Appointment) {
+	appointment.AppointmentTypeID = &t.ID
+	appointment.EndTime = appointment.StartTime.Add(t.Duration())
+	appointment.Modality = t.Modality
+	appointment.Price = t.Price
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+)
+
+// ExceptionDateFormat is the layout of AvailabilityException.Date
+const ExceptionDateFormat = "2006-01-02"
+
+// AvailabilityRule is a recurring weekly working window for a doctor.
+// Times are wall-clock HH:MM in the doctor's own time zone.
+type AvailabilityRule struct {
+	ID             uint         `gorm:"primaryKey" json:"id"`
+	OrganizationID uint         `gorm:"index" json:"organizationId"`
+	DoctorID       uint         `gorm:"not null;index" json:"doctorId"`
+	Weekday        time.Weekday `gorm:"not null" json:"weekday"`
+	StartTime      string       `gorm:"not null" json:"startTime"`
+	EndTime        string       `gorm:"not null" json:"endTime"`
+	CreatedAt      time.Time    `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt      time.Time    `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// AvailabilityException changes a doctor's hours on one date. Available
+// exceptions add a window; unavailable ones remove a window, or the whole
+// day when no times are given.
+type AvailabilityException struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	OrganizationID uint      `gorm:"index" json:"organizationId"`
+	DoctorID       uint      `gorm:"not null;index:idx_availability_exception_doctor_date" json:"doctorId"`
+	Date           string    `gorm:"not null;index:idx_availability_exception_doctor_date" json:"date"`
+	Available      bool      `gorm:"not null;default:false" json:"available"`
+	StartTime      string    `json:"startTime,omitempty"`
+	EndTime        string    `json:"endTime,omitempty"`
+	Reason         string    `json:"reason,omitempty"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// IsWholeDay reports whether the exception covers the entire date
+func (e *AvailabilityException) IsWholeDay() bool {
+	return e.StartTime == "" && e.EndTime == ""
+}
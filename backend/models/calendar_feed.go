@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// CalendarFeed is a user's secret iCalendar subscription link. Anyone with the
+// token can read the feed, so it can be rotated to revoke old links.
+type CalendarFeed struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex" json:"userId"`
+	User      User      `gorm:"foreignKey:UserID" json:"-"`
+	Token     string    `gorm:"not null;uniqueIndex" json:"-"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
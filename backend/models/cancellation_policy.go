@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+)
+
+// CancellationPolicy decides how much of a payment is refunded when an
+// appointment is cancelled. A policy with no DoctorID applies to the whole
+// organization; a doctor's own policy overrides it.
+type CancellationPolicy struct {
+	ID             uint `gorm:"primaryKey" json:"id"`
+	OrganizationID uint `gorm:"not null;uniqueIndex:idx_cancellation_policy_scope" json:"organizationId"`
+	DoctorID       uint `gorm:"not null;default:0;uniqueIndex:idx_cancellation_policy_scope" json:"doctorId,omitempty"`
+	// FullRefundHours is how long before the start a patient can cancel for a full refund
+	FullRefundHours int `gorm:"not null" json:"fullRefundHours"`
+	// PartialRefundPercent is refunded when a patient cancels later than that
+	PartialRefundPercent int       `gorm:"not null" json:"partialRefundPercent"`
+	CreatedAt            time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt            time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// Source reports where the policy comes from: "doctor", "organization" or "default"
+func (p *CancellationPolicy) Source() string {
+	switch {
+	case p.ID == 0:
+		return "default"
+	case p.DoctorID != 0:
+		return "doctor"
+	}
+	return "organization"
+}
+
+// RefundPercent returns the percentage of the payment refunded when an
+// appointment starting at start is cancelled at cancelledAt. Cancellations by
+// the doctor, the clinic or the system (when the doctor missed the video call)
+// are always refunded in full. No-shows are never refunded, and neither is a
+// patient cancelling once the appointment has started, which is the same miss.
+func (p *CancellationPolicy) RefundPercent(start, cancelledAt time.Time, cancelledBy UserRole) int {
+	if cancelledBy == RoleDoctor || cancelledBy == RoleAdmin || cancelledBy == RoleSystem {
+		return 100
+	}
+	if !cancelledAt.Before(start) {
+		return 0
+	}
+	if start.Sub(cancelledAt) >= time.Duration(p.FullRefundHours)*time.Hour {
+		return 100
+	}
+	return p.PartialRefundPercent
+}
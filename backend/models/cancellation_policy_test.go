@@ -0,0 +1,44 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCancellationPolicyRefundPercent(t *testing.T) {
+	policy := CancellationPolicy{FullRefundHours: 24, PartialRefundPercent: 50}
+	start := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		cancelledAt time.Time
+		cancelledBy UserRole
+		want        int
+	}{
+		{"patient well ahead", start.Add(-48 * time.Hour), RolePatient, 100},
+		{"patient exactly at the cutoff", start.Add(-24 * time.Hour), RolePatient, 100},
+		{"patient just after the cutoff", start.Add(-24*time.Hour + time.Minute), RolePatient, 50},
+		{"patient just before the start", start.Add(-time.Minute), RolePatient, 50},
+		{"patient at the start", start, RolePatient, 0},
+		{"patient after the start", start.Add(time.Hour), RolePatient, 0},
+		{"doctor at the last minute", start.Add(-time.Minute), RoleDoctor, 100},
+		{"admin at the last minute", start.Add(-time.Minute), RoleAdmin, 100},
+		{"system after a missed call", start.Add(20 * time.Minute), RoleSystem, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.RefundPercent(start, tt.cancelledAt, tt.cancelledBy); got != tt.want {
+				t.Errorf("RefundPercent() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCancellationPolicyRefundPercentWithoutPartialRefund(t *testing.T) {
+	policy := CancellationPolicy{FullRefundHours: 48, PartialRefundPercent: 0}
+	start := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+
+	if got := policy.RefundPercent(start, start.Add(-time.Hour), RolePatient); got != 0 {
+		t.Errorf("RefundPercent() = %d, want 0", got)
+	}
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// DataExportStatus represents the status of a data export job
+type DataExportStatus string
+
+const (
+	ExportStatusPending    DataExportStatus = "pending"
+	ExportStatusProcessing DataExportStatus = "processing"
+	ExportStatusReady      DataExportStatus = "ready"
+	ExportStatusFailed     DataExportStatus = "failed"
+	ExportStatusExpired    DataExportStatus = "expired"
+)
+
+// DataExport represents a patient's request for a copy of their data
+type DataExport struct {
+	ID          uint             `gorm:"primaryKey" json:"id"`
+	UserID      uint             `gorm:"not null;index" json:"userId"`
+	Status      DataExportStatus `gorm:"not null;default:pending" json:"status"`
+	FilePath    string           `json:"-"`
+	Token       string           `gorm:"index" json:"-"`
+	Error       string           `json:"error,omitempty"`
+	CompletedAt *time.Time       `json:"completedAt,omitempty"`
+	ExpiresAt   *time.Time       `json:"expiresAt,omitempty"`
+	CreatedAt   time.Time        `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt   time.Time        `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// IsExpired reports whether the download link has expired
+func (e *DataExport) IsExpired() bool {
+	return e.ExpiresAt != nil && time.Now().After(*e.ExpiresAt)
+}
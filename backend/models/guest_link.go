@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// GuestLinkLeadTime is how long before the start a guest may join the call
+const GuestLinkLeadTime = 15 * time.Minute
+
+// MaxGuestPINAttempts is how many wrong PINs revoke a guest link
+const MaxGuestPINAttempts = 5
+
+// GuestLink lets someone without an account join one appointment's video
+// room under a display name. Anyone with the token can use it, so it only
+// works around the appointment's time, can require a PIN and can be revoked.
+type GuestLink struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	OrganizationID uint       `gorm:"index" json:"organizationId"`
+	AppointmentID  uint       `gorm:"not null;index" json:"appointmentId"`
+	Token          string     `gorm:"not null;uniqueIndex" json:"-"`
+	DisplayName    string     `gorm:"not null" json:"displayName"`
+	PINHash        string     `json:"-"`
+	FailedAttempts int        `gorm:"not null;default:0" json:"-"`
+	CreatedByID    uint       `gorm:"not null" json:"createdById"`
+	RevokedAt      *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// SetPIN stores a hash of the PIN guests must enter; an empty PIN removes it
+func (l *GuestLink) SetPIN(pin string) error {
+	if pin == "" {
+		l.PINHash = ""
+		return nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	l.PINHash = string(hash)
+	return nil
+}
+
+// HasPIN reports whether guests must enter a PIN
+func (l *GuestLink) HasPIN() bool {
+	return l.PINHash != ""
+}
+
+// CheckPIN reports whether the PIN matches, or whether the link needs none
+func (l *GuestLink) CheckPIN(pin string) bool {
+	if !l.HasPIN() {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(l.PINHash), []byte(pin)) == nil
+}
+
+// IsOpen reports whether the link can be used now: it has not been revoked or
+// locked by wrong PINs, and the appointment is about to start, under way, or
+// not yet past its end
+func (l *GuestLink) IsOpen(appointment *Appointment, now time.Time) bool {
+	if l.RevokedAt != nil || l.FailedAttempts >= MaxGuestPINAttempts || now.Before(appointment.StartTime.Add(-GuestLinkLeadTime)) {
+		return false
+	}
+	switch appointment.Status {
+	case StatusInProgress:
+		return true
+	case StatusScheduled:
+		return now.Before(appointment.EndTime)
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+)
+
+// NotificationChannel represents the channel a notification was sent on
+type NotificationChannel string
+
+const (
+	ChannelEmail NotificationChannel = "email"
+	ChannelSMS   NotificationChannel = "sms"
+)
+
+// NotificationLog records every notification sent to a user
+type NotificationLog struct {
+	ID        uint                `gorm:"primaryKey" json:"id"`
+	UserID    uint                `gorm:"not null;index" json:"userId"`
+	Type      string              `gorm:"not null" json:"type"`
+	Channel   NotificationChannel `gorm:"not null" json:"channel"`
+	Recipient string              `gorm:"not null" json:"recipient"`
+	Subject   string              `json:"subject,omitempty"`
+	Status    string              `gorm:"not null" json:"status"`
+	Error     string              `json:"error,omitempty"`
+	CreatedAt time.Time           `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// PendingNotification is a rendered notification held back until the
+// recipient's quiet hours end
+type PendingNotification struct {
+	ID        uint                `gorm:"primaryKey" json:"id"`
+	UserID    uint                `gorm:"not null;index" json:"userId"`
+	Type      string              `gorm:"not null" json:"type"`
+	Channel   NotificationChannel `gorm:"not null" json:"channel"`
+	Recipient string              `gorm:"type:text;serializer:encrypted" json:"-"`
+	Subject   string              `json:"subject,omitempty"`
+	Body      string              `gorm:"type:text;serializer:encrypted" json:"-"`
+	Invite    string              `gorm:"type:text;serializer:encrypted" json:"-"`
+	SendAfter time.Time           `gorm:"not null;index" json:"sendAfter"`
+	CreatedAt time.Time           `gorm:"autoCreateTime" json:"createdAt"`
+}
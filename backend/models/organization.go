@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultOrganizationSlug identifies the organization existing data is migrated into
+const DefaultOrganizationSlug = "default"
+
+// Organization represents a clinic hosted on the platform
+type Organization struct {
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	Name           string         `gorm:"not null" json:"name"`
+	Slug           string         `gorm:"uniqueIndex;not null" json:"slug"`
+	LogoURL        string         `json:"logoUrl,omitempty"`
+	PrimaryColor   string         `gorm:"default:#2563eb" json:"primaryColor"`
+	SupportEmail   string         `json:"supportEmail,omitempty"`
+	PaymentEnabled bool           `gorm:"default:false" json:"paymentEnabled"`
+	Currency       string         `gorm:"not null;default:USD" json:"currency"`
+	EversendAPIKey string         `gorm:"type:text;serializer:encrypted" json:"-"`
+	CreatedAt      time.Time      `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt      time.Time      `gorm:"autoUpdateTime" json:"updatedAt"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// OrganizationMembership links a user to an organization with a role in that organization
+type OrganizationMembership struct {
+	ID             uint         `gorm:"primaryKey" json:"id"`
+	OrganizationID uint         `gorm:"not null;uniqueIndex:idx_membership_org_user" json:"organizationId"`
+	Organization   Organization `gorm:"foreignKey:OrganizationID" json:"organization"`
+	UserID         uint         `gorm:"not null;uniqueIndex:idx_membership_org_user;index" json:"userId"`
+	User           User         `gorm:"foreignKey:UserID" json:"user"`
+	Role           UserRole     `gorm:"not null;default:patient" json:"role"`
+	CreatedAt      time.Time    `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt      time.Time    `gorm:"autoUpdateTime" json:"updatedAt"`
+}
@@ -9,6 +9,7 @@ import (
 // Payment represents a payment for an appointment
 type Payment struct {
 	ID           uint           `gorm:"primaryKey" json:"id"`
+	OrganizationID uint         `gorm:"index" json:"organizationId"`
 	AppointmentID uint          `gorm:"not null" json:"appointmentId"`
 	Appointment  Appointment    `gorm:"foreignKey:AppointmentID" json:"appointment"`
 	Amount       float64        `gorm:"not null" json:"amount"`
@@ -16,6 +17,11 @@ type Payment struct {
 	PaymentID    string         `gorm:"not null" json:"paymentId"`
 	PaymentURL   string         `json:"paymentUrl,omitempty"`
 	PaymentMethod string        `gorm:"not null;default:card" json:"paymentMethod"`
+	RefundedAmount float64      `gorm:"not null;default:0" json:"refundedAmount"`
+	// RefundDue is the amount a pending refund will return
+	RefundDue    float64        `gorm:"not null;default:0" json:"refundDue,omitempty"`
+	RefundReason string         `json:"refundReason,omitempty"`
+	RefundAttemptedAt *time.Time `gorm:"index" json:"-"`
 	CreatedAt    time.Time      `gorm:"autoCreateTime" json:"createdAt"`
 	UpdatedAt    time.Time      `gorm:"autoUpdateTime" json:"updatedAt"`
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
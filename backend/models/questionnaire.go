@@ -0,0 +1,269 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// QuestionType is the kind of answer a question takes
+type QuestionType string
+
+const (
+	// QuestionText takes free text
+	QuestionText QuestionType = "text"
+
+	// QuestionNumber takes a number
+	QuestionNumber QuestionType = "number"
+
+	// QuestionBoolean takes yes or no, such as a consent
+	QuestionBoolean QuestionType = "boolean"
+
+	// QuestionDate takes a YYYY-MM-DD date
+	QuestionDate QuestionType = "date"
+
+	// QuestionSingleChoice takes one of the options
+	QuestionSingleChoice QuestionType = "single_choice"
+
+	// QuestionMultiChoice takes any number of the options
+	QuestionMultiChoice QuestionType = "multi_choice"
+)
+
+const (
+	// MaxQuestions caps the questions in one questionnaire
+	MaxQuestions = 100
+
+	// maxTextAnswer caps the length of a text answer
+	maxTextAnswer = 2000
+)
+
+// QuestionCondition shows a question only when an earlier question's answer
+// is one of the given values. Booleans match "true" or "false", and a
+// multiple-choice answer matches if any chosen option is listed.
+type QuestionCondition struct {
+	QuestionID string   `json:"questionId"`
+	Equals     []string `json:"equals"`
+}
+
+// Question is one typed question in a questionnaire
+type Question struct {
+	ID       string             `json:"id"`
+	Type     QuestionType       `json:"type"`
+	Label    string             `json:"label"`
+	Required bool               `json:"required"`
+	Options  []string           `json:"options,omitempty"`
+	ShowIf   *QuestionCondition `json:"showIf,omitempty"`
+}
+
+// Questionnaire is an intake form that doctors or admins attach to appointment
+// types. A questionnaire with no DoctorID is shared across the organization.
+// Editing the questions adds a version, so earlier answers keep the questions
+// they were given against.
+type Questionnaire struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	OrganizationID uint      `gorm:"index" json:"organizationId"`
+	DoctorID       uint      `gorm:"not null;default:0;index" json:"doctorId,omitempty"`
+	Name           string    `gorm:"not null" json:"name"`
+	CurrentVersion int       `gorm:"not null" json:"currentVersion"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// QuestionnaireVersion is the questions of a questionnaire as of one edit
+type QuestionnaireVersion struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	OrganizationID  uint       `gorm:"index" json:"organizationId"`
+	QuestionnaireID uint       `gorm:"not null;uniqueIndex:idx_questionnaire_version" json:"questionnaireId"`
+	Version         int        `gorm:"not null;uniqueIndex:idx_questionnaire_version" json:"version"`
+	Questions       []Question `gorm:"type:text;serializer:json" json:"questions"`
+	CreatedBy       uint       `gorm:"not null" json:"createdBy"`
+	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// IntakeResponse is a patient's answers for one appointment. Answers are
+// health information and stored encrypted.
+type IntakeResponse struct {
+	ID                     uint                   `gorm:"primaryKey" json:"id"`
+	OrganizationID         uint                   `gorm:"index" json:"organizationId"`
+	AppointmentID          uint                   `gorm:"not null;uniqueIndex" json:"appointmentId"`
+	PatientID              uint                   `gorm:"not null;index" json:"patientId"`
+	QuestionnaireVersionID uint                   `gorm:"not null" json:"questionnaireVersionId"`
+	QuestionnaireVersion   QuestionnaireVersion   `gorm:"foreignKey:QuestionnaireVersionID" json:"questionnaire"`
+	Answers                map[string]interface{} `gorm:"type:text;serializer:encrypted" json:"answers"`
+	CreatedAt              time.Time              `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt              time.Time              `gorm:"autoUpdateTime" json:"submittedAt"`
+}
+
+// ValidateQuestions checks a questionnaire's schema and returns problems keyed by question ID
+func ValidateQuestions(questions []Question) map[string]string {
+	problems := make(map[string]string)
+	if len(questions) == 0 || len(questions) > MaxQuestions {
+		problems["questions"] = fmt.Sprintf("must have between 1 and %d questions", MaxQuestions)
+		return problems
+	}
+
+	seen := make(map[string]*Question)
+	for i := range questions {
+		question := &questions[i]
+		key := question.ID
+		if key == "" {
+			key = "questions[" + strconv.Itoa(i) + "]"
+		}
+
+		switch {
+		case question.ID == "" || len(question.ID) > 64:
+			problems[key] = "id is required and at most 64 characters"
+		case seen[question.ID] != nil:
+			problems[key] = "id is used by more than one question"
+		case question.Label == "" || len(question.Label) > 500:
+			problems[key] = "label is required and at most 500 characters"
+		case !question.Type.valid():
+			problems[key] = "type must be text, number, boolean, date, single_choice or multi_choice"
+		case question.Type.hasOptions() && len(question.Options) < 2:
+			problems[key] = "choice questions need at least two options"
+		case !question.Type.hasOptions() && len(question.Options) > 0:
+			problems[key] = "only choice questions have options"
+		case question.ShowIf != nil && seen[question.ShowIf.QuestionID] == nil:
+			problems[key] = "showIf must refer to an earlier question"
+		case question.ShowIf != nil && len(question.ShowIf.Equals) == 0:
+			problems[key] = "showIf needs at least one value"
+		}
+		if question.ID != "" && seen[question.ID] == nil {
+			seen[question.ID] = question
+		}
+	}
+	return problems
+}
+
+// Validate checks answers against the questions and returns the answers to
+// keep along with problems keyed by question ID. Answers to questions hidden
+// by their conditions are dropped.
+func (v *QuestionnaireVersion) Validate(answers map[string]interface{}) (map[string]interface{}, map[string]string) {
+	kept := make(map[string]interface{})
+	problems := make(map[string]string)
+
+	known := make(map[string]bool, len(v.Questions))
+	for _, question := range v.Questions {
+		known[question.ID] = true
+	}
+	for id := range answers {
+		if !known[id] {
+			problems[id] = "is not a question in this questionnaire"
+		}
+	}
+
+	for _, question := range v.Questions {
+		if question.ShowIf != nil && !question.ShowIf.matches(kept[question.ShowIf.QuestionID]) {
+			continue
+		}
+
+		answer, given := answers[question.ID]
+		if !given || answer == nil || answer == "" {
+			if question.Required {
+				problems[question.ID] = "is required"
+			}
+			continue
+		}
+		if problem := question.check(answer); problem != "" {
+			problems[question.ID] = problem
+			continue
+		}
+		kept[question.ID] = answer
+	}
+	return kept, problems
+}
+
+// check returns a problem with an answer, or "" if it fits the question
+func (q *Question) check(answer interface{}) string {
+	switch q.Type {
+	case QuestionText:
+		text, ok := answer.(string)
+		if !ok || len(text) > maxTextAnswer {
+			return fmt.Sprintf("must be text of at most %d characters", maxTextAnswer)
+		}
+	case QuestionNumber:
+		if _, ok := answer.(float64); !ok {
+			return "must be a number"
+		}
+	case QuestionBoolean:
+		if _, ok := answer.(bool); !ok {
+			return "must be true or false"
+		}
+	case QuestionDate:
+		text, ok := answer.(string)
+		if _, err := time.Parse(ExceptionDateFormat, text); !ok || err != nil {
+			return "must be a date (YYYY-MM-DD)"
+		}
+	case QuestionSingleChoice:
+		choice, ok := answer.(string)
+		if !ok || !q.hasOption(choice) {
+			return "must be one of the options"
+		}
+	case QuestionMultiChoice:
+		choices, ok := answer.([]interface{})
+		if !ok {
+			return "must be a list of options"
+		}
+		for _, item := range choices {
+			choice, ok := item.(string)
+			if !ok || !q.hasOption(choice) {
+				return "must only contain the options"
+			}
+		}
+		if q.Required && len(choices) == 0 {
+			return "is required"
+		}
+	}
+	return ""
+}
+
+// hasOption reports whether value is one of the question's options
+func (q *Question) hasOption(value string) bool {
+	for _, option := range q.Options {
+		if option == value {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether an answer shows the question the condition is on
+func (qc *QuestionCondition) matches(answer interface{}) bool {
+	var values []string
+	switch v := answer.(type) {
+	case nil:
+		return false
+	case string:
+		values = []string{v}
+	case bool:
+		values = []string{strconv.FormatBool(v)}
+	case float64:
+		values = []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case []interface{}:
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
+		}
+	}
+	for _, value := range values {
+		for _, expected := range qc.Equals {
+			if value == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// valid reports whether the type is one of the known question types
+func (t QuestionType) valid() bool {
+	switch t {
+	case QuestionText, QuestionNumber, QuestionBoolean, QuestionDate, QuestionSingleChoice, QuestionMultiChoice:
+		return true
+	}
+	return false
+}
+
+// hasOptions reports whether questions of the type are answered from options
+func (t QuestionType) hasOptions() bool {
+	return t == QuestionSingleChoice || t == QuestionMultiChoice
+}
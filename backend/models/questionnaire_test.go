@@ -0,0 +1,90 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+// intakeVersion is a questionnaire whose follow-up questions depend on
+// earlier answers
+func intakeVersion() *QuestionnaireVersion {
+	return &QuestionnaireVersion{Questions: []Question{
+		{ID: "smoker", Type: QuestionBoolean, Label: "Do you smoke?", Required: true},
+		{ID: "perDay", Type: QuestionNumber, Label: "Cigarettes per day", Required: true,
+			ShowIf: &QuestionCondition{QuestionID: "smoker", Equals: []string{"true"}}},
+		{ID: "symptoms", Type: QuestionMultiChoice, Label: "Symptoms", Options: []string{"cough", "fever", "pain"}},
+		{ID: "painArea", Type: QuestionText, Label: "Where is the pain?", Required: true,
+			ShowIf: &QuestionCondition{QuestionID: "symptoms", Equals: []string{"pain"}}},
+		{ID: "followUp", Type: QuestionSingleChoice, Label: "Follow up by", Options: []string{"call", "email"},
+			ShowIf: &QuestionCondition{QuestionID: "perDay", Equals: []string{"20"}}},
+	}}
+}
+
+func TestQuestionnaireVersionValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		answers  map[string]interface{}
+		kept     map[string]interface{}
+		problems map[string]string
+	}{
+		{
+			name:     "shown question is required",
+			answers:  map[string]interface{}{"smoker": true},
+			kept:     map[string]interface{}{"smoker": true},
+			problems: map[string]string{"perDay": "is required"},
+		},
+		{
+			name:     "hidden question is not required",
+			answers:  map[string]interface{}{"smoker": false},
+			kept:     map[string]interface{}{"smoker": false},
+			problems: map[string]string{},
+		},
+		{
+			name:     "answer to a hidden question is dropped",
+			answers:  map[string]interface{}{"smoker": false, "perDay": float64(5)},
+			kept:     map[string]interface{}{"smoker": false},
+			problems: map[string]string{},
+		},
+		{
+			name:     "multiple choice shows a question when any option matches",
+			answers:  map[string]interface{}{"smoker": false, "symptoms": []interface{}{"cough", "pain"}},
+			kept:     map[string]interface{}{"smoker": false, "symptoms": []interface{}{"cough", "pain"}},
+			problems: map[string]string{"painArea": "is required"},
+		},
+		{
+			name:     "number condition",
+			answers:  map[string]interface{}{"smoker": true, "perDay": float64(20), "followUp": "call"},
+			kept:     map[string]interface{}{"smoker": true, "perDay": float64(20), "followUp": "call"},
+			problems: map[string]string{},
+		},
+		{
+			name:     "invalid answer hides the questions that depend on it",
+			answers:  map[string]interface{}{"smoker": true, "perDay": "twenty", "followUp": "call"},
+			kept:     map[string]interface{}{"smoker": true},
+			problems: map[string]string{"perDay": "must be a number"},
+		},
+		{
+			name:     "unknown question",
+			answers:  map[string]interface{}{"smoker": false, "height": float64(180)},
+			kept:     map[string]interface{}{"smoker": false},
+			problems: map[string]string{"height": "is not a question in this questionnaire"},
+		},
+		{
+			name:     "option not in the list",
+			answers:  map[string]interface{}{"smoker": false, "symptoms": []interface{}{"rash"}},
+			kept:     map[string]interface{}{"smoker": false},
+			problems: map[string]string{"symptoms": "must only contain the options"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, problems := intakeVersion().Validate(tt.answers)
+			if !reflect.DeepEqual(kept, tt.kept) {
+				t.Errorf("kept = %v, want %v", kept, tt.kept)
+			}
+			if !reflect.DeepEqual(problems, tt.problems) {
+				t.Errorf("problems = %v, want %v", problems, tt.problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ReviewStatus string
+
+const (
+	ReviewStatusPublished ReviewStatus = "published"
+	ReviewStatusFlagged   ReviewStatus = "flagged"
+	ReviewStatusHidden    ReviewStatus = "hidden"
+)
+
+// Review is a patient's rating of a completed appointment
+type Review struct {
+	ID               uint           `gorm:"primaryKey" json:"id"`
+	OrganizationID   uint           `gorm:"index" json:"organizationId"`
+	AppointmentID    uint           `gorm:"not null;uniqueIndex" json:"appointmentId"`
+	PatientID        uint           `gorm:"not null;index" json:"patientId"`
+	Patient          User           `gorm:"foreignKey:PatientID" json:"patient"`
+	DoctorID         uint           `gorm:"not null;index" json:"doctorId"`
+	Doctor           User           `gorm:"foreignKey:DoctorID" json:"doctor"`
+	Rating           int            `gorm:"not null;check:rating BETWEEN 1 AND 5" json:"rating"`
+	Comment          string         `gorm:"type:text" json:"comment,omitempty"`
+	DoctorReply      string         `gorm:"type:text" json:"doctorReply,omitempty"`
+	RepliedAt        *time.Time     `json:"repliedAt,omitempty"`
+	Status           ReviewStatus   `gorm:"not null;default:published;index" json:"status"`
+	ReportCount      int            `gorm:"not null;default:0" json:"reportCount"`
+	ModeratedByID    *uint          `json:"moderatedById,omitempty"`
+	ModeratedAt      *time.Time     `json:"moderatedAt,omitempty"`
+	ModerationReason string         `json:"moderationReason,omitempty"`
+	CreatedAt        time.Time      `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt        time.Time      `gorm:"autoUpdateTime" json:"updatedAt"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// ReviewReport records a user flagging a review as abusive
+type ReviewReport struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ReviewID  uint      `gorm:"not null;uniqueIndex:idx_review_report_user" json:"reviewId"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_review_report_user" json:"userId"`
+	Reason    string    `gorm:"type:text" json:"reason,omitempty"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// IsVisible reports whether the review is shown in the doctor directory
+func (r *Review) IsVisible() bool {
+	return r.Status != ReviewStatusHidden
+}
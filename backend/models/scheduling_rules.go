@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+)
+
+// SchedulingRules limit when a doctor can be booked. Zero values switch a
+// rule off; a doctor without rules can be booked anywhere in their hours.
+type SchedulingRules struct {
+	ID             uint `gorm:"primaryKey" json:"id"`
+	OrganizationID uint `gorm:"not null;uniqueIndex:idx_scheduling_rules_doctor" json:"organizationId"`
+	DoctorID       uint `gorm:"not null;uniqueIndex:idx_scheduling_rules_doctor" json:"doctorId"`
+	// BufferBeforeMinutes and BufferAfterMinutes keep free time around each visit
+	BufferBeforeMinutes int `gorm:"not null;default:0" json:"bufferBeforeMinutes"`
+	BufferAfterMinutes  int `gorm:"not null;default:0" json:"bufferAfterMinutes"`
+	// MinLeadMinutes is how far ahead of its start an appointment must be booked
+	MinLeadMinutes int `gorm:"not null;default:0" json:"minLeadMinutes"`
+	// MaxHorizonDays is how far ahead appointments can be booked
+	MaxHorizonDays int `gorm:"not null;default:0" json:"maxHorizonDays"`
+	// MaxPerDay caps the doctor's appointments on one day in their time zone
+	MaxPerDay int       `gorm:"not null;default:0" json:"maxPerDay"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// BufferBefore returns the free time kept before each visit
+func (r *SchedulingRules) BufferBefore() time.Duration {
+	return time.Duration(r.BufferBeforeMinutes) * time.Minute
+}
+
+// BufferAfter returns the free time kept after each visit
+func (r *SchedulingRules) BufferAfter() time.Duration {
+	return time.Duration(r.BufferAfterMinutes) * time.Minute
+}
+
+// Earliest returns the first start time that can be booked at now
+func (r *SchedulingRules) Earliest(now time.Time) time.Time {
+	return now.Add(time.Duration(r.MinLeadMinutes) * time.Minute)
+}
+
+// Latest returns the last start time that can be booked at now, and false if
+// there is no limit
+func (r *SchedulingRules) Latest(now time.Time) (time.Time, bool) {
+	if r.MaxHorizonDays == 0 {
+		return time.Time{}, false
+	}
+	return now.AddDate(0, 0, r.MaxHorizonDays), true
+}
@@ -6,6 +6,8 @@ import (
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
+	
+	"github.com/adrianmcmains/telehealth-platform/encryption"
 )
 
 type UserRole string
@@ -14,6 +16,9 @@ const (
 	RolePatient  UserRole = "patient"
 	RoleDoctor   UserRole = "doctor"
 	RoleAdmin    UserRole = "admin"
+	
+	// RoleSystem marks changes made by scheduled jobs; no user has it
+	RoleSystem   UserRole = "system"
 )
 
 type User struct {
@@ -23,12 +28,14 @@ type User struct {
 	FirstName            string         `gorm:"not null" json:"firstName"`
 	LastName             string         `gorm:"not null" json:"lastName"`
 	Role                 UserRole       `gorm:"not null;default:patient" json:"role"`
-	DateOfBirth          *time.Time     `json:"dateOfBirth,omitempty"`
-	PhoneNumber          string         `json:"phoneNumber,omitempty"`
-	Address              string         `json:"address,omitempty"`
+	DateOfBirth          *time.Time     `gorm:"type:text;serializer:encrypted" json:"dateOfBirth,omitempty"`
+	PhoneNumber          string         `gorm:"type:text;serializer:encrypted" json:"phoneNumber,omitempty"`
+	PhoneNumberIndex     string         `gorm:"index" json:"-"`
+	Address              string         `gorm:"type:text;serializer:encrypted" json:"address,omitempty"`
 	TwoFactorEnabled     bool           `gorm:"default:false" json:"twoFactorEnabled"`
 	TwoFactorSecret      string         `gorm:"-" json:"-"`
 	TwoFactorSecretEncrypted string     `json:"-"`
+	AnonymizedAt         *time.Time     `json:"-"`
 	CreatedAt            time.Time      `gorm:"autoCreateTime" json:"createdAt"`
 	UpdatedAt            time.Time      `gorm:"autoUpdateTime" json:"updatedAt"`
 	DeletedAt            gorm.DeletedAt `gorm:"index" json:"-"`
@@ -50,6 +57,12 @@ func (u *User) CheckPassword(password string) bool {
 	return err == nil
 }
 
+// BeforeSave keeps the phone number blind index in sync with the encrypted phone number
+func (u *User) BeforeSave(tx *gorm.DB) (err error) {
+	u.PhoneNumberIndex, err = encryption.BlindIndex(u.PhoneNumber)
+	return err
+}
+
 // BeforeCreate hook for additional validation or operations
 func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
 	// Validate email is not empty
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultTimeZone and DefaultLanguage apply to users who have not set preferences
+const (
+	DefaultTimeZone = "UTC"
+	DefaultLanguage = "en"
+)
+
+// UserPreferences holds how and when a user wants to be contacted
+type UserPreferences struct {
+	ID       uint   `gorm:"primaryKey" json:"-"`
+	UserID   uint   `gorm:"not null;uniqueIndex" json:"userId"`
+	TimeZone string `gorm:"not null;default:UTC" json:"timeZone"`
+	Language string `gorm:"not null;default:en" json:"language"`
+	// Channels maps a notification type to the channels it may be sent on.
+	// Types that are not listed are sent on every channel.
+	Channels        map[string][]NotificationChannel `gorm:"type:text;serializer:json" json:"channels"`
+	QuietHoursStart string                           `json:"quietHoursStart,omitempty"`
+	QuietHoursEnd   string                           `json:"quietHoursEnd,omitempty"`
+	CreatedAt       time.Time                        `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt       time.Time                        `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// DefaultUserPreferences returns the preferences used until a user saves their own
+func DefaultUserPreferences(userID uint) UserPreferences {
+	return UserPreferences{
+		UserID:   userID,
+		TimeZone: DefaultTimeZone,
+		Language: DefaultLanguage,
+	}
+}
+
+// Location returns the user's time zone, falling back to UTC
+func (p *UserPreferences) Location() *time.Location {
+	if p.TimeZone == "" {
+		return time.UTC
+	}
+	location, err := time.LoadLocation(p.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// AllowsChannel reports whether a notification type may be sent on a channel
+func (p *UserPreferences) AllowsChannel(notificationType string, channel NotificationChannel) bool {
+	channels, ok := p.Channels[notificationType]
+	if !ok {
+		return true
+	}
+	for _, allowed := range channels {
+		if allowed == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// QuietHoursEndAfter returns when quiet hours covering t end, or false if t is
+// outside quiet hours. Quiet hours may span midnight, e.g. 22:00 to 07:00.
+func (p *UserPreferences) QuietHoursEndAfter(t time.Time) (time.Time, bool) {
+	start, okStart := ParseClock(p.QuietHoursStart)
+	end, okEnd := ParseClock(p.QuietHoursEnd)
+	if !okStart || !okEnd || start == end {
+		return time.Time{}, false
+	}
+
+	local := t.In(p.Location())
+	minute := local.Hour()*60 + local.Minute()
+	endOn := func(days int) time.Time {
+		return time.Date(local.Year(), local.Month(), local.Day()+days, end/60, end%60, 0, 0, local.Location())
+	}
+
+	if start < end {
+		if minute >= start && minute < end {
+			return endOn(0), true
+		}
+		return time.Time{}, false
+	}
+
+	// Quiet hours wrap around midnight
+	if minute >= start {
+		return endOn(1), true
+	}
+	if minute < end {
+		return endOn(0), true
+	}
+	return time.Time{}, false
+}
+
+// ValidClock reports whether s is a 24-hour HH:MM time
+func ValidClock(s string) bool {
+	_, ok := ParseClock(s)
+	return ok
+}
+
+// ParseClock converts a 24-hour HH:MM time to minutes after midnight
+func ParseClock(s string) (int, bool) {
+	var hour, minute int
+	if len(s) != 5 {
+		return 0, false
+	}
+	if _, err := fmt.Sscanf(s, "%02d:%02d", &hour, &minute); err != nil {
+		return 0, false
+	}
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, false
+	}
+	return hour*60 + minute, true
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestUserPreferencesQuietHoursEndAfter(t *testing.T) {
+	kampala, err := time.LoadLocation("Africa/Kampala")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, 3, day, hour, minute, 0, 0, kampala)
+	}
+
+	overnight := UserPreferences{TimeZone: "Africa/Kampala", QuietHoursStart: "22:00", QuietHoursEnd: "07:00"}
+	daytime := UserPreferences{TimeZone: "Africa/Kampala", QuietHoursStart: "12:00", QuietHoursEnd: "14:30"}
+
+	tests := []struct {
+		name   string
+		prefs  UserPreferences
+		t      time.Time
+		want   time.Time
+		wantOK bool
+	}{
+		{"overnight before start", overnight, at(10, 21, 59), time.Time{}, false},
+		{"overnight at start", overnight, at(10, 22, 0), at(11, 7, 0), true},
+		{"overnight before midnight", overnight, at(10, 23, 30), at(11, 7, 0), true},
+		{"overnight after midnight", overnight, at(11, 0, 15), at(11, 7, 0), true},
+		{"overnight at end", overnight, at(11, 7, 0), time.Time{}, false},
+		{"overnight across month end", overnight, at(31, 23, 0), time.Date(2025, 4, 1, 7, 0, 0, 0, kampala), true},
+		{"overnight from a UTC time", overnight, time.Date(2025, 3, 10, 20, 0, 0, 0, time.UTC), at(11, 7, 0), true},
+		{"daytime inside", daytime, at(10, 13, 0), at(10, 14, 30), true},
+		{"daytime outside", daytime, at(10, 15, 0), time.Time{}, false},
+		{"not set", UserPreferences{TimeZone: "Africa/Kampala"}, at(10, 23, 0), time.Time{}, false},
+		{"same start and end", UserPreferences{QuietHoursStart: "22:00", QuietHoursEnd: "22:00"}, at(10, 22, 0), time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.prefs.QuietHoursEndAfter(tt.t)
+			if ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Errorf("QuietHoursEndAfter(%v) = %v, %v, want %v, %v", tt.t, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
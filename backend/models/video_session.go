@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// VideoSessionEventType is what happened in an appointment's video room
+type VideoSessionEventType string
+
+const (
+	// VideoSessionJoined means a participant connected to the room
+	VideoSessionJoined VideoSessionEventType = "joined"
+
+	// VideoSessionLeft means a participant's connection closed
+	VideoSessionLeft VideoSessionEventType = "left"
+)
+
+// VideoSessionEvent records a participant joining or leaving an appointment's
+// video room. The events show who attended, which decides whether an
+// appointment is completed or a no-show.
+type VideoSessionEvent struct {
+	ID             uint                  `gorm:"primaryKey" json:"id"`
+	OrganizationID uint                  `gorm:"index" json:"organizationId"`
+	AppointmentID  uint                  `gorm:"not null;index" json:"appointmentId"`
+	UserID         uint                  `gorm:"not null" json:"userId"`
+	Type           VideoSessionEventType `gorm:"not null" json:"type"`
+	CreatedAt      time.Time             `gorm:"autoCreateTime" json:"createdAt"`
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"time"
+)
+
+// WaitlistStatus represents where a patient is on a doctor's waitlist
+type WaitlistStatus string
+
+const (
+	// WaitlistStatusWaiting means the patient is waiting for a slot
+	WaitlistStatusWaiting WaitlistStatus = "waiting"
+
+	// WaitlistStatusOffered means the patient holds an unclaimed offer
+	WaitlistStatusOffered WaitlistStatus = "offered"
+
+	// WaitlistStatusBooked means the patient claimed a slot
+	WaitlistStatusBooked WaitlistStatus = "booked"
+
+	// WaitlistStatusCancelled means the patient left the waitlist
+	WaitlistStatusCancelled WaitlistStatus = "cancelled"
+
+	// WaitlistStatusExpired means the preferred dates passed without a slot
+	WaitlistStatusExpired WaitlistStatus = "expired"
+)
+
+// WaitlistEntry is a patient waiting for a slot with a doctor between two dates.
+// Dates are YYYY-MM-DD in the doctor's time zone and both are included.
+type WaitlistEntry struct {
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	OrganizationID uint           `gorm:"index" json:"organizationId"`
+	DoctorID       uint           `gorm:"not null;index:idx_waitlist_doctor_status" json:"doctorId"`
+	Doctor         User           `gorm:"foreignKey:DoctorID" json:"doctor"`
+	PatientID      uint           `gorm:"not null;index" json:"patientId"`
+	Patient        User           `gorm:"foreignKey:PatientID" json:"patient"`
+	FromDate       string         `gorm:"not null" json:"fromDate"`
+	ToDate         string         `gorm:"not null" json:"toDate"`
+	Reason         string         `gorm:"type:text;serializer:encrypted" json:"reason"`
+	Status         WaitlistStatus `gorm:"not null;default:waiting;index:idx_waitlist_doctor_status" json:"status"`
+	AppointmentID  *uint          `json:"appointmentId,omitempty"`
+	CreatedAt      time.Time      `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt      time.Time      `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// WaitlistOfferStatus represents the state of a slot offered from the waitlist
+type WaitlistOfferStatus string
+
+const (
+	// OfferStatusPending means the patient can still claim the slot
+	OfferStatusPending WaitlistOfferStatus = "pending"
+
+	// OfferStatusClaimed means the patient booked the slot
+	OfferStatusClaimed WaitlistOfferStatus = "claimed"
+
+	// OfferStatusDeclined means the patient turned the slot down
+	OfferStatusDeclined WaitlistOfferStatus = "declined"
+
+	// OfferStatusExpired means the claim window passed or the slot was taken
+	OfferStatusExpired WaitlistOfferStatus = "expired"
+)
+
+// WaitlistOffer is a freed slot offered to one waitlisted patient through a
+// claim link that stops working at ExpiresAt. It keeps the visit type,
+// modality and price of the appointment that freed the slot.
+type WaitlistOffer struct {
+	ID                uint                `gorm:"primaryKey" json:"id"`
+	OrganizationID    uint                `gorm:"index" json:"organizationId"`
+	EntryID           uint                `gorm:"not null;index" json:"entryId"`
+	Entry             WaitlistEntry       `gorm:"foreignKey:EntryID" json:"-"`
+	DoctorID          uint                `gorm:"not null;index:idx_waitlist_offer_slot" json:"doctorId"`
+	PatientID         uint                `gorm:"not null;index" json:"patientId"`
+	StartTime         time.Time           `gorm:"not null;index:idx_waitlist_offer_slot" json:"startTime"`
+	EndTime           time.Time           `gorm:"not null" json:"endTime"`
+	AppointmentTypeID *uint               `json:"appointmentTypeId,omitempty"`
+	Modality          AppointmentModality `gorm:"not null;default:video" json:"modality"`
+	Price             float64             `gorm:"default:0" json:"price"`
+	Token             string              `gorm:"not null;uniqueIndex" json:"-"`
+	Status            WaitlistOfferStatus `gorm:"not null;default:pending;index" json:"status"`
+	ExpiresAt         time.Time           `gorm:"not null" json:"expiresAt"`
+	AppointmentID     *uint               `json:"appointmentId,omitempty"`
+	CreatedAt         time.Time           `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt         time.Time           `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// IsExpired reports whether the claim window has passed
+func (o *WaitlistOffer) IsExpired() bool {
+	return time.Now().After(o.ExpiresAt)
+}
@@ -10,10 +10,14 @@ import (
 // SetupAppointmentRoutes configures the appointment routes
 func SetupAppointmentRoutes(router *gin.RouterGroup) {
 	appointmentController := controllers.NewAppointmentController()
+	seriesController := controllers.NewAppointmentSeriesController()
+	calendarController := controllers.NewCalendarController()
+	questionnaireController := controllers.NewQuestionnaireController()
+	participantController := controllers.NewParticipantController()
 	
-	// All appointment routes require authentication
+	// All appointment routes require authentication and are scoped to an organization
 	appointmentRoutes := router.Group("/appointments")
-	appointmentRoutes.Use(middleware.AuthMiddleware())
+	appointmentRoutes.Use(middleware.AuthMiddleware(), middleware.OrganizationMiddleware())
 	{
 		// Create a new appointment
 		appointmentRoutes.POST("", appointmentController.CreateAppointment)
@@ -24,6 +28,43 @@ func SetupAppointmentRoutes(router *gin.RouterGroup) {
 		// Update appointment
 		appointmentRoutes.PUT("/:id", appointmentController.UpdateAppointment)
 		
+		// Partially update appointment (JSON Merge Patch)
+		appointmentRoutes.PATCH("/:id", appointmentController.PatchAppointment)
+		
+		// Change status through the lifecycle rules, and view the history
+		appointmentRoutes.POST("/:id/transitions", appointmentController.TransitionAppointment)
+		appointmentRoutes.GET("/:id/transitions", appointmentController.ListAppointmentTransitions)
+		
+		// Move to a new time slot, and view previous times
+		appointmentRoutes.POST("/:id/reschedule", appointmentController.RescheduleAppointment)
+		appointmentRoutes.GET("/:id/reschedules", appointmentController.ListAppointmentReschedules)
+		
+		// Full change history: who changed what, and when
+		appointmentRoutes.GET("/:id/history", appointmentController.ListAppointmentHistory)
+		
+		// Interpreters, caregivers and other clinicians invited to the appointment
+		appointmentRoutes.GET("/:id/participants", participantController.ListParticipants)
+		appointmentRoutes.POST("/:id/participants", participantController.InviteParticipant)
+		appointmentRoutes.DELETE("/:id/participants/:participantId", participantController.RemoveParticipant)
+		
+		// Links for guests without an account to join the video call
+		appointmentRoutes.GET("/:id/guest-links", participantController.ListGuestLinks)
+		appointmentRoutes.POST("/:id/guest-links", participantController.CreateGuestLink)
+		appointmentRoutes.DELETE("/:id/guest-links/:linkId", participantController.RevokeGuestLink)
+		
+		// Recurring series: book, view, and cancel or move one occurrence or all that follow
+		appointmentRoutes.POST("/series", seriesController.CreateSeries)
+		appointmentRoutes.GET("/series/:seriesId", seriesController.GetSeries)
+		appointmentRoutes.POST("/:id/series/cancel", seriesController.CancelOccurrences)
+		appointmentRoutes.POST("/:id/series/reschedule", seriesController.RescheduleOccurrences)
+		
+		// Download as an iCalendar file
+		appointmentRoutes.GET("/:id/calendar.ics", calendarController.DownloadAppointment)
+		
+		// Intake questionnaire from the appointment type, and the patient's answers
+		appointmentRoutes.GET("/:id/intake", questionnaireController.GetIntake)
+		appointmentRoutes.PUT("/:id/intake", questionnaireController.SubmitIntake)
+		
 		// List user's appointments
 		appointmentRoutes.GET("", appointmentController.ListUserAppointments)
 	}
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/adrianmcmains/telehealth-platform/controllers"
+)
+
+// SetupCalendarRoutes configures the calendar feed routes
+func SetupCalendarRoutes(router *gin.RouterGroup) {
+	calendarController := controllers.NewCalendarController()
+
+	// Feeds are fetched by calendar apps, which authenticate with the secret token in the URL
+	calendarRoutes := router.Group("/calendar")
+	{
+		calendarRoutes.GET("/:token", calendarController.GetFeed)
+	}
+}
@@ -0,0 +1,44 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/adrianmcmains/telehealth-platform/controllers"
+	"github.com/adrianmcmains/telehealth-platform/middleware"
+)
+
+// SetupDoctorRoutes configures the doctor availability and scheduling routes
+func SetupDoctorRoutes(router *gin.RouterGroup) {
+	availabilityController := controllers.NewAvailabilityController()
+	cancellationPolicyController := controllers.NewCancellationPolicyController()
+	appointmentTypeController := controllers.NewAppointmentTypeController()
+
+	// All doctor routes require authentication and are scoped to an organization
+	doctorRoutes := router.Group("/doctors")
+	doctorRoutes.Use(middleware.AuthMiddleware(), middleware.OrganizationMiddleware())
+	{
+		// Weekly hours and date exceptions
+		doctorRoutes.GET("/:id/availability", availabilityController.GetAvailability)
+		doctorRoutes.PUT("/:id/availability/weekly", availabilityController.UpdateWeeklyHours)
+		doctorRoutes.POST("/:id/availability/exceptions", availabilityController.CreateException)
+		doctorRoutes.DELETE("/:id/availability/exceptions/:exceptionId", availabilityController.DeleteException)
+
+		// Buffers, lead time, booking horizon and daily cap
+		doctorRoutes.GET("/:id/scheduling-rules", availabilityController.GetSchedulingRules)
+		doctorRoutes.PUT("/:id/scheduling-rules", availabilityController.UpdateSchedulingRules)
+
+		// Free bookable slots
+		doctorRoutes.GET("/:id/slots", availabilityController.ListSlots)
+
+		// Cancellation policy, falling back to the organization's
+		doctorRoutes.GET("/:id/cancellation-policy", cancellationPolicyController.GetDoctorPolicy)
+		doctorRoutes.PUT("/:id/cancellation-policy", cancellationPolicyController.UpdateDoctorPolicy)
+		doctorRoutes.DELETE("/:id/cancellation-policy", cancellationPolicyController.DeleteDoctorPolicy)
+
+		// Visit types with their own length, modality and price
+		doctorRoutes.GET("/:id/appointment-types", appointmentTypeController.ListAppointmentTypes)
+		doctorRoutes.POST("/:id/appointment-types", appointmentTypeController.CreateAppointmentType)
+		doctorRoutes.PUT("/:id/appointment-types/:typeId", appointmentTypeController.UpdateAppointmentType)
+		doctorRoutes.DELETE("/:id/appointment-types/:typeId", appointmentTypeController.DeleteAppointmentType)
+	}
+}
@@ -0,0 +1,33 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/adrianmcmains/telehealth-platform/controllers"
+	"github.com/adrianmcmains/telehealth-platform/middleware"
+)
+
+// SetupExportRoutes configures the personal data export routes
+func SetupExportRoutes(router *gin.RouterGroup) {
+	exportController := controllers.NewExportController()
+
+	exportRoutes := router.Group("/exports")
+	{
+		// Public route for the emailed download link (authorized by its token)
+		exportRoutes.GET("/:id/download", exportController.DownloadExport)
+
+		// Protected routes
+		protected := exportRoutes.Group("/")
+		protected.Use(middleware.AuthMiddleware())
+		{
+			// Request a new export
+			protected.POST("", exportController.RequestExport)
+
+			// List the user's exports
+			protected.GET("", exportController.ListExports)
+
+			// Get export status
+			protected.GET("/:id", exportController.GetExport)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/adrianmcmains/telehealth-platform/controllers"
+)
+
+// SetupGuestRoutes configures the routes guests use without an account
+func SetupGuestRoutes(router *gin.RouterGroup) {
+	participantController := controllers.NewParticipantController()
+
+	// Guests authenticate with the secret token in their link
+	guestRoutes := router.Group("/guest")
+	{
+		guestRoutes.GET("/:token", participantController.GetGuestLink)
+	}
+}
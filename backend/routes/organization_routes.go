@@ -0,0 +1,44 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/adrianmcmains/telehealth-platform/controllers"
+	"github.com/adrianmcmains/telehealth-platform/middleware"
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// SetupOrganizationRoutes configures the organization routes
+func SetupOrganizationRoutes(router *gin.RouterGroup) {
+	organizationController := controllers.NewOrganizationController()
+
+	organizationRoutes := router.Group("/organizations")
+	{
+		// Public route for login page branding
+		organizationRoutes.GET("/branding/:slug", organizationController.GetBranding)
+
+		// Protected routes
+		protected := organizationRoutes.Group("/")
+		protected.Use(middleware.AuthMiddleware())
+		{
+			// List the user's organizations
+			protected.GET("", organizationController.ListMyOrganizations)
+
+			// Get and update an organization
+			protected.GET("/:id", organizationController.GetOrganization)
+			protected.PUT("/:id", organizationController.UpdateOrganization)
+
+			// Default cancellation policy for the organization's doctors
+			protected.GET("/:id/cancellation-policy", organizationController.GetCancellationPolicy)
+			protected.PUT("/:id/cancellation-policy", organizationController.UpdateCancellationPolicy)
+
+			// Manage members
+			protected.GET("/:id/members", organizationController.ListMembers)
+			protected.POST("/:id/members", organizationController.AddMember)
+			protected.DELETE("/:id/members/:userId", organizationController.RemoveMember)
+
+			// Create organizations (platform admins only)
+			protected.POST("", middleware.RoleMiddleware(models.RoleAdmin), organizationController.CreateOrganization)
+		}
+	}
+}
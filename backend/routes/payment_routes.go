@@ -20,7 +20,7 @@ func SetupPaymentRoutes(router *gin.RouterGroup) {
 		
 		// Protected routes
 		protected := paymentRoutes.Group("/")
-		protected.Use(middleware.AuthMiddleware())
+		protected.Use(middleware.AuthMiddleware(), middleware.OrganizationMiddleware())
 		{
 			// Create payment
 			protected.POST("", paymentController.CreatePayment)
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/adrianmcmains/telehealth-platform/controllers"
+	"github.com/adrianmcmains/telehealth-platform/middleware"
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// SetupQuestionnaireRoutes configures the intake questionnaire routes
+func SetupQuestionnaireRoutes(router *gin.RouterGroup) {
+	questionnaireController := controllers.NewQuestionnaireController()
+
+	// Questionnaires are managed by doctors and admins in an organization
+	questionnaireRoutes := router.Group("/questionnaires")
+	questionnaireRoutes.Use(
+		middleware.AuthMiddleware(),
+		middleware.OrganizationMiddleware(),
+		middleware.RoleMiddleware(models.RoleDoctor, models.RoleAdmin),
+	)
+	{
+		questionnaireRoutes.GET("", questionnaireController.ListQuestionnaires)
+		questionnaireRoutes.POST("", questionnaireController.CreateQuestionnaire)
+		questionnaireRoutes.GET("/:id", questionnaireController.GetQuestionnaire)
+
+		// Editing the questions adds a new version
+		questionnaireRoutes.PUT("/:id", questionnaireController.UpdateQuestionnaire)
+	}
+}
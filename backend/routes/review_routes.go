@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/adrianmcmains/telehealth-platform/controllers"
+	"github.com/adrianmcmains/telehealth-platform/middleware"
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// SetupReviewRoutes configures the doctor review routes
+func SetupReviewRoutes(router *gin.RouterGroup) {
+	reviewController := controllers.NewReviewController()
+
+	// All review routes require authentication and are scoped to an organization
+	reviewRoutes := router.Group("/reviews")
+	reviewRoutes.Use(middleware.AuthMiddleware(), middleware.OrganizationMiddleware())
+	{
+		// Rate a completed appointment
+		reviewRoutes.POST("", middleware.RoleMiddleware(models.RolePatient), reviewController.CreateReview)
+
+		// List a doctor's reviews
+		reviewRoutes.GET("", reviewController.ListDoctorReviews)
+
+		// Doctor reply
+		reviewRoutes.PUT("/:id/reply", middleware.RoleMiddleware(models.RoleDoctor), reviewController.ReplyToReview)
+
+		// Report an abusive review
+		reviewRoutes.POST("/:id/report", reviewController.ReportReview)
+
+		// Moderation (organization admins only)
+		reviewRoutes.GET("/moderation", middleware.RoleMiddleware(models.RoleAdmin), reviewController.ListModerationQueue)
+		reviewRoutes.PUT("/:id/moderation", middleware.RoleMiddleware(models.RoleAdmin), reviewController.ModerateReview)
+	}
+}
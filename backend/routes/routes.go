@@ -16,4 +16,12 @@ func SetupRoutes(router *gin.Engine) {
 	SetupWebRTCRoutes(v1)
 	SetupPaymentRoutes(v1)
 	SetupTwoFARoutes(v1)
+	SetupExportRoutes(v1)
+	SetupOrganizationRoutes(v1)
+	SetupReviewRoutes(v1)
+	SetupDoctorRoutes(v1)
+	SetupWaitlistRoutes(v1)
+	SetupCalendarRoutes(v1)
+	SetupQuestionnaireRoutes(v1)
+	SetupGuestRoutes(v1)
 }
\ No newline at end of file
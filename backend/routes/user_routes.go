@@ -22,13 +22,33 @@ func SetupUserRoutes(router *gin.RouterGroup) {
 		// Update user
 		userRoutes.PUT("/:id", userController.UpdateUser)
 		
-		// List all doctors
-		userRoutes.GET("/doctors", userController.ListDoctors)
+		// Partially update user (JSON Merge Patch)
+		userRoutes.PATCH("/:id", userController.PatchUser)
+		
+		// Account deletion
+		userRoutes.POST("/:id/deletion", userController.RequestAccountDeletion)
+		userRoutes.GET("/:id/deletion", userController.GetAccountDeletion)
+		userRoutes.DELETE("/:id/deletion", userController.CancelAccountDeletion)
+		
+		// Time zone, language and notification preferences
+		userRoutes.GET("/:id/preferences", userController.GetPreferences)
+		userRoutes.PUT("/:id/preferences", userController.UpdatePreferences)
+		
+		// Subscribable calendar feed link
+		userRoutes.GET("/:id/calendar-feed", userController.GetCalendarFeed)
+		userRoutes.POST("/:id/calendar-feed/rotate", userController.RotateCalendarFeed)
+		userRoutes.DELETE("/:id/calendar-feed", userController.DeleteCalendarFeed)
+		
+		// List the doctors in the current organization
+		userRoutes.GET("/doctors", middleware.OrganizationMiddleware(), userController.ListDoctors)
 		
 		// Admin-only routes
 		adminRoutes := userRoutes.Group("/")
 		adminRoutes.Use(middleware.RoleMiddleware(models.RoleAdmin))
 		{
+			// Search users by phone number
+			adminRoutes.GET("/search", userController.SearchUsers)
+			
 			// Add admin-specific routes here
 		}
 	}
@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/adrianmcmains/telehealth-platform/controllers"
+	"github.com/adrianmcmains/telehealth-platform/middleware"
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// SetupWaitlistRoutes configures the waitlist and slot offer routes
+func SetupWaitlistRoutes(router *gin.RouterGroup) {
+	waitlistController := controllers.NewWaitlistController()
+
+	// All waitlist routes require authentication and are scoped to an organization
+	waitlistRoutes := router.Group("/waitlist")
+	waitlistRoutes.Use(middleware.AuthMiddleware(), middleware.OrganizationMiddleware())
+	{
+		// Join, view and leave waitlists
+		waitlistRoutes.POST("", middleware.RoleMiddleware(models.RolePatient), waitlistController.JoinWaitlist)
+		waitlistRoutes.GET("", waitlistController.ListWaitlist)
+		waitlistRoutes.DELETE("/:id", waitlistController.LeaveWaitlist)
+
+		// Claim links sent when a slot is offered
+		waitlistRoutes.GET("/offers/:token", waitlistController.GetOffer)
+		waitlistRoutes.POST("/offers/:token/claim", waitlistController.ClaimOffer)
+		waitlistRoutes.POST("/offers/:token/decline", waitlistController.DeclineOffer)
+	}
+}
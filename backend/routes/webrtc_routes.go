@@ -18,4 +18,7 @@ func SetupWebRTCRoutes(router *gin.RouterGroup) {
 		// WebSocket endpoint for WebRTC signaling
 		webRTCRoutes.GET("/:roomId", webRTCService.HandleWebSocket)
 	}
+	
+	// Guests join with the token from their link instead of an account
+	router.GET("/webrtc/guest/:token", webRTCService.HandleGuestWebSocket)
 }
\ No newline at end of file
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// SystemActor is the actor recorded for changes made by scheduled jobs and
+// payment provider callbacks
+var SystemActor = Actor{Role: models.RoleSystem}
+
+// RecordAppointmentEvent appends an entry to an appointment's change history.
+// Pass the transaction that made the change so the entry is saved with it.
+// Updates that changed nothing are not recorded.
+func RecordAppointmentEvent(tx *gorm.DB, appointment *models.Appointment, eventType models.AppointmentEventType, actor Actor, changes []models.FieldChange, reason string) error {
+	return recordEvent(tx, appointment, nil, eventType, actor, changes, reason)
+}
+
+// RecordPaymentEvent appends a payment change to an appointment's history.
+// Changes to the appointment itself, such as it becoming paid, can be
+// included alongside the payment's own fields.
+func RecordPaymentEvent(tx *gorm.DB, appointment *models.Appointment, payment *models.Payment, actor Actor, changes []models.FieldChange, reason string) error {
+	return recordEvent(tx, appointment, &payment.ID, models.AppointmentEventPayment, actor, changes, reason)
+}
+
+func recordEvent(tx *gorm.DB, appointment *models.Appointment, paymentID *uint, eventType models.AppointmentEventType, actor Actor, changes []models.FieldChange, reason string) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	event := models.AppointmentEvent{
+		OrganizationID: appointment.OrganizationID,
+		AppointmentID:  appointment.ID,
+		Type:           eventType,
+		PaymentID:      paymentID,
+		ActorID:        actor.ID,
+		ActorRole:      actor.Role,
+		Reason:         reason,
+		Changes:        changes,
+	}
+	if err := tx.Create(&event).Error; err != nil {
+		return fmt.Errorf("failed to record appointment history: %w", err)
+	}
+	return nil
+}
+
+// Events returns an appointment's full change history, oldest first
+func (as *AppointmentService) Events(ctx context.Context, appointmentID uint) ([]models.AppointmentEvent, error) {
+	var events []models.AppointmentEvent
+	if err := as.DB.WithContext(ctx).Where("appointment_id = ?", appointmentID).
+		Order("created_at ASC, id ASC").Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to load appointment history: %w", err)
+	}
+	return events, nil
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// ErrHoldReleased is returned when a payment completes after its slot hold
+// was released
+var ErrHoldReleased = errors.New("the slot hold was released before the payment completed")
+
+// holdExpiredReason is recorded when an unpaid hold is released
+const holdExpiredReason = "Slot hold expired before checkout completed"
+
+// Hold marks a new appointment as holding its slot until checkout completes
+func (as *AppointmentService) Hold(appointment *models.Appointment) {
+	holdSlot(appointment, as.HoldPeriod)
+}
+
+// holdSlot marks a new appointment as holding its slot for the given period
+func holdSlot(appointment *models.Appointment, period time.Duration) {
+	expiresAt := time.Now().Add(period)
+	appointment.Status = models.StatusHeld
+	appointment.HoldExpiresAt = &expiresAt
+}
+
+// ExpireHolds releases every hold that expired before its payment completed
+// and offers the freed slots to the waitlist
+func (as *AppointmentService) ExpireHolds() error {
+	var holds []models.Appointment
+	if err := as.DB.Where("status = ? AND hold_expires_at <= ?", models.StatusHeld, time.Now()).
+		Find(&holds).Error; err != nil {
+		return fmt.Errorf("failed to load expired holds: %w", err)
+	}
+
+	for i := range holds {
+		var released bool
+		err := as.DB.Transaction(func(tx *gorm.DB) error {
+			var err error
+			released, err = releaseHold(tx, &holds[i])
+			return err
+		})
+		if err != nil {
+			log.Printf("Failed to release hold on appointment %d: %v", holds[i].ID, err)
+			continue
+		}
+		if released {
+			as.offerFreedSlot(holds[i])
+		}
+	}
+	return nil
+}
+
+// ReleaseExpiredHolds releases the doctor's expired holds between from and
+// to. Bookings call it in their transaction before taking a slot, because the
+// overlap constraint counts a hold until it is released.
+func ReleaseExpiredHolds(tx *gorm.DB, doctorID uint, from, to time.Time) error {
+	var holds []models.Appointment
+	if err := tx.Where("doctor_id = ? AND status = ? AND hold_expires_at <= ? AND start_time < ? AND end_time > ?",
+		doctorID, models.StatusHeld, time.Now(), to, from).Find(&holds).Error; err != nil {
+		return fmt.Errorf("failed to load expired holds: %w", err)
+	}
+	for i := range holds {
+		if _, err := releaseHold(tx, &holds[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConfirmHold schedules a held appointment once its payment completes. It
+// runs in the payment's transaction, and still confirms a hold that expired
+// but has not been released yet. It returns ErrHoldReleased if the hold was
+// released or cancelled first.
+func ConfirmHold(tx *gorm.DB, appointment *models.Appointment) error {
+	result := tx.Model(&models.Appointment{}).
+		Where("id = ? AND status = ?", appointment.ID, models.StatusHeld).
+		Updates(map[string]interface{}{"status": models.StatusScheduled, "hold_expires_at": nil})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrHoldReleased
+	}
+
+	change := models.AppointmentStatusChange{
+		OrganizationID: appointment.OrganizationID,
+		AppointmentID:  appointment.ID,
+		FromStatus:     models.StatusHeld,
+		ToStatus:       models.StatusScheduled,
+		ActorID:        SystemActor.ID,
+		ActorRole:      SystemActor.Role,
+		Reason:         "Payment completed",
+	}
+	if err := tx.Create(&change).Error; err != nil {
+		return err
+	}
+	appointment.Status = models.StatusScheduled
+	appointment.HoldExpiresAt = nil
+	return nil
+}
+
+// releaseHold cancels an expired hold and records the change. It reports
+// false if the hold was confirmed or released in the meantime.
+func releaseHold(tx *gorm.DB, appointment *models.Appointment) (bool, error) {
+	result := tx.Model(&models.Appointment{}).
+		Where("id = ? AND status = ? AND hold_expires_at <= ?", appointment.ID, models.StatusHeld, time.Now()).
+		Update("status", models.StatusCancelled)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	change := models.AppointmentStatusChange{
+		OrganizationID: appointment.OrganizationID,
+		AppointmentID:  appointment.ID,
+		FromStatus:     models.StatusHeld,
+		ToStatus:       models.StatusCancelled,
+		ActorID:        SystemActor.ID,
+		ActorRole:      SystemActor.Role,
+		Reason:         holdExpiredReason,
+	}
+	if err := tx.Create(&change).Error; err != nil {
+		return false, err
+	}
+	appointment.Status = models.StatusCancelled
+	return true, RecordAppointmentEvent(tx, appointment, models.AppointmentEventStatusChanged, SystemActor,
+		[]models.FieldChange{{Field: "status", Before: models.StatusHeld, After: models.StatusCancelled}}, holdExpiredReason)
+}
+
+// blocksSlot limits a query to appointments that keep their slot: all but
+// cancelled appointments and holds that have expired
+func blocksSlot(db *gorm.DB) *gorm.DB {
+	return db.Where("status <> ? AND NOT (status = ? AND hold_expires_at <= ?)",
+		models.StatusCancelled, models.StatusHeld, time.Now())
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// refundRetryAfter is how long a refund attempt is given before the payment
+// can be tried again. It is longer than any payment provider call takes, so
+// two attempts never refund the same payment at once.
+const refundRetryAfter = 5 * time.Minute
+
+// queueRefunds marks the completed payments of a cancelled appointment as
+// owed a refund, as the doctor's or clinic's cancellation policy allows. It
+// runs in the cancellation's transaction; sendRefunds pays them out after it
+// commits and RetryRefunds picks up any that failed.
+func queueRefunds(tx *gorm.DB, appointment *models.Appointment, actor Actor, reason string) error {
+	var payments []models.Payment
+	if err := tx.Where("appointment_id = ? AND status = ?", appointment.ID, PaymentStatusCompleted).
+		Find(&payments).Error; err != nil {
+		return fmt.Errorf("failed to load payments: %w", err)
+	}
+	if len(payments) == 0 {
+		return nil
+	}
+
+	policy, err := EffectiveCancellationPolicy(tx, appointment.OrganizationID, appointment.DoctorID)
+	if err != nil {
+		return err
+	}
+	percent := policy.RefundPercent(appointment.StartTime, time.Now(), actor.Role)
+	if percent <= 0 {
+		log.Printf("Appointment %d cancelled too late for a refund under the %s cancellation policy", appointment.ID, policy.Source())
+		return nil
+	}
+
+	if reason == "" {
+		reason = "Appointment cancelled"
+	}
+	for _, payment := range payments {
+		before := payment
+		payment.Status = string(PaymentStatusRefundPending)
+		payment.RefundDue = payment.Amount
+		if percent < 100 {
+			payment.RefundDue = refundAmount(payment.Amount, percent)
+		}
+		payment.RefundReason = reason
+		if err := tx.Model(&payment).Updates(map[string]interface{}{
+			"status":        payment.Status,
+			"refund_due":    payment.RefundDue,
+			"refund_reason": payment.RefundReason,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to queue refund for payment %d: %w", payment.ID, err)
+		}
+		if err := RecordPaymentEvent(tx, appointment, &payment, actor, models.DiffPayment(&before, &payment), reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendRefunds pays out the pending refunds of one appointment
+func (as *AppointmentService) sendRefunds(db *gorm.DB, appointmentID uint) error {
+	var payments []models.Payment
+	if err := db.Where("appointment_id = ? AND status = ?", appointmentID, PaymentStatusRefundPending).
+		Find(&payments).Error; err != nil {
+		return fmt.Errorf("failed to load pending refunds: %w", err)
+	}
+
+	for i := range payments {
+		if err := as.sendRefund(db, &payments[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RetryRefunds pays out pending refunds whose last attempt failed or never
+// finished
+func (as *AppointmentService) RetryRefunds() error {
+	var payments []models.Payment
+	if err := as.DB.Where("status = ? AND (refund_attempted_at IS NULL OR refund_attempted_at < ?)",
+		PaymentStatusRefundPending, time.Now().Add(-refundRetryAfter)).
+		Find(&payments).Error; err != nil {
+		return fmt.Errorf("failed to load pending refunds: %w", err)
+	}
+
+	for i := range payments {
+		if err := as.sendRefund(as.DB, &payments[i]); err != nil {
+			log.Printf("Failed to refund payment %d: %v", payments[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// sendRefund asks the payment provider to refund a pending refund, then
+// records it as refunded. The payment stays pending if the provider fails.
+func (as *AppointmentService) sendRefund(db *gorm.DB, payment *models.Payment) error {
+	// Claim the attempt so a retry cannot refund the payment a second time
+	now := time.Now()
+	result := db.Model(&models.Payment{}).
+		Where("id = ? AND status = ? AND (refund_attempted_at IS NULL OR refund_attempted_at < ?)",
+			payment.ID, PaymentStatusRefundPending, now.Add(-refundRetryAfter)).
+		Update("refund_attempted_at", now)
+	if result.Error != nil {
+		return fmt.Errorf("failed to start refund of payment %d: %w", payment.ID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	var organization models.Organization
+	if err := db.First(&organization, payment.OrganizationID).Error; err != nil {
+		return fmt.Errorf("failed to load organization payment settings: %w", err)
+	}
+	paymentService := as.PaymentService.ForOrganization(&organization)
+
+	full := payment.RefundDue >= payment.Amount
+	var err error
+	if full {
+		err = paymentService.RefundPayment(payment.PaymentID, payment.RefundReason)
+	} else {
+		err = paymentService.RefundAmount(payment.PaymentID, payment.RefundDue, payment.RefundReason)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to refund payment %d: %w", payment.ID, err)
+	}
+
+	var appointment models.Appointment
+	if err := db.First(&appointment, payment.AppointmentID).Error; err != nil {
+		return fmt.Errorf("failed to load appointment %d: %w", payment.AppointmentID, err)
+	}
+
+	before := *payment
+	payment.Status = string(PaymentStatusRefunded)
+	if !full {
+		payment.Status = string(PaymentStatusPartiallyRefunded)
+	}
+	payment.RefundedAmount = payment.RefundDue
+	payment.RefundDue = 0
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(payment).Updates(map[string]interface{}{
+			"status":          payment.Status,
+			"refunded_amount": payment.RefundedAmount,
+			"refund_due":      0,
+		}).Error; err != nil {
+			return err
+		}
+		changes := models.DiffPayment(&before, payment)
+
+		// A partly refunded appointment stays paid for the part the clinic kept
+		if full && appointment.IsPaid {
+			if err := tx.Model(&appointment).Update("is_paid", false).Error; err != nil {
+				return err
+			}
+			appointment.IsPaid = false
+			changes = append(changes, models.FieldChange{Field: "isPaid", Before: true, After: false})
+		}
+		return RecordPaymentEvent(tx, &appointment, payment, SystemActor, changes, payment.RefundReason)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update payment %d: %w", payment.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,413 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// Errors returned when booking or changing a series
+var (
+	ErrInvalidRecurrence = errors.New("the recurrence rule does not produce any appointments")
+	ErrSeriesConflict    = errors.New("some occurrences clash with other bookings or fall outside the doctor's availability")
+	ErrNotInSeries       = errors.New("this appointment is not part of a series")
+	ErrPaidSeries        = errors.New("paid visit types cannot be booked as a series; book each visit on its own")
+)
+
+// SeriesConflict is an occurrence that cannot be booked at its time
+type SeriesConflict struct {
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Reason    string    `json:"reason"`
+}
+
+// Occurrences expands a series' recurrence rule. Occurrences keep the same
+// wall-clock time in the doctor's time zone across daylight saving changes.
+func (as *AppointmentService) Occurrences(series *models.AppointmentSeries) ([]TimeRange, error) {
+	return seriesOccurrences(series, as.AvailabilityService.DoctorLocation(series.DoctorID))
+}
+
+// seriesOccurrences expands a series' recurrence rule in the given time zone
+func seriesOccurrences(series *models.AppointmentSeries, location *time.Location) ([]TimeRange, error) {
+	weeks, ok := series.Frequency.IntervalWeeks()
+	if !ok || (series.Until == nil && series.Count <= 0) {
+		return nil, ErrInvalidRecurrence
+	}
+
+	first := series.StartTime.In(location)
+	length := series.EndTime.Sub(series.StartTime)
+
+	var occurrences []TimeRange
+	for i := 0; i < models.MaxSeriesOccurrences; i++ {
+		if series.Count > 0 && i >= series.Count {
+			break
+		}
+		start := first.AddDate(0, 0, 7*weeks*i)
+		if series.Until != nil && start.After(*series.Until) {
+			break
+		}
+		occurrences = append(occurrences, TimeRange{Start: start, End: start.Add(length)})
+	}
+	if len(occurrences) == 0 {
+		return nil, ErrInvalidRecurrence
+	}
+	return occurrences, nil
+}
+
+// CreateSeries books every occurrence of a series. All occurrences are checked
+// first; if any clash, nothing is booked and the clashes are returned, unless
+// skipConflicts is set, in which case only the free occurrences are booked.
+func (as *AppointmentService) CreateSeries(ctx context.Context, series *models.AppointmentSeries, skipConflicts bool, actor Actor) ([]models.Appointment, []SeriesConflict, error) {
+	db := as.DB.WithContext(ctx)
+
+	// Paid visits hold their slot until checkout, which covers one visit at a time
+	if series.AppointmentType != nil && series.AppointmentType.Price > 0 {
+		return nil, nil, ErrPaidSeries
+	}
+
+	occurrences, err := as.Occurrences(series)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conflicts, err := as.checkOccurrences(ctx, series.DoctorID, occurrences, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(conflicts) > 0 && !skipConflicts {
+		return nil, conflicts, ErrSeriesConflict
+	}
+
+	var appointments []models.Appointment
+	for _, occurrence := range occurrences {
+		if clashes(occurrence, conflicts) {
+			continue
+		}
+		appointment := models.Appointment{
+			PatientID: series.PatientID,
+			DoctorID:  series.DoctorID,
+			StartTime: occurrence.Start,
+			EndTime:   occurrence.End,
+			Status:    models.StatusScheduled,
+			Reason:    series.Reason,
+		}
+		if series.AppointmentType != nil {
+			series.AppointmentType.Apply(&appointment)
+		}
+		appointments = append(appointments, appointment)
+	}
+	if len(appointments) == 0 {
+		return nil, conflicts, ErrSeriesConflict
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(series).Error; err != nil {
+			return err
+		}
+		for i := range appointments {
+			appointments[i].SeriesID = &series.ID
+		}
+		if err := ReleaseExpiredHolds(tx, series.DoctorID, occurrences[0].Start, occurrences[len(occurrences)-1].End); err != nil {
+			return err
+		}
+		// The overlap constraint rejects any slot booked since the check
+		if err := tx.Create(&appointments).Error; err != nil {
+			return err
+		}
+		for i := range appointments {
+			if err := RecordAppointmentEvent(tx, &appointments[i], models.AppointmentEventCreated, actor, models.DiffAppointment(nil, &appointments[i]), ""); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if config.IsExclusionViolation(err) {
+		return nil, nil, ErrSlotUnavailable
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Confirm the first appointment; reminders cover the rest as they come up
+	first := appointments[0]
+	if err := db.Preload("Patient").Preload("Doctor").First(&first, first.ID).Error; err != nil {
+		log.Printf("Failed to load appointment %d for notification: %v", first.ID, err)
+	} else {
+		go as.NotificationService.SendAppointmentNotification(&first, NotificationTypeAppointmentConfirmation)
+	}
+
+	return appointments, conflicts, nil
+}
+
+// CancelOccurrences cancels an occurrence, or it and every later scheduled
+// occurrence, through the normal lifecycle so each is refunded and notified
+func (as *AppointmentService) CancelOccurrences(ctx context.Context, appointment *models.Appointment, scope models.SeriesScope, actor Actor, reason string) ([]models.AppointmentStatusChange, error) {
+	targets, err := as.seriesTargets(ctx, appointment, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []models.AppointmentStatusChange
+	for i := range targets {
+		change, err := as.Transition(ctx, &targets[i], models.StatusCancelled, actor, reason)
+		if err != nil {
+			return changes, err
+		}
+		changes = append(changes, *change)
+	}
+	return changes, nil
+}
+
+// RescheduleOccurrences moves an occurrence, or it and every later scheduled
+// occurrence. Later occurrences move by the same number of days and to the
+// same time of day in the doctor's time zone. Every new time is checked first
+// and nothing moves if any of them clash.
+func (as *AppointmentService) RescheduleOccurrences(ctx context.Context, appointment *models.Appointment, scope models.SeriesScope, start, end time.Time, actor Actor, reason string) ([]models.AppointmentReschedule, []SeriesConflict, error) {
+	db := as.DB.WithContext(ctx)
+
+	if scope == models.ScopeThis {
+		reschedule, err := as.Reschedule(ctx, appointment, start, end, actor, reason)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []models.AppointmentReschedule{*reschedule}, nil, nil
+	}
+
+	targets, err := as.seriesTargets(ctx, appointment, scope)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range targets {
+		if err := as.checkReschedule(db, &targets[i], actor); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Shift every occurrence by the same days, keeping the new time of day
+	location := as.AvailabilityService.DoctorLocation(appointment.DoctorID)
+	selected := appointment.StartTime.In(location)
+	newStart := start.In(location)
+	days := dayNumber(newStart) - dayNumber(selected)
+	length := end.Sub(start)
+
+	moves := make([]TimeRange, len(targets))
+	ids := make([]uint, len(targets))
+	for i, target := range targets {
+		day := target.StartTime.In(location).AddDate(0, 0, days)
+		moved := time.Date(day.Year(), day.Month(), day.Day(), newStart.Hour(), newStart.Minute(), 0, 0, location)
+		moves[i] = TimeRange{Start: moved, End: moved.Add(length)}
+		ids[i] = target.ID
+	}
+
+	conflicts, err := as.checkOccurrences(ctx, appointment.DoctorID, moves, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(conflicts) > 0 {
+		return nil, conflicts, ErrSeriesConflict
+	}
+
+	reschedules := make([]models.AppointmentReschedule, len(targets))
+	for i, target := range targets {
+		reschedules[i] = models.AppointmentReschedule{
+			OrganizationID:    target.OrganizationID,
+			AppointmentID:     target.ID,
+			PreviousStartTime: target.StartTime,
+			PreviousEndTime:   target.EndTime,
+			NewStartTime:      moves[i].Start,
+			NewEndTime:        moves[i].End,
+			ActorID:           actor.ID,
+			ActorRole:         actor.Role,
+			Reason:            reason,
+		}
+	}
+
+	// Move the occurrence furthest along the shift first, so no occurrence
+	// lands on one that has not moved yet
+	order := make([]int, len(targets))
+	for i := range order {
+		order[i] = i
+	}
+	if moves[0].Start.After(targets[0].StartTime) {
+		sort.Sort(sort.Reverse(sort.IntSlice(order)))
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := ReleaseExpiredHolds(tx, appointment.DoctorID, moves[0].Start, moves[len(moves)-1].End); err != nil {
+			return err
+		}
+		for _, i := range order {
+			result := tx.Model(&models.Appointment{}).
+				Where("id = ? AND status = ? AND start_time = ?", targets[i].ID, models.StatusScheduled, targets[i].StartTime).
+				Updates(map[string]interface{}{"start_time": moves[i].Start, "end_time": moves[i].End})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrTransitionConflict
+			}
+		}
+		if err := tx.Create(&reschedules).Error; err != nil {
+			return err
+		}
+		for i := range targets {
+			if err := RecordAppointmentEvent(tx, &targets[i], models.AppointmentEventRescheduled, actor, rescheduleChanges(&reschedules[i]), reason); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if config.IsExclusionViolation(err) {
+		return nil, nil, ErrSlotUnavailable
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	freed := make([]models.Appointment, len(targets))
+	for i := range targets {
+		freed[i] = freedSlot(&targets[i], &reschedules[i])
+	}
+	go func() {
+		for _, slot := range freed {
+			as.offerFreedSlot(slot)
+		}
+	}()
+
+	// Notify once, for the selected occurrence
+	previousStart := appointment.StartTime
+	if err := db.Preload("Patient").Preload("Doctor").First(appointment, appointment.ID).Error; err != nil {
+		log.Printf("Failed to load appointment %d for notification: %v", appointment.ID, err)
+	} else {
+		go as.NotificationService.SendRescheduleNotification(appointment, previousStart)
+	}
+
+	return reschedules, nil, nil
+}
+
+// seriesTargets returns the appointments a series change applies to
+func (as *AppointmentService) seriesTargets(ctx context.Context, appointment *models.Appointment, scope models.SeriesScope) ([]models.Appointment, error) {
+	switch scope {
+	case models.ScopeThis:
+		return []models.Appointment{*appointment}, nil
+	case models.ScopeFollowing:
+	default:
+		return nil, fmt.Errorf("unknown series scope %q", scope)
+	}
+	if appointment.SeriesID == nil {
+		return nil, ErrNotInSeries
+	}
+	if appointment.Status != models.StatusScheduled {
+		return nil, ErrNotReschedulable
+	}
+
+	var targets []models.Appointment
+	if err := as.DB.WithContext(ctx).
+		Where("series_id = ? AND status = ? AND start_time >= ?", *appointment.SeriesID, models.StatusScheduled, appointment.StartTime).
+		Order("start_time ASC").Find(&targets).Error; err != nil {
+		return nil, fmt.Errorf("failed to load series appointments: %w", err)
+	}
+	return targets, nil
+}
+
+// checkOccurrences returns the occurrences that are in the past, outside the
+// doctor's hours, overlapping another booking or breaking the doctor's
+// scheduling rules. Appointments in ignore are the ones being moved and do not
+// count as bookings.
+func (as *AppointmentService) checkOccurrences(ctx context.Context, doctorID uint, occurrences []TimeRange, ignore []uint) ([]SeriesConflict, error) {
+	from := occurrences[0].Start
+	to := occurrences[len(occurrences)-1].End
+
+	windows, err := as.AvailabilityService.dayWindows(ctx, doctorID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := as.AvailabilityService.SchedulingRules(ctx, doctorID)
+	if err != nil {
+		return nil, err
+	}
+	before, after := rules.BufferBefore(), rules.BufferAfter()
+
+	booked, err := as.AvailabilityService.bookedRanges(ctx, doctorID, from.Add(-before-after), to.Add(before+after), ignore...)
+	if err != nil {
+		return nil, err
+	}
+
+	location := as.AvailabilityService.DoctorLocation(doctorID)
+	var counts map[string]int
+	if rules.MaxPerDay > 0 {
+		if counts, err = as.AvailabilityService.dailyCounts(ctx, doctorID, location, from, to, ignore...); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	earliest := rules.Earliest(now)
+	latest, limited := rules.Latest(now)
+	var conflicts []SeriesConflict
+	for _, occurrence := range occurrences {
+		day := occurrence.Start.In(location).Format(dayKey)
+		reason := ""
+		switch {
+		case !occurrence.Start.After(now):
+			reason = "in the past"
+		case occurrence.Start.Before(earliest):
+			reason = "too soon to book"
+		case limited && occurrence.Start.After(latest):
+			reason = "too far ahead to book"
+		case !withinAny(occurrence, windows):
+			reason = "outside the doctor's availability"
+		case overlapsAny(occurrence, booked):
+			reason = "already booked"
+		case tooClose(occurrence, booked, before, after):
+			reason = "too close to another appointment"
+		case rules.MaxPerDay > 0 && counts[day] >= rules.MaxPerDay:
+			reason = "the doctor's daily limit is reached"
+		}
+		if reason != "" {
+			conflicts = append(conflicts, SeriesConflict{StartTime: occurrence.Start, EndTime: occurrence.End, Reason: reason})
+			continue
+		}
+
+		// Later occurrences must keep their distance from this one too
+		booked = append(booked, occurrence)
+		if counts != nil {
+			counts[day]++
+		}
+	}
+	return conflicts, nil
+}
+
+// withinAny reports whether a range lies entirely within one of the windows
+func withinAny(r TimeRange, windows []TimeRange) bool {
+	for _, window := range windows {
+		if window.Contains(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// clashes reports whether an occurrence is one of the conflicts
+func clashes(occurrence TimeRange, conflicts []SeriesConflict) bool {
+	for _, conflict := range conflicts {
+		if conflict.StartTime.Equal(occurrence.Start) {
+			return true
+		}
+	}
+	return false
+}
+
+// dayNumber counts calendar days, so two times' difference in days ignores daylight saving
+func dayNumber(t time.Time) int {
+	return int(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400)
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+func TestSeriesOccurrencesAcrossDaylightSaving(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+
+	// Clocks in New York go forward on 9 March 2025
+	start := time.Date(2025, 3, 3, 9, 0, 0, 0, newYork)
+	series := &models.AppointmentSeries{
+		StartTime: start.UTC(),
+		EndTime:   start.Add(45 * time.Minute).UTC(),
+		Frequency: models.FrequencyWeekly,
+		Count:     3,
+	}
+
+	occurrences, err := seriesOccurrences(series, newYork)
+	if err != nil {
+		t.Fatalf("seriesOccurrences() error = %v", err)
+	}
+	if len(occurrences) != 3 {
+		t.Fatalf("got %d occurrences, want 3", len(occurrences))
+	}
+	for i, occurrence := range occurrences {
+		local := occurrence.Start.In(newYork)
+		if local.Hour() != 9 || local.Minute() != 0 || local.Weekday() != time.Monday {
+			t.Errorf("occurrence %d starts %v, want Monday 09:00 New York time", i, local)
+		}
+		if length := occurrence.End.Sub(occurrence.Start); length != 45*time.Minute {
+			t.Errorf("occurrence %d lasts %v, want 45m", i, length)
+		}
+	}
+
+	// The same wall-clock time is an hour earlier in UTC after the change
+	if got := occurrences[1].Start.UTC().Hour(); got != 13 {
+		t.Errorf("second occurrence starts at %02d:00 UTC, want 13:00", got)
+	}
+	if got := occurrences[0].Start.UTC().Hour(); got != 14 {
+		t.Errorf("first occurrence starts at %02d:00 UTC, want 14:00", got)
+	}
+}
+
+func TestSeriesOccurrencesUntil(t *testing.T) {
+	start := time.Date(2025, 1, 6, 10, 0, 0, 0, time.UTC)
+	until := start.AddDate(0, 0, 28)
+	series := &models.AppointmentSeries{
+		StartTime: start,
+		EndTime:   start.Add(30 * time.Minute),
+		Frequency: models.FrequencyBiweekly,
+		Until:     &until,
+	}
+
+	occurrences, err := seriesOccurrences(series, time.UTC)
+	if err != nil {
+		t.Fatalf("seriesOccurrences() error = %v", err)
+	}
+	want := []time.Time{start, start.AddDate(0, 0, 14), start.AddDate(0, 0, 28)}
+	if len(occurrences) != len(want) {
+		t.Fatalf("got %d occurrences, want %d", len(occurrences), len(want))
+	}
+	for i := range want {
+		if !occurrences[i].Start.Equal(want[i]) {
+			t.Errorf("occurrence %d starts %v, want %v", i, occurrences[i].Start, want[i])
+		}
+	}
+}
+
+func TestSeriesOccurrencesInvalidRule(t *testing.T) {
+	start := time.Date(2025, 1, 6, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		series models.AppointmentSeries
+	}{
+		{"unknown frequency", models.AppointmentSeries{StartTime: start, EndTime: start, Frequency: "daily", Count: 3}},
+		{"no count or end", models.AppointmentSeries{StartTime: start, EndTime: start, Frequency: models.FrequencyWeekly}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := seriesOccurrences(&tt.series, time.UTC); !errors.Is(err, ErrInvalidRecurrence) {
+				t.Errorf("seriesOccurrences() error = %v, want %v", err, ErrInvalidRecurrence)
+			}
+		})
+	}
+}
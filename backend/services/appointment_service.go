@@ -0,0 +1,325 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// Errors returned by AppointmentService.Transition
+var (
+	ErrInvalidTransition   = errors.New("status change is not allowed")
+	ErrTransitionForbidden = errors.New("you are not allowed to make this status change")
+	ErrTransitionTooEarly  = errors.New("status change is not allowed yet")
+	ErrTransitionConflict  = errors.New("appointment status was changed by someone else")
+)
+
+// Errors returned by AppointmentService.Reschedule
+var (
+	ErrNotReschedulable        = errors.New("only scheduled appointments can be rescheduled")
+	ErrRescheduleTooLate       = errors.New("it is too late to reschedule this appointment")
+	ErrRescheduleLimitReached  = errors.New("this appointment has been rescheduled too many times")
+	ErrSlotOutsideAvailability = errors.New("the selected time is outside the doctor's availability")
+	ErrSlotUnavailable         = errors.New("the selected time slot is not available")
+)
+
+// inProgressLeadTime is how long before its start an appointment may begin
+const inProgressLeadTime = 15 * time.Minute
+
+// Actor identifies who is changing an appointment
+type Actor struct {
+	ID   uint
+	Role models.UserRole
+}
+
+// AppointmentService applies appointment lifecycle changes and their side effects
+type AppointmentService struct {
+	DB                  *gorm.DB
+	NotificationService *NotificationService
+	PaymentService      *PaymentService
+	AvailabilityService *AvailabilityService
+	WaitlistService     *WaitlistService
+	// RescheduleNotice is how long before the start a patient may still reschedule
+	RescheduleNotice time.Duration
+	// MaxReschedules caps how often a patient may reschedule one appointment
+	MaxReschedules int
+	// HoldPeriod is how long a slot is held for checkout before it is released
+	HoldPeriod time.Duration
+}
+
+// NewAppointmentService creates a new appointment service
+func NewAppointmentService() *AppointmentService {
+	return &AppointmentService{
+		DB:                  config.DB,
+		NotificationService: NewNotificationService(config.DB),
+		PaymentService:      NewPaymentService(),
+		AvailabilityService: NewAvailabilityService(),
+		WaitlistService:     NewWaitlistService(),
+		RescheduleNotice:    time.Duration(envInt("RESCHEDULE_MIN_NOTICE_HOURS", 24)) * time.Hour,
+		MaxReschedules:      envInt("RESCHEDULE_MAX_PER_APPOINTMENT", 2),
+		HoldPeriod:          time.Duration(envInt("SLOT_HOLD_MINUTES", 15)) * time.Minute,
+	}
+}
+
+// Transition moves an appointment to a new status, records who did it and why,
+// then releases, refunds and notifies as the new status requires
+func (as *AppointmentService) Transition(ctx context.Context, appointment *models.Appointment, to models.AppointmentStatus, actor Actor, reason string) (*models.AppointmentStatusChange, error) {
+	db := as.DB.WithContext(ctx)
+	from := appointment.Status
+
+	transition, ok := models.FindTransition(from, to)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, to)
+	}
+	if !transition.Allows(actor.Role) || !isParticipant(appointment, actor) {
+		return nil, ErrTransitionForbidden
+	}
+
+	// Timing guards
+	now := time.Now()
+	switch to {
+	case models.StatusInProgress:
+		if now.Before(appointment.StartTime.Add(-inProgressLeadTime)) {
+			return nil, fmt.Errorf("%w: the appointment can start %s before its start time", ErrTransitionTooEarly, inProgressLeadTime)
+		}
+	case models.StatusNoShow:
+		if now.Before(appointment.StartTime) {
+			return nil, fmt.Errorf("%w: a no-show can only be recorded after the start time", ErrTransitionTooEarly)
+		}
+	}
+
+	change := models.AppointmentStatusChange{
+		OrganizationID: appointment.OrganizationID,
+		AppointmentID:  appointment.ID,
+		FromStatus:     from,
+		ToStatus:       to,
+		ActorID:        actor.ID,
+		ActorRole:      actor.Role,
+		Reason:         reason,
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Only update if nobody changed the status since it was read
+		result := tx.Model(&models.Appointment{}).
+			Where("id = ? AND status = ?", appointment.ID, from).
+			Update("status", to)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTransitionConflict
+		}
+		if err := tx.Create(&change).Error; err != nil {
+			return err
+		}
+		if err := RecordAppointmentEvent(tx, appointment, models.AppointmentEventStatusChanged, actor,
+			[]models.FieldChange{{Field: "status", Before: from, After: to}}, reason); err != nil {
+			return err
+		}
+		// Refunds owed for a cancellation are saved with it, so none is lost
+		// if sending them fails
+		if to == models.StatusCancelled && appointment.IsPaid {
+			return queueRefunds(tx, appointment, actor, reason)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	appointment.Status = to
+
+	as.afterTransition(ctx, appointment, actor, reason)
+	return &change, nil
+}
+
+// Reschedule moves an appointment to a new time in one step, keeping its
+// payment and recording the previous time. Patients are held to the notice and
+// count limits; doctors and admins are not.
+func (as *AppointmentService) Reschedule(ctx context.Context, appointment *models.Appointment, start, end time.Time, actor Actor, reason string) (*models.AppointmentReschedule, error) {
+	db := as.DB.WithContext(ctx)
+
+	if err := as.checkReschedule(db, appointment, actor); err != nil {
+		return nil, err
+	}
+
+	available, err := as.AvailabilityService.IsAvailable(ctx, appointment.DoctorID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if !available {
+		return nil, ErrSlotOutsideAvailability
+	}
+	if err := as.AvailabilityService.CheckRules(ctx, appointment.DoctorID, start, end, appointment.ID); err != nil {
+		return nil, err
+	}
+
+	reschedule := models.AppointmentReschedule{
+		OrganizationID:    appointment.OrganizationID,
+		AppointmentID:     appointment.ID,
+		PreviousStartTime: appointment.StartTime,
+		PreviousEndTime:   appointment.EndTime,
+		NewStartTime:      start,
+		NewEndTime:        end,
+		ActorID:           actor.ID,
+		ActorRole:         actor.Role,
+		Reason:            reason,
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := ReleaseExpiredHolds(tx, appointment.DoctorID, start, end); err != nil {
+			return err
+		}
+		// Only move the appointment if it has not changed since it was read;
+		// the overlap constraint rejects a slot that is already taken
+		result := tx.Model(&models.Appointment{}).
+			Where("id = ? AND status = ? AND start_time = ?", appointment.ID, models.StatusScheduled, appointment.StartTime).
+			Updates(map[string]interface{}{"start_time": start, "end_time": end})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTransitionConflict
+		}
+		if err := tx.Create(&reschedule).Error; err != nil {
+			return err
+		}
+		return RecordAppointmentEvent(tx, appointment, models.AppointmentEventRescheduled, actor, rescheduleChanges(&reschedule), reason)
+	})
+	if config.IsExclusionViolation(err) {
+		return nil, ErrSlotUnavailable
+	}
+	if err != nil {
+		return nil, err
+	}
+	appointment.StartTime = start
+	appointment.EndTime = end
+	go as.offerFreedSlot(freedSlot(appointment, &reschedule))
+
+	// Load related entities for notification
+	if err := db.Preload("Patient").Preload("Doctor").First(appointment, appointment.ID).Error; err != nil {
+		log.Printf("Failed to load appointment %d for notification: %v", appointment.ID, err)
+	} else {
+		go as.NotificationService.SendRescheduleNotification(appointment, reschedule.PreviousStartTime)
+	}
+
+	return &reschedule, nil
+}
+
+// checkReschedule reports whether the actor may move the appointment
+func (as *AppointmentService) checkReschedule(db *gorm.DB, appointment *models.Appointment, actor Actor) error {
+	if appointment.Status != models.StatusScheduled {
+		return ErrNotReschedulable
+	}
+	if !isParticipant(appointment, actor) {
+		return ErrTransitionForbidden
+	}
+
+	if actor.Role == models.RolePatient {
+		if time.Until(appointment.StartTime) < as.RescheduleNotice {
+			return fmt.Errorf("%w: changes must be made at least %s before the start", ErrRescheduleTooLate, as.RescheduleNotice)
+		}
+		var count int64
+		if err := db.Model(&models.AppointmentReschedule{}).
+			Where("appointment_id = ? AND actor_role = ?", appointment.ID, models.RolePatient).
+			Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to count reschedules: %w", err)
+		}
+		if int(count) >= as.MaxReschedules {
+			return ErrRescheduleLimitReached
+		}
+	}
+	return nil
+}
+
+// Reschedules returns the times an appointment was moved, oldest first
+func (as *AppointmentService) Reschedules(ctx context.Context, appointmentID uint) ([]models.AppointmentReschedule, error) {
+	var reschedules []models.AppointmentReschedule
+	if err := as.DB.WithContext(ctx).Where("appointment_id = ?", appointmentID).
+		Order("created_at ASC").Find(&reschedules).Error; err != nil {
+		return nil, fmt.Errorf("failed to load reschedule history: %w", err)
+	}
+	return reschedules, nil
+}
+
+// History returns an appointment's status changes, oldest first
+func (as *AppointmentService) History(ctx context.Context, appointmentID uint) ([]models.AppointmentStatusChange, error) {
+	var changes []models.AppointmentStatusChange
+	if err := as.DB.WithContext(ctx).Where("appointment_id = ?", appointmentID).
+		Order("created_at ASC").Find(&changes).Error; err != nil {
+		return nil, fmt.Errorf("failed to load status history: %w", err)
+	}
+	return changes, nil
+}
+
+// afterTransition runs the side effects of a status change. Cancelled
+// appointments no longer hold their slot, because the overlap constraint and
+// slot search both ignore them.
+func (as *AppointmentService) afterTransition(ctx context.Context, appointment *models.Appointment, actor Actor, reason string) {
+	db := as.DB.WithContext(ctx)
+
+	if appointment.Status == models.StatusCancelled {
+		if appointment.IsPaid {
+			if err := as.sendRefunds(db, appointment.ID); err != nil {
+				log.Printf("Failed to refund cancelled appointment %d: %v", appointment.ID, err)
+			}
+		}
+		go as.offerFreedSlot(*appointment)
+	}
+
+	// Load related entities for notification
+	if err := db.Preload("Patient").Preload("Doctor").First(appointment, appointment.ID).Error; err != nil {
+		log.Printf("Failed to load appointment %d for notification: %v", appointment.ID, err)
+		return
+	}
+
+	notificationType := NotificationTypeAppointmentUpdate
+	if appointment.Status == models.StatusCancelled {
+		notificationType = NotificationTypeAppointmentCancellation
+	}
+	go as.NotificationService.SendAppointmentNotification(appointment, notificationType)
+}
+
+// rescheduleChanges lists the fields a reschedule changed
+func rescheduleChanges(reschedule *models.AppointmentReschedule) []models.FieldChange {
+	return []models.FieldChange{
+		{Field: "startTime", Before: reschedule.PreviousStartTime, After: reschedule.NewStartTime},
+		{Field: "endTime", Before: reschedule.PreviousEndTime, After: reschedule.NewEndTime},
+	}
+}
+
+// freedSlot returns the appointment as it was before a reschedule moved it
+func freedSlot(appointment *models.Appointment, reschedule *models.AppointmentReschedule) models.Appointment {
+	freed := *appointment
+	freed.StartTime = reschedule.PreviousStartTime
+	freed.EndTime = reschedule.PreviousEndTime
+	return freed
+}
+
+// offerFreedSlot offers the slot an appointment gave up to the doctor's
+// waitlist. It takes a copy because it usually runs in its own goroutine.
+func (as *AppointmentService) offerFreedSlot(freed models.Appointment) {
+	if err := as.WaitlistService.OfferSlot(&freed); err != nil {
+		log.Printf("Failed to offer freed slot to the waitlist: %v", err)
+	}
+}
+
+// isParticipant reports whether the actor is on the appointment; admins and
+// scheduled jobs act on any appointment
+func isParticipant(appointment *models.Appointment, actor Actor) bool {
+	switch actor.Role {
+	case models.RoleAdmin, models.RoleSystem:
+		return true
+	case models.RoleDoctor:
+		return appointment.DoctorID == actor.ID
+	case models.RolePatient:
+		return appointment.PatientID == actor.ID
+	}
+	return false
+}
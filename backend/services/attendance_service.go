@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// attendanceLookback limits the sweep to recent appointments, so appointments
+// held before video attendance was tracked are left alone
+const attendanceLookback = 24 * time.Hour
+
+// AttendanceService records who joins each appointment's video room and
+// settles the appointment's outcome from it
+type AttendanceService struct {
+	DB                 *gorm.DB
+	AppointmentService *AppointmentService
+	// GracePeriod is how long after the start a participant may still join
+	GracePeriod time.Duration
+	// IdlePeriod is how long the room must stay empty before a call counts as over
+	IdlePeriod time.Duration
+	// RoomOpensBefore is how long before the start the video room opens
+	RoomOpensBefore time.Duration
+	// RoomClosesAfter is how long after the end the video room stays open
+	RoomClosesAfter time.Duration
+}
+
+// NewAttendanceService creates a new attendance service
+func NewAttendanceService() *AttendanceService {
+	return &AttendanceService{
+		DB:                 config.DB,
+		AppointmentService: NewAppointmentService(),
+		GracePeriod:        time.Duration(envInt("NO_SHOW_GRACE_MINUTES", 15)) * time.Minute,
+		IdlePeriod:         time.Duration(envInt("VIDEO_COMPLETION_IDLE_MINUTES", 5)) * time.Minute,
+		RoomOpensBefore:    time.Duration(envInt("VIDEO_ROOM_OPENS_MINUTES_BEFORE", 15)) * time.Minute,
+		RoomClosesAfter:    time.Duration(envInt("VIDEO_ROOM_CLOSES_MINUTES_AFTER", 15)) * time.Minute,
+	}
+}
+
+// presence is one participant's attendance worked out from room events
+type presence struct {
+	joined    bool
+	connected int
+	lastLeft  time.Time
+}
+
+// Errors returned when joining an appointment's video room
+var (
+	ErrRoomNotFound  = errors.New("video room not found")
+	ErrRoomForbidden = errors.New("you are not invited to this video room")
+	ErrRoomClosed    = errors.New("this video room is not open; it opens shortly before the appointment and closes when it ends")
+)
+
+// RoomAppointment finds the appointment a user is joining a video room for.
+// Every appointment has its own room. The patient, the doctor and invited
+// participants whose access has not ended may join while the room is open.
+func (as *AttendanceService) RoomAppointment(roomID string, userID uint) (*models.Appointment, error) {
+	var appointments []models.Appointment
+	if err := as.DB.Where("video_room_id = ?", roomID).Limit(1).Find(&appointments).Error; err != nil {
+		return nil, fmt.Errorf("failed to find the appointment for video room %s: %w", roomID, err)
+	}
+	if roomID == "" || len(appointments) == 0 {
+		return nil, ErrRoomNotFound
+	}
+	appointment := &appointments[0]
+
+	if appointment.PatientID != userID && appointment.DoctorID != userID {
+		if _, ok := ActiveParticipant(as.DB, appointment, userID); !ok {
+			return nil, ErrRoomForbidden
+		}
+	}
+	if !as.RoomOpen(appointment, time.Now()) {
+		return nil, ErrRoomClosed
+	}
+	return appointment, nil
+}
+
+// RoomOpen reports whether an appointment's video room can be used: from
+// RoomOpensBefore its start until RoomClosesAfter its end, unless the
+// appointment has been cancelled or settled
+func (as *AttendanceService) RoomOpen(appointment *models.Appointment, now time.Time) bool {
+	if appointment.Status != models.StatusScheduled && appointment.Status != models.StatusInProgress {
+		return false
+	}
+	return !now.Before(appointment.StartTime.Add(-as.RoomOpensBefore)) &&
+		now.Before(appointment.EndTime.Add(as.RoomClosesAfter))
+}
+
+// Record stores a join or leave event. Once both participants are connected
+// the appointment is started.
+func (as *AttendanceService) Record(appointmentID, userID uint, eventType models.VideoSessionEventType) {
+	var appointment models.Appointment
+	if err := as.DB.First(&appointment, appointmentID).Error; err != nil {
+		log.Printf("Failed to load appointment %d for attendance: %v", appointmentID, err)
+		return
+	}
+
+	event := models.VideoSessionEvent{
+		OrganizationID: appointment.OrganizationID,
+		AppointmentID:  appointment.ID,
+		UserID:         userID,
+		Type:           eventType,
+	}
+	if err := as.DB.Create(&event).Error; err != nil {
+		log.Printf("Failed to record video session event for appointment %d: %v", appointment.ID, err)
+		return
+	}
+
+	if eventType != models.VideoSessionJoined || appointment.Status != models.StatusScheduled {
+		return
+	}
+	attendance, err := as.attendance(appointment.ID)
+	if err != nil {
+		log.Printf("Failed to load attendance for appointment %d: %v", appointment.ID, err)
+		return
+	}
+	if attendance[appointment.PatientID].connected > 0 && attendance[appointment.DoctorID].connected > 0 {
+		as.transition(&appointment, models.StatusInProgress, "Both participants joined the video session")
+	}
+}
+
+// SettleAppointments marks appointments from attendance. Once the grace
+// period has passed, an appointment the doctor never joined is cancelled with
+// a full refund, and otherwise a patient who never joined is a no-show. A call
+// both joined is completed once the room has been empty for the idle period.
+func (as *AttendanceService) SettleAppointments() error {
+	now := time.Now()
+
+	var scheduled []models.Appointment
+	if err := as.DB.Where("status = ? AND start_time <= ? AND start_time > ?",
+		models.StatusScheduled, now.Add(-as.GracePeriod), now.Add(-attendanceLookback)).
+		Find(&scheduled).Error; err != nil {
+		return fmt.Errorf("failed to load scheduled appointments: %w", err)
+	}
+	for i := range scheduled {
+		appointment := &scheduled[i]
+		attendance, err := as.attendance(appointment.ID)
+		if err != nil {
+			log.Printf("Failed to load attendance for appointment %d: %v", appointment.ID, err)
+			continue
+		}
+		patient, doctor := attendance[appointment.PatientID], attendance[appointment.DoctorID]
+
+		// If neither joined, the doctor missed the visit too
+		switch {
+		case !doctor.joined:
+			log.Printf("Doctor missed appointment %d; cancelling it for a full refund", appointment.ID)
+			as.transition(appointment, models.StatusCancelled, "The doctor did not join the video session")
+		case !patient.joined:
+			as.transition(appointment, models.StatusNoShow, "The patient did not join the video session")
+		default:
+			// Both joined, but not at the same time
+			as.transition(appointment, models.StatusInProgress, "Both participants joined the video session")
+		}
+	}
+
+	var inProgress []models.Appointment
+	if err := as.DB.Where("status = ? AND start_time > ?", models.StatusInProgress, now.Add(-attendanceLookback)).
+		Find(&inProgress).Error; err != nil {
+		return fmt.Errorf("failed to load appointments in progress: %w", err)
+	}
+	for i := range inProgress {
+		appointment := &inProgress[i]
+		attendance, err := as.attendance(appointment.ID)
+		if err != nil {
+			log.Printf("Failed to load attendance for appointment %d: %v", appointment.ID, err)
+			continue
+		}
+		patient, doctor := attendance[appointment.PatientID], attendance[appointment.DoctorID]
+		if !patient.joined || !doctor.joined || patient.connected > 0 || doctor.connected > 0 {
+			continue
+		}
+
+		lastLeft := patient.lastLeft
+		if doctor.lastLeft.After(lastLeft) {
+			lastLeft = doctor.lastLeft
+		}
+		if now.Sub(lastLeft) >= as.IdlePeriod {
+			as.transition(appointment, models.StatusCompleted, "Both participants left the video session")
+		}
+	}
+
+	return nil
+}
+
+// attendance replays an appointment's room events into each participant's presence
+func (as *AttendanceService) attendance(appointmentID uint) (map[uint]presence, error) {
+	var events []models.VideoSessionEvent
+	if err := as.DB.Where("appointment_id = ?", appointmentID).
+		Order("created_at ASC, id ASC").Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	attendance := make(map[uint]presence)
+	for _, event := range events {
+		p := attendance[event.UserID]
+		switch event.Type {
+		case models.VideoSessionJoined:
+			p.joined = true
+			p.connected++
+		case models.VideoSessionLeft:
+			if p.connected > 0 {
+				p.connected--
+			}
+			p.lastLeft = event.CreatedAt
+		}
+		attendance[event.UserID] = p
+	}
+	return attendance, nil
+}
+
+// transition changes the appointment's status as the system. Losing a race
+// with a participant's own change is expected and not logged.
+func (as *AttendanceService) transition(appointment *models.Appointment, to models.AppointmentStatus, reason string) {
+	_, err := as.AppointmentService.Transition(context.Background(), appointment, to, SystemActor, reason)
+	if err != nil && !errors.Is(err, ErrTransitionConflict) && !errors.Is(err, ErrTransitionTooEarly) {
+		log.Printf("Failed to mark appointment %d %s: %v", appointment.ID, to, err)
+	}
+}
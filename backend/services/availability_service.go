@@ -0,0 +1,291 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// TimeRange is a half-open interval [Start, End)
+type TimeRange struct {
+	Start time.Time `json:"startTime"`
+	End   time.Time `json:"endTime"`
+}
+
+// Overlaps reports whether two ranges share any time
+func (r TimeRange) Overlaps(other TimeRange) bool {
+	return r.Start.Before(other.End) && other.Start.Before(r.End)
+}
+
+// Contains reports whether other lies entirely within r
+func (r TimeRange) Contains(other TimeRange) bool {
+	return !other.Start.Before(r.Start) && !other.End.After(r.End)
+}
+
+// AvailabilityService turns doctors' weekly hours and exceptions into bookable time
+type AvailabilityService struct {
+	DB *gorm.DB
+}
+
+// NewAvailabilityService creates a new availability service
+func NewAvailabilityService() *AvailabilityService {
+	return &AvailabilityService{
+		DB: config.DB,
+	}
+}
+
+// DoctorLocation returns the time zone a doctor's working hours are written in
+func (as *AvailabilityService) DoctorLocation(doctorID uint) *time.Location {
+	return userLocation(as.DB, doctorID)
+}
+
+// UserLocation returns the time zone a user reads dates in
+func (as *AvailabilityService) UserLocation(userID uint) *time.Location {
+	return userLocation(as.DB, userID)
+}
+
+// userLocation returns a user's preferred time zone, or UTC if they have not set one
+func userLocation(db *gorm.DB, userID uint) *time.Location {
+	var saved []models.UserPreferences
+	if err := db.Where("user_id = ?", userID).Limit(1).Find(&saved).Error; err != nil || len(saved) == 0 {
+		return time.UTC
+	}
+	return saved[0].Location()
+}
+
+// WorkingWindows returns the doctor's working time between from and to
+func (as *AvailabilityService) WorkingWindows(ctx context.Context, doctorID uint, from, to time.Time) ([]TimeRange, error) {
+	windows, err := as.dayWindows(ctx, doctorID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// Trim to the requested range
+	requested := TimeRange{Start: from, End: to}
+	trimmed := []TimeRange{}
+	for _, window := range windows {
+		if !window.Overlaps(requested) {
+			continue
+		}
+		if window.Start.Before(from) {
+			window.Start = from
+		}
+		if window.End.After(to) {
+			window.End = to
+		}
+		trimmed = append(trimmed, window)
+	}
+	return trimmed, nil
+}
+
+// dayWindows returns the doctor's untrimmed working windows on every day the
+// range touches, in the doctor's time zone
+func (as *AvailabilityService) dayWindows(ctx context.Context, doctorID uint, from, to time.Time) ([]TimeRange, error) {
+	db := as.DB.WithContext(ctx)
+	location := as.DoctorLocation(doctorID)
+
+	var rules []models.AvailabilityRule
+	if err := db.Where("doctor_id = ?", doctorID).Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("failed to load availability rules: %w", err)
+	}
+
+	// Cover whole days in the doctor's time zone
+	firstDay := from.In(location)
+	firstDay = time.Date(firstDay.Year(), firstDay.Month(), firstDay.Day(), 0, 0, 0, 0, location)
+	lastDay := to.In(location)
+
+	var exceptions []models.AvailabilityException
+	if err := db.Where("doctor_id = ? AND date BETWEEN ? AND ?", doctorID,
+		firstDay.Format(models.ExceptionDateFormat), lastDay.Format(models.ExceptionDateFormat)).
+		Find(&exceptions).Error; err != nil {
+		return nil, fmt.Errorf("failed to load availability exceptions: %w", err)
+	}
+	exceptionsByDate := make(map[string][]models.AvailabilityException)
+	for _, exception := range exceptions {
+		exceptionsByDate[exception.Date] = append(exceptionsByDate[exception.Date], exception)
+	}
+
+	var windows []TimeRange
+	for day := firstDay; !day.After(lastDay); day = day.AddDate(0, 0, 1) {
+		var dayWindows []TimeRange
+		for _, rule := range rules {
+			if rule.Weekday == day.Weekday() {
+				if window, ok := clockWindow(day, rule.StartTime, rule.EndTime); ok {
+					dayWindows = append(dayWindows, window)
+				}
+			}
+		}
+
+		// Available exceptions add hours, unavailable ones take them away
+		dayExceptions := exceptionsByDate[day.Format(models.ExceptionDateFormat)]
+		for _, exception := range dayExceptions {
+			if exception.Available {
+				if window, ok := clockWindow(day, exception.StartTime, exception.EndTime); ok {
+					dayWindows = append(dayWindows, window)
+				}
+			}
+		}
+		dayWindows = mergeRanges(dayWindows)
+		for _, exception := range dayExceptions {
+			if exception.Available {
+				continue
+			}
+			if exception.IsWholeDay() {
+				dayWindows = nil
+				break
+			}
+			if window, ok := clockWindow(day, exception.StartTime, exception.EndTime); ok {
+				dayWindows = subtractRange(dayWindows, window)
+			}
+		}
+
+		windows = append(windows, dayWindows...)
+	}
+	return windows, nil
+}
+
+// FreeSlots splits the doctor's working time into slots of the given length
+// and drops slots that break the doctor's scheduling rules: too soon, too far
+// ahead, too close to an existing booking, or on a day that is fully booked
+func (as *AvailabilityService) FreeSlots(ctx context.Context, doctorID uint, from, to time.Time, length time.Duration) ([]TimeRange, error) {
+	windows, err := as.dayWindows(ctx, doctorID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := as.SchedulingRules(ctx, doctorID)
+	if err != nil {
+		return nil, err
+	}
+	before, after := rules.BufferBefore(), rules.BufferAfter()
+
+	booked, err := as.bookedRanges(ctx, doctorID, from.Add(-before-after), to.Add(before+after))
+	if err != nil {
+		return nil, err
+	}
+
+	location := as.DoctorLocation(doctorID)
+	var counts map[string]int
+	if rules.MaxPerDay > 0 {
+		if counts, err = as.dailyCounts(ctx, doctorID, location, from, to); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	earliest := rules.Earliest(now)
+	latest, limited := rules.Latest(now)
+	requested := TimeRange{Start: from, End: to}
+	slots := []TimeRange{}
+	for _, window := range windows {
+		// Slots start on the window's own grid, so a 09:00 window yields 09:00, 09:30, ...
+		for start := window.Start; !start.Add(length).After(window.End); start = start.Add(length) {
+			slot := TimeRange{Start: start, End: start.Add(length)}
+			switch {
+			case slot.Start.Before(earliest), limited && slot.Start.After(latest):
+				continue
+			case !requested.Contains(slot), tooClose(slot, booked, before, after):
+				continue
+			case rules.MaxPerDay > 0 && counts[slot.Start.In(location).Format(dayKey)] >= rules.MaxPerDay:
+				continue
+			}
+			slots = append(slots, slot)
+		}
+	}
+	return slots, nil
+}
+
+// IsAvailable reports whether a booking lies entirely within the doctor's working time
+func (as *AvailabilityService) IsAvailable(ctx context.Context, doctorID uint, start, end time.Time) (bool, error) {
+	windows, err := as.dayWindows(ctx, doctorID, start, end)
+	if err != nil {
+		return false, err
+	}
+
+	return withinAny(TimeRange{Start: start, End: end}, windows), nil
+}
+
+// bookedRanges returns the doctor's active appointments between from and to,
+// leaving out the appointments in ignore
+func (as *AvailabilityService) bookedRanges(ctx context.Context, doctorID uint, from, to time.Time, ignore ...uint) ([]TimeRange, error) {
+	var appointments []models.Appointment
+	if err := as.DB.WithContext(ctx).Select("start_time", "end_time").Scopes(blocksSlot, ignoring(ignore)).
+		Where("doctor_id = ? AND start_time < ? AND end_time > ?", doctorID, to, from).
+		Find(&appointments).Error; err != nil {
+		return nil, fmt.Errorf("failed to load booked appointments: %w", err)
+	}
+
+	booked := make([]TimeRange, len(appointments))
+	for i, appointment := range appointments {
+		booked[i] = TimeRange{Start: appointment.StartTime, End: appointment.EndTime}
+	}
+	return booked, nil
+}
+
+// clockWindow builds the range between two HH:MM times on a day
+func clockWindow(day time.Time, startClock, endClock string) (TimeRange, bool) {
+	start, okStart := models.ParseClock(startClock)
+	end, okEnd := models.ParseClock(endClock)
+	if !okStart || !okEnd || start >= end {
+		return TimeRange{}, false
+	}
+	return TimeRange{
+		Start: time.Date(day.Year(), day.Month(), day.Day(), start/60, start%60, 0, 0, day.Location()),
+		End:   time.Date(day.Year(), day.Month(), day.Day(), end/60, end%60, 0, 0, day.Location()),
+	}, true
+}
+
+// mergeRanges sorts ranges and joins those that touch or overlap
+func mergeRanges(ranges []TimeRange) []TimeRange {
+	if len(ranges) < 2 {
+		return ranges
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start.Before(ranges[j].Start) })
+
+	merged := []TimeRange{ranges[0]}
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if !r.Start.After(last.End) {
+			if r.End.After(last.End) {
+				last.End = r.End
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// subtractRange removes a range from each of the given ranges
+func subtractRange(ranges []TimeRange, removed TimeRange) []TimeRange {
+	var result []TimeRange
+	for _, r := range ranges {
+		if !r.Overlaps(removed) {
+			result = append(result, r)
+			continue
+		}
+		if r.Start.Before(removed.Start) {
+			result = append(result, TimeRange{Start: r.Start, End: removed.Start})
+		}
+		if r.End.After(removed.End) {
+			result = append(result, TimeRange{Start: removed.End, End: r.End})
+		}
+	}
+	return result
+}
+
+// overlapsAny reports whether a range overlaps any of the others
+func overlapsAny(r TimeRange, others []TimeRange) bool {
+	for _, other := range others {
+		if r.Overlaps(other) {
+			return true
+		}
+	}
+	return false
+}
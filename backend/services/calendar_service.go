@@ -0,0 +1,170 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// ErrFeedNotFound is returned for an unknown or revoked feed token
+var ErrFeedNotFound = errors.New("calendar feed not found")
+
+// feedHistory is how far back a calendar feed lists appointments
+const feedHistory = 30 * 24 * time.Hour
+
+// CalendarService turns appointments into iCalendar files and per-user feeds
+type CalendarService struct {
+	DB         *gorm.DB
+	BackendURL string
+}
+
+// NewCalendarService creates a new calendar service
+func NewCalendarService() *CalendarService {
+	return &CalendarService{
+		DB:         config.DB,
+		BackendURL: os.Getenv("BACKEND_URL"),
+	}
+}
+
+// AppointmentCalendar returns a single appointment as seen by one of its
+// participants, in that participant's time zone. The appointment's Patient
+// and Doctor must be loaded.
+func (cs *CalendarService) AppointmentCalendar(appointment *models.Appointment, viewer *models.User) *Calendar {
+	sequences := cs.sequences([]uint{appointment.ID})
+	return &Calendar{
+		Method:   "PUBLISH",
+		Location: userLocation(cs.DB, viewer.ID),
+		Events:   []CalendarEvent{appointmentEvent(appointment, viewer, sequences[appointment.ID])},
+	}
+}
+
+// FeedURL returns the subscription link for a feed
+func (cs *CalendarService) FeedURL(feed *models.CalendarFeed) string {
+	return fmt.Sprintf("%s/api/v1/calendar/%s.ics", cs.BackendURL, feed.Token)
+}
+
+// EnsureFeed returns the user's feed, creating one on first use
+func (cs *CalendarService) EnsureFeed(userID uint) (*models.CalendarFeed, error) {
+	var feeds []models.CalendarFeed
+	if err := cs.DB.Where("user_id = ?", userID).Limit(1).Find(&feeds).Error; err != nil {
+		return nil, fmt.Errorf("failed to load calendar feed: %w", err)
+	}
+	if len(feeds) > 0 {
+		return &feeds[0], nil
+	}
+	return cs.RotateFeed(userID)
+}
+
+// RotateFeed gives the user a new feed token; the old link stops working
+func (cs *CalendarService) RotateFeed(userID uint) (*models.CalendarFeed, error) {
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	feed := models.CalendarFeed{UserID: userID}
+	if err := cs.DB.Where(models.CalendarFeed{UserID: userID}).
+		Assign(models.CalendarFeed{Token: token}).
+		FirstOrCreate(&feed).Error; err != nil {
+		return nil, fmt.Errorf("failed to save calendar feed: %w", err)
+	}
+	return &feed, nil
+}
+
+// Feed returns the calendar behind a feed token: the owner's appointments
+// from the last 30 days onwards, in every organization. Cancelled
+// appointments stay in the feed marked as cancelled so clients remove them.
+func (cs *CalendarService) Feed(token string) (*Calendar, error) {
+	var feed models.CalendarFeed
+	if err := cs.DB.Preload("User").Where("token = ?", token).First(&feed).Error; err != nil {
+		return nil, ErrFeedNotFound
+	}
+
+	var appointments []models.Appointment
+	if err := cs.DB.Preload("Patient").Preload("Doctor").
+		Where("(patient_id = ? OR doctor_id = ?) AND end_time > ?", feed.UserID, feed.UserID, time.Now().Add(-feedHistory)).
+		Order("start_time ASC").Find(&appointments).Error; err != nil {
+		return nil, fmt.Errorf("failed to load appointments: %w", err)
+	}
+
+	ids := make([]uint, len(appointments))
+	for i, appointment := range appointments {
+		ids[i] = appointment.ID
+	}
+	sequences := cs.sequences(ids)
+
+	events := make([]CalendarEvent, len(appointments))
+	for i := range appointments {
+		events[i] = appointmentEvent(&appointments[i], &feed.User, sequences[appointments[i].ID])
+	}
+
+	return &Calendar{
+		Name:     "Telehealth appointments",
+		Location: userLocation(cs.DB, feed.UserID),
+		Events:   events,
+	}, nil
+}
+
+// sequences counts each appointment's reschedules and status changes, which
+// tells calendar clients which copy of an event is newest
+func (cs *CalendarService) sequences(ids []uint) map[uint]int {
+	sequences := make(map[uint]int, len(ids))
+	if len(ids) == 0 {
+		return sequences
+	}
+
+	type count struct {
+		AppointmentID uint
+		Changes       int
+	}
+	for _, model := range []interface{}{&models.AppointmentReschedule{}, &models.AppointmentStatusChange{}} {
+		var counts []count
+		if err := cs.DB.Model(model).Select("appointment_id, COUNT(*) AS changes").
+			Where("appointment_id IN ?", ids).Group("appointment_id").Scan(&counts).Error; err != nil {
+			continue
+		}
+		for _, c := range counts {
+			sequences[c.AppointmentID] += c.Changes
+		}
+	}
+	return sequences
+}
+
+// appointmentEvent describes an appointment from one participant's side.
+// The visit reason is left out because calendars are often shared.
+func appointmentEvent(appointment *models.Appointment, viewer *models.User, sequence int) CalendarEvent {
+	summary := fmt.Sprintf("Telehealth appointment with Dr. %s %s", appointment.Doctor.FirstName, appointment.Doctor.LastName)
+	if viewer.ID == appointment.DoctorID {
+		summary = fmt.Sprintf("Telehealth appointment with %s", shortName(&appointment.Patient))
+	}
+
+	videoLink := VideoLink(appointment.ID)
+	return CalendarEvent{
+		UID:          fmt.Sprintf("appointment-%d@yourtelehealth.com", appointment.ID),
+		Summary:      summary,
+		Description:  "Join the video call: " + videoLink,
+		Location:     videoLink,
+		URL:          videoLink,
+		Start:        appointment.StartTime,
+		End:          appointment.EndTime,
+		LastModified: appointment.UpdatedAt,
+		Sequence:     sequence,
+		Cancelled:    appointment.Status == models.StatusCancelled,
+		Tentative:    appointment.Status == models.StatusHeld,
+	}
+}
+
+// shortName returns a first name and last initial
+func shortName(user *models.User) string {
+	lastName := []rune(user.LastName)
+	if len(lastName) == 0 {
+		return user.FirstName
+	}
+	return fmt.Sprintf("%s %s.", user.FirstName, string(lastName[0]))
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"fmt"
+	"math"
+
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// DefaultCancellationPolicy applies when neither the clinic nor the doctor has set a policy
+func DefaultCancellationPolicy(organizationID uint) models.CancellationPolicy {
+	return models.CancellationPolicy{
+		OrganizationID:       organizationID,
+		FullRefundHours:      envInt("CANCELLATION_FULL_REFUND_HOURS", 24),
+		PartialRefundPercent: envInt("CANCELLATION_PARTIAL_REFUND_PERCENT", 50),
+	}
+}
+
+// EffectiveCancellationPolicy returns the doctor's policy, else the clinic's, else the default
+func EffectiveCancellationPolicy(db *gorm.DB, organizationID, doctorID uint) (models.CancellationPolicy, error) {
+	var policies []models.CancellationPolicy
+	if err := db.Where("organization_id = ? AND doctor_id IN ?", organizationID, []uint{0, doctorID}).
+		Order("doctor_id DESC").Limit(1).Find(&policies).Error; err != nil {
+		return models.CancellationPolicy{}, fmt.Errorf("failed to load cancellation policy: %w", err)
+	}
+	if len(policies) == 0 {
+		return DefaultCancellationPolicy(organizationID), nil
+	}
+	return policies[0], nil
+}
+
+// refundAmount returns percent of amount, rounded to the cent
+func refundAmount(amount float64, percent int) float64 {
+	return math.Round(amount*float64(percent)) / 100
+}
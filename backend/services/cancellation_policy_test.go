@@ -0,0 +1,24 @@
+package services
+
+import "testing"
+
+func TestRefundAmount(t *testing.T) {
+	tests := []struct {
+		amount  float64
+		percent int
+		want    float64
+	}{
+		{100, 100, 100},
+		{100, 50, 50},
+		{100, 0, 0},
+		{50000, 25, 12500},
+		{19.98, 50, 9.99},
+		{10.01, 33, 3.3},
+		{0.05, 50, 0.03},
+	}
+	for _, tt := range tests {
+		if got := refundAmount(tt.amount, tt.percent); got != tt.want {
+			t.Errorf("refundAmount(%v, %d) = %v, want %v", tt.amount, tt.percent, got, tt.want)
+		}
+	}
+}
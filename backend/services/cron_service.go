@@ -5,23 +5,34 @@ import (
 	//"time"
 
 	"github.com/robfig/cron/v3"
-	"gorm.io/gorm"
+	
+	"github.com/adrianmcmains/telehealth-platform/config"
 )
 
 // CronService handles scheduled tasks
 type CronService struct {
 	cron *cron.Cron
 	notificationService *NotificationService
+	exportService *ExportService
+	retentionService *RetentionService
+	waitlistService *WaitlistService
+	attendanceService *AttendanceService
+	appointmentService *AppointmentService
 }
 
 // NewCronService creates a new cron service
 func NewCronService() *CronService {
 	c := cron.New(cron.WithSeconds())
-	notificationService := NewNotificationService(&gorm.DB{})
+	notificationService := NewNotificationService(config.DB)
 	
 	return &CronService{
 		cron: c,
 		notificationService: notificationService,
+		exportService: NewExportService(),
+		retentionService: NewRetentionService(),
+		waitlistService: NewWaitlistService(),
+		attendanceService: NewAttendanceService(),
+		appointmentService: NewAppointmentService(),
 	}
 }
 
@@ -40,6 +51,98 @@ func (cs *CronService) Start() {
 		log.Printf("Error scheduling appointment reminders: %v", err)
 	}
 	
+	// Deliver notifications held back for quiet hours every five minutes
+	_, err = cs.cron.AddFunc("0 */5 * * * *", func() {
+		if err := cs.notificationService.DeliverPendingNotifications(); err != nil {
+			log.Printf("Error delivering pending notifications: %v", err)
+		}
+	})
+	
+	if err != nil {
+		log.Printf("Error scheduling pending notification delivery: %v", err)
+	}
+	
+	// Build data exports that were never started or were interrupted every five minutes
+	_, err = cs.cron.AddFunc("0 */5 * * * *", func() {
+		if err := cs.exportService.ResumeExports(); err != nil {
+			log.Printf("Error resuming data exports: %v", err)
+		}
+	})
+	
+	if err != nil {
+		log.Printf("Error scheduling data export recovery: %v", err)
+	}
+	
+	// Remove expired data export archives every hour
+	_, err = cs.cron.AddFunc("0 0 * * * *", func() {
+		if err := cs.exportService.CleanupExpiredExports(); err != nil {
+			log.Printf("Error cleaning up expired data exports: %v", err)
+		}
+	})
+	
+	if err != nil {
+		log.Printf("Error scheduling data export cleanup: %v", err)
+	}
+	
+	// Anonymize accounts past their cooling-off period and purge expired records daily at 2:00 AM
+	_, err = cs.cron.AddFunc("0 0 2 * * *", func() {
+		log.Println("Running account deletion and retention jobs")
+		if err := cs.retentionService.ProcessDueDeletions(); err != nil {
+			log.Printf("Error processing account deletions: %v", err)
+		}
+		if err := cs.retentionService.PurgeExpiredRecords(); err != nil {
+			log.Printf("Error purging expired records: %v", err)
+		}
+	})
+	
+	if err != nil {
+		log.Printf("Error scheduling retention jobs: %v", err)
+	}
+	
+	// Pass unclaimed waitlist offers on to the next patient every minute
+	_, err = cs.cron.AddFunc("0 * * * * *", func() {
+		if err := cs.waitlistService.ExpireOffers(); err != nil {
+			log.Printf("Error expiring waitlist offers: %v", err)
+		}
+	})
+	
+	if err != nil {
+		log.Printf("Error scheduling waitlist offer expiry: %v", err)
+	}
+	
+	// Mark no-shows and finished calls from video attendance every minute
+	_, err = cs.cron.AddFunc("30 * * * * *", func() {
+		if err := cs.attendanceService.SettleAppointments(); err != nil {
+			log.Printf("Error settling appointments from attendance: %v", err)
+		}
+	})
+	
+	if err != nil {
+		log.Printf("Error scheduling attendance checks: %v", err)
+	}
+	
+	// Release slots held for checkouts that never completed every minute
+	_, err = cs.cron.AddFunc("15 * * * * *", func() {
+		if err := cs.appointmentService.ExpireHolds(); err != nil {
+			log.Printf("Error releasing expired slot holds: %v", err)
+		}
+	})
+	
+	if err != nil {
+		log.Printf("Error scheduling slot hold expiry: %v", err)
+	}
+	
+	// Retry refunds the payment provider has not accepted yet every five minutes
+	_, err = cs.cron.AddFunc("0 */5 * * * *", func() {
+		if err := cs.appointmentService.RetryRefunds(); err != nil {
+			log.Printf("Error retrying refunds: %v", err)
+		}
+	})
+	
+	if err != nil {
+		log.Printf("Error scheduling refund retries: %v", err)
+	}
+	
 	// Add more scheduled tasks here as needed
 	
 	cs.cron.Start()
@@ -0,0 +1,512 @@
+package services
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// ExportService builds downloadable archives of everything we hold about a user
+type ExportService struct {
+	DB                  *gorm.DB
+	NotificationService *NotificationService
+	ExportDir           string
+	LinkTTL             time.Duration
+	// StaleAfter is how long an export may stay processing before it is
+	// assumed interrupted and started again
+	StaleAfter time.Duration
+	BackendURL string
+}
+
+// NewExportService creates a new export service
+func NewExportService() *ExportService {
+	exportDir := os.Getenv("EXPORT_DIR")
+	if exportDir == "" {
+		exportDir = "exports"
+	}
+
+	return &ExportService{
+		DB:                  config.DB,
+		NotificationService: NewNotificationService(config.DB),
+		ExportDir:           exportDir,
+		LinkTTL:             time.Duration(envInt("EXPORT_LINK_TTL_HOURS", 48)) * time.Hour,
+		StaleAfter:          time.Duration(envInt("EXPORT_STALE_MINUTES", 30)) * time.Minute,
+		BackendURL:          os.Getenv("BACKEND_URL"),
+	}
+}
+
+// RequestExport queues a new export for a user, reusing one that is still in progress
+func (es *ExportService) RequestExport(userID uint) (*models.DataExport, error) {
+	var existing models.DataExport
+	err := es.DB.Where("user_id = ? AND status IN ?", userID,
+		[]models.DataExportStatus{models.ExportStatusPending, models.ExportStatusProcessing}).
+		First(&existing).Error
+	if err == nil {
+		return &existing, nil
+	}
+
+	export := models.DataExport{
+		UserID: userID,
+		Status: models.ExportStatusPending,
+	}
+	if err := es.DB.Create(&export).Error; err != nil {
+		return nil, fmt.Errorf("failed to create export: %w", err)
+	}
+
+	// Build the archive in the background; ResumeExports picks it up if this
+	// process stops first
+	go es.ProcessExport(export.ID)
+
+	return &export, nil
+}
+
+// ProcessExport generates the archive for an export and notifies the user.
+// It does nothing if another run is already working on the export.
+func (es *ExportService) ProcessExport(exportID uint) {
+	// Claim the export so only one run builds it; a run that stalled longer
+	// than StaleAfter ago can be taken over
+	result := es.DB.Model(&models.DataExport{}).
+		Where("id = ? AND (status = ? OR (status = ? AND updated_at < ?))", exportID,
+			models.ExportStatusPending, models.ExportStatusProcessing, time.Now().Add(-es.StaleAfter)).
+		Updates(map[string]interface{}{"status": models.ExportStatusProcessing, "updated_at": time.Now()})
+	if result.Error != nil {
+		log.Printf("Failed to start export %d: %v", exportID, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+
+	var export models.DataExport
+	if err := es.DB.First(&export, exportID).Error; err != nil {
+		log.Printf("Failed to load export %d: %v", exportID, err)
+		return
+	}
+
+	var user models.User
+	if err := es.DB.First(&user, export.UserID).Error; err != nil {
+		es.failExport(&export, fmt.Errorf("failed to load user: %w", err))
+		return
+	}
+
+	if err := os.MkdirAll(es.ExportDir, 0o700); err != nil {
+		es.failExport(&export, fmt.Errorf("failed to create export directory: %w", err))
+		return
+	}
+
+	token, err := generateExportToken()
+	if err != nil {
+		es.failExport(&export, err)
+		return
+	}
+
+	filePath := filepath.Join(es.ExportDir, fmt.Sprintf("export-%d-%d.zip", user.ID, export.ID))
+	if err := es.writeArchive(&user, filePath); err != nil {
+		os.Remove(filePath)
+		es.failExport(&export, err)
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(es.LinkTTL)
+	export.Status = models.ExportStatusReady
+	export.FilePath = filePath
+	export.Token = token
+	export.CompletedAt = &now
+	export.ExpiresAt = &expiresAt
+	if err := es.DB.Save(&export).Error; err != nil {
+		log.Printf("Failed to save export %d: %v", export.ID, err)
+		return
+	}
+
+	es.NotificationService.SendDataExportNotification(&user, es.DownloadURL(&export), expiresAt)
+}
+
+// ResumeExports builds exports that were never started or whose run stopped
+// partway, such as when the server restarted
+func (es *ExportService) ResumeExports() error {
+	var exports []models.DataExport
+	if err := es.DB.Select("id").
+		Where("status = ? OR (status = ? AND updated_at < ?)",
+			models.ExportStatusPending, models.ExportStatusProcessing, time.Now().Add(-es.StaleAfter)).
+		Order("created_at ASC").Find(&exports).Error; err != nil {
+		return fmt.Errorf("failed to fetch unfinished exports: %w", err)
+	}
+
+	for _, export := range exports {
+		es.ProcessExport(export.ID)
+	}
+
+	return nil
+}
+
+// DownloadURL returns the expiring download link for a ready export
+func (es *ExportService) DownloadURL(export *models.DataExport) string {
+	return fmt.Sprintf("%s/api/v1/exports/%d/download?token=%s", es.BackendURL, export.ID, export.Token)
+}
+
+// CleanupExpiredExports deletes archives whose download links have expired
+func (es *ExportService) CleanupExpiredExports() error {
+	var exports []models.DataExport
+	if err := es.DB.Where("status = ? AND expires_at < ?", models.ExportStatusReady, time.Now()).
+		Find(&exports).Error; err != nil {
+		return fmt.Errorf("failed to fetch expired exports: %w", err)
+	}
+
+	for _, export := range exports {
+		if err := os.Remove(export.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove export file %s: %v", export.FilePath, err)
+			continue
+		}
+		export.Status = models.ExportStatusExpired
+		export.FilePath = ""
+		export.Token = ""
+		es.DB.Save(&export)
+	}
+
+	return nil
+}
+
+// failExport marks an export as failed
+func (es *ExportService) failExport(export *models.DataExport, err error) {
+	log.Printf("Export %d failed: %v", export.ID, err)
+	export.Status = models.ExportStatusFailed
+	export.Error = err.Error()
+	es.DB.Save(export)
+}
+
+// writeArchive collects the user's data and writes it to a zip file. Only
+// appointments where the user is the patient are included: a doctor's
+// appointments hold other patients' health information.
+func (es *ExportService) writeArchive(user *models.User, filePath string) error {
+	var appointments []models.Appointment
+	if err := es.DB.Preload("Patient").Preload("Doctor").
+		Where("patient_id = ?", user.ID).
+		Order("start_time ASC").Find(&appointments).Error; err != nil {
+		return fmt.Errorf("failed to load appointments: %w", err)
+	}
+
+	appointmentIDs := make([]uint, len(appointments))
+	for i, appt := range appointments {
+		appointmentIDs[i] = appt.ID
+	}
+
+	var payments []models.Payment
+	if len(appointmentIDs) > 0 {
+		if err := es.DB.Where("appointment_id IN ?", appointmentIDs).
+			Order("created_at ASC").Find(&payments).Error; err != nil {
+			return fmt.Errorf("failed to load payments: %w", err)
+		}
+	}
+
+	var statusChanges []models.AppointmentStatusChange
+	var reschedules []models.AppointmentReschedule
+	if len(appointmentIDs) > 0 {
+		if err := es.DB.Where("appointment_id IN ?", appointmentIDs).
+			Order("created_at ASC").Find(&statusChanges).Error; err != nil {
+			return fmt.Errorf("failed to load status history: %w", err)
+		}
+		if err := es.DB.Where("appointment_id IN ?", appointmentIDs).
+			Order("created_at ASC").Find(&reschedules).Error; err != nil {
+			return fmt.Errorf("failed to load reschedules: %w", err)
+		}
+	}
+
+	var intake []models.IntakeResponse
+	if err := es.DB.Preload("QuestionnaireVersion").Where("patient_id = ?", user.ID).
+		Order("created_at ASC").Find(&intake).Error; err != nil {
+		return fmt.Errorf("failed to load intake answers: %w", err)
+	}
+
+	var reviews []models.Review
+	if err := es.DB.Where("patient_id = ?", user.ID).
+		Order("created_at ASC").Find(&reviews).Error; err != nil {
+		return fmt.Errorf("failed to load reviews: %w", err)
+	}
+
+	var waitlist []models.WaitlistEntry
+	if err := es.DB.Where("patient_id = ?", user.ID).
+		Order("created_at ASC").Find(&waitlist).Error; err != nil {
+		return fmt.Errorf("failed to load waitlist entries: %w", err)
+	}
+
+	var preferences []models.UserPreferences
+	if err := es.DB.Where("user_id = ?", user.ID).Limit(1).Find(&preferences).Error; err != nil {
+		return fmt.Errorf("failed to load preferences: %w", err)
+	}
+
+	var notifications []models.NotificationLog
+	if err := es.DB.Where("user_id = ?", user.ID).
+		Order("created_at ASC").Find(&notifications).Error; err != nil {
+		return fmt.Errorf("failed to load notification history: %w", err)
+	}
+
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+
+	// Machine-readable copies of each record type
+	files := map[string]interface{}{
+		"profile.json":                    exportProfile(user),
+		"appointments.json":               exportAppointments(appointments),
+		"appointment_status_history.json": statusChanges,
+		"appointment_reschedules.json":    reschedules,
+		"intake_forms.json":               exportIntakeResponses(intake),
+		"payments.json":                   exportPayments(payments),
+		"reviews.json":                    exportReviews(reviews),
+		"waitlist.json":                   exportWaitlist(waitlist),
+		"preferences.json":                preferences,
+		"notifications.json":              notifications,
+	}
+	for name, content := range files {
+		if err := writeJSONEntry(archive, name, content); err != nil {
+			return err
+		}
+	}
+
+	// Human-readable summary
+	summary, err := archive.Create("summary.txt")
+	if err != nil {
+		return fmt.Errorf("failed to add summary: %w", err)
+	}
+	writeSummary(summary, user, appointments, intake, payments, notifications)
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to finalize archive: %w", err)
+	}
+
+	return nil
+}
+
+// exportProfile returns the profile fields included in an export
+func exportProfile(user *models.User) map[string]interface{} {
+	return map[string]interface{}{
+		"id":               user.ID,
+		"email":            user.Email,
+		"firstName":        user.FirstName,
+		"lastName":         user.LastName,
+		"role":             user.Role,
+		"dateOfBirth":      user.DateOfBirth,
+		"phoneNumber":      user.PhoneNumber,
+		"address":          user.Address,
+		"twoFactorEnabled": user.TwoFactorEnabled,
+		"createdAt":        user.CreatedAt,
+		"updatedAt":        user.UpdatedAt,
+	}
+}
+
+// exportAppointments returns the appointment fields included in an export
+func exportAppointments(appointments []models.Appointment) []map[string]interface{} {
+	records := make([]map[string]interface{}, len(appointments))
+	for i, appt := range appointments {
+		records[i] = map[string]interface{}{
+			"id":        appt.ID,
+			"startTime": appt.StartTime,
+			"endTime":   appt.EndTime,
+			"status":    appt.Status,
+			"reason":    appt.Reason,
+			"notes":     appt.Notes,
+			"isPaid":    appt.IsPaid,
+			"price":     appt.Price,
+			"createdAt": appt.CreatedAt,
+			"patient":   fmt.Sprintf("%s %s", appt.Patient.FirstName, appt.Patient.LastName),
+			"doctor":    fmt.Sprintf("Dr. %s %s", appt.Doctor.FirstName, appt.Doctor.LastName),
+		}
+	}
+	return records
+}
+
+// exportIntakeResponses returns each intake form with its answers labelled by
+// the questions they were given against
+func exportIntakeResponses(responses []models.IntakeResponse) []map[string]interface{} {
+	records := make([]map[string]interface{}, len(responses))
+	for i, response := range responses {
+		answers := make([]map[string]interface{}, 0, len(response.Answers))
+		for _, question := range response.QuestionnaireVersion.Questions {
+			if answer, ok := response.Answers[question.ID]; ok {
+				answers = append(answers, map[string]interface{}{
+					"questionId": question.ID,
+					"question":   question.Label,
+					"answer":     answer,
+				})
+			}
+		}
+		records[i] = map[string]interface{}{
+			"id":            response.ID,
+			"appointmentId": response.AppointmentID,
+			"answers":       answers,
+			"submittedAt":   response.UpdatedAt,
+		}
+	}
+	return records
+}
+
+// exportReviews returns the review fields included in an export
+func exportReviews(reviews []models.Review) []map[string]interface{} {
+	records := make([]map[string]interface{}, len(reviews))
+	for i, review := range reviews {
+		records[i] = map[string]interface{}{
+			"id":            review.ID,
+			"appointmentId": review.AppointmentID,
+			"doctorId":      review.DoctorID,
+			"rating":        review.Rating,
+			"comment":       review.Comment,
+			"doctorReply":   review.DoctorReply,
+			"status":        review.Status,
+			"createdAt":     review.CreatedAt,
+		}
+	}
+	return records
+}
+
+// exportWaitlist returns the waitlist entry fields included in an export
+func exportWaitlist(entries []models.WaitlistEntry) []map[string]interface{} {
+	records := make([]map[string]interface{}, len(entries))
+	for i, entry := range entries {
+		records[i] = map[string]interface{}{
+			"id":            entry.ID,
+			"doctorId":      entry.DoctorID,
+			"fromDate":      entry.FromDate,
+			"toDate":        entry.ToDate,
+			"reason":        entry.Reason,
+			"status":        entry.Status,
+			"appointmentId": entry.AppointmentID,
+			"createdAt":     entry.CreatedAt,
+		}
+	}
+	return records
+}
+
+// exportPayments returns the payment fields included in an export
+func exportPayments(payments []models.Payment) []map[string]interface{} {
+	records := make([]map[string]interface{}, len(payments))
+	for i, payment := range payments {
+		records[i] = map[string]interface{}{
+			"id":            payment.ID,
+			"appointmentId": payment.AppointmentID,
+			"amount":        payment.Amount,
+			"status":        payment.Status,
+			"paymentMethod": payment.PaymentMethod,
+			"createdAt":     payment.CreatedAt,
+			"updatedAt":     payment.UpdatedAt,
+		}
+	}
+	return records
+}
+
+// writeJSONEntry adds an indented JSON file to the archive
+func writeJSONEntry(archive *zip.Writer, name string, content interface{}) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(content); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// writeSummary writes a plain-text overview of the exported data
+func writeSummary(w io.Writer, user *models.User, appointments []models.Appointment, intake []models.IntakeResponse, payments []models.Payment, notifications []models.NotificationLog) {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Telehealth Platform - Personal Data Export\n")
+	fmt.Fprintf(&b, "Generated: %s\n\n", time.Now().UTC().Format("January 2, 2006 15:04 MST"))
+
+	fmt.Fprintf(&b, "PROFILE\n")
+	fmt.Fprintf(&b, "  Name:          %s %s\n", user.FirstName, user.LastName)
+	fmt.Fprintf(&b, "  Email:         %s\n", user.Email)
+	fmt.Fprintf(&b, "  Role:          %s\n", user.Role)
+	if user.DateOfBirth != nil {
+		fmt.Fprintf(&b, "  Date of birth: %s\n", user.DateOfBirth.Format("January 2, 2006"))
+	}
+	if user.PhoneNumber != "" {
+		fmt.Fprintf(&b, "  Phone:         %s\n", user.PhoneNumber)
+	}
+	if user.Address != "" {
+		fmt.Fprintf(&b, "  Address:       %s\n", user.Address)
+	}
+	fmt.Fprintf(&b, "  Member since:  %s\n\n", user.CreatedAt.Format("January 2, 2006"))
+
+	fmt.Fprintf(&b, "APPOINTMENTS (%d)\n", len(appointments))
+	for _, appt := range appointments {
+		fmt.Fprintf(&b, "  - %s with Dr. %s %s [%s]\n",
+			appt.StartTime.UTC().Format("Jan 2, 2006 15:04 MST"),
+			appt.Doctor.FirstName, appt.Doctor.LastName, appt.Status)
+		if appt.Reason != "" {
+			fmt.Fprintf(&b, "      Reason: %s\n", appt.Reason)
+		}
+		if appt.Notes != "" {
+			fmt.Fprintf(&b, "      Notes:  %s\n", appt.Notes)
+		}
+	}
+	fmt.Fprintf(&b, "\n")
+
+	fmt.Fprintf(&b, "INTAKE FORMS (%d)\n", len(intake))
+	for _, response := range intake {
+		fmt.Fprintf(&b, "  - For appointment #%d, submitted %s\n",
+			response.AppointmentID, response.UpdatedAt.UTC().Format("Jan 2, 2006 15:04 MST"))
+		for _, question := range response.QuestionnaireVersion.Questions {
+			if answer, ok := response.Answers[question.ID]; ok {
+				fmt.Fprintf(&b, "      %s: %v\n", question.Label, answer)
+			}
+		}
+	}
+	fmt.Fprintf(&b, "\n")
+
+	fmt.Fprintf(&b, "PAYMENTS (%d)\n", len(payments))
+	for _, payment := range payments {
+		fmt.Fprintf(&b, "  - %s  %.2f via %s [%s] for appointment #%d\n",
+			payment.CreatedAt.UTC().Format("Jan 2, 2006"),
+			payment.Amount, payment.PaymentMethod, payment.Status, payment.AppointmentID)
+	}
+	fmt.Fprintf(&b, "\n")
+
+	fmt.Fprintf(&b, "NOTIFICATIONS (%d)\n", len(notifications))
+	for _, n := range notifications {
+		fmt.Fprintf(&b, "  - %s  %s by %s to %s [%s]\n",
+			n.CreatedAt.UTC().Format("Jan 2, 2006 15:04 MST"),
+			n.Type, n.Channel, n.Recipient, n.Status)
+	}
+
+	io.WriteString(w, b.String())
+}
+
+// generateExportToken creates a random token for download links
+func generateExportToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate download token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// envInt reads an integer environment variable, falling back to a default
+func envInt(key string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
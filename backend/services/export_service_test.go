@@ -0,0 +1,149 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+func TestExportIntakeResponses(t *testing.T) {
+	responses := []models.IntakeResponse{{
+		ID:            3,
+		AppointmentID: 9,
+		QuestionnaireVersion: models.QuestionnaireVersion{Questions: []models.Question{
+			{ID: "allergies", Type: models.QuestionText, Label: "Any allergies?"},
+			{ID: "smoker", Type: models.QuestionBoolean, Label: "Do you smoke?"},
+			{ID: "perDay", Type: models.QuestionNumber, Label: "Cigarettes per day"},
+		}},
+		Answers: map[string]interface{}{"smoker": false, "allergies": "Penicillin"},
+	}}
+
+	records := exportIntakeResponses(responses)
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	answers := records[0]["answers"].([]map[string]interface{})
+
+	// Answers follow the question order and skip unanswered questions
+	want := []struct {
+		question string
+		answer   interface{}
+	}{
+		{"Any allergies?", "Penicillin"},
+		{"Do you smoke?", false},
+	}
+	if len(answers) != len(want) {
+		t.Fatalf("got %d answers, want %d", len(answers), len(want))
+	}
+	for i, w := range want {
+		if answers[i]["question"] != w.question || answers[i]["answer"] != w.answer {
+			t.Errorf("answer %d = %v, want %q: %v", i, answers[i], w.question, w.answer)
+		}
+	}
+}
+
+func TestWriteArchiveIncludesIntakeAnswers(t *testing.T) {
+	db := openTestDB(t)
+	suffix := time.Now().UnixNano()
+
+	organization := models.Organization{Name: "Exports", Slug: fmt.Sprintf("exports-%d", suffix)}
+	if err := db.Create(&organization).Error; err != nil {
+		t.Fatalf("failed to create organization: %v", err)
+	}
+	doctor := createMember(t, db, organization.ID, models.RoleDoctor, fmt.Sprintf("doctor-%d@example.test", suffix))
+	patient := createMember(t, db, organization.ID, models.RolePatient, fmt.Sprintf("patient-%d@example.test", suffix))
+
+	start := time.Now().Add(72 * time.Hour)
+	appointment := models.Appointment{
+		OrganizationID: organization.ID,
+		PatientID:      patient.ID,
+		DoctorID:       doctor.ID,
+		StartTime:      start,
+		EndTime:        start.Add(30 * time.Minute),
+		Status:         models.StatusScheduled,
+		Reason:         "Headaches",
+	}
+	if err := db.Create(&appointment).Error; err != nil {
+		t.Fatalf("failed to create appointment: %v", err)
+	}
+
+	questionnaire := models.Questionnaire{OrganizationID: organization.ID, Name: "New patient", CurrentVersion: 1}
+	if err := db.Create(&questionnaire).Error; err != nil {
+		t.Fatalf("failed to create questionnaire: %v", err)
+	}
+	version := models.QuestionnaireVersion{
+		OrganizationID:  organization.ID,
+		QuestionnaireID: questionnaire.ID,
+		Version:         1,
+		Questions:       []models.Question{{ID: "allergies", Type: models.QuestionText, Label: "Any allergies?"}},
+		CreatedBy:       doctor.ID,
+	}
+	if err := db.Create(&version).Error; err != nil {
+		t.Fatalf("failed to create questionnaire version: %v", err)
+	}
+	response := models.IntakeResponse{
+		OrganizationID:         organization.ID,
+		AppointmentID:          appointment.ID,
+		PatientID:              patient.ID,
+		QuestionnaireVersionID: version.ID,
+		Answers:                map[string]interface{}{"allergies": "Penicillin"},
+	}
+	if err := db.Create(&response).Error; err != nil {
+		t.Fatalf("failed to create intake response: %v", err)
+	}
+
+	es := &ExportService{DB: db}
+	filePath := filepath.Join(t.TempDir(), "export.zip")
+	if err := es.writeArchive(&patient, filePath); err != nil {
+		t.Fatalf("writeArchive() error = %v", err)
+	}
+
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	defer archive.Close()
+
+	var intake []struct {
+		AppointmentID uint `json:"appointmentId"`
+		Answers       []struct {
+			Question string      `json:"question"`
+			Answer   interface{} `json:"answer"`
+		} `json:"answers"`
+	}
+	if err := json.Unmarshal(readArchiveEntry(t, archive, "intake_forms.json"), &intake); err != nil {
+		t.Fatalf("failed to decode intake_forms.json: %v", err)
+	}
+	if len(intake) != 1 || intake[0].AppointmentID != appointment.ID || len(intake[0].Answers) != 1 ||
+		intake[0].Answers[0].Question != "Any allergies?" || intake[0].Answers[0].Answer != "Penicillin" {
+		t.Errorf("intake_forms.json = %+v, want the allergy answer for appointment %d", intake, appointment.ID)
+	}
+
+	if summary := string(readArchiveEntry(t, archive, "summary.txt")); !strings.Contains(summary, "Any allergies?: Penicillin") {
+		t.Errorf("summary.txt does not include the intake answer:\n%s", summary)
+	}
+}
+
+// readArchiveEntry returns the contents of a file in a zip archive
+func readArchiveEntry(t *testing.T, archive *zip.ReadCloser, name string) []byte {
+	t.Helper()
+
+	file, err := archive.Open(name)
+	if err != nil {
+		t.Fatalf("archive has no %s: %v", name, err)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", name, err)
+	}
+	return content
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// Errors returned by GuestLinkService
+var (
+	ErrGuestLinkEnded    = errors.New("guest links can only be created before the appointment ends")
+	ErrGuestLinkNotFound = errors.New("guest link not found")
+	ErrGuestLinkClosed   = errors.New("this guest link has expired, been revoked or is not open yet")
+	ErrGuestLinkPIN      = errors.New("the PIN is not correct")
+)
+
+// GuestLinkService manages links that let people without an account join an
+// appointment's video call
+type GuestLinkService struct {
+	DB          *gorm.DB
+	FrontendURL string
+}
+
+// NewGuestLinkService creates a new guest link service
+func NewGuestLinkService() *GuestLinkService {
+	return &GuestLinkService{
+		DB:          config.DB,
+		FrontendURL: os.Getenv("FRONTEND_URL"),
+	}
+}
+
+// URL returns the page a guest opens to join the call
+func (gs *GuestLinkService) URL(link *models.GuestLink) string {
+	return fmt.Sprintf("%s/guest/%s", gs.FrontendURL, link.Token)
+}
+
+// Create makes a guest link for an appointment, optionally protected by a PIN
+func (gs *GuestLinkService) Create(ctx context.Context, appointment *models.Appointment, displayName, pin string, actor Actor) (*models.GuestLink, error) {
+	if appointment.Status.IsFinal() || !time.Now().Before(appointment.EndTime) {
+		return nil, ErrGuestLinkEnded
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	link := models.GuestLink{
+		OrganizationID: appointment.OrganizationID,
+		AppointmentID:  appointment.ID,
+		Token:          token,
+		DisplayName:    displayName,
+		CreatedByID:    actor.ID,
+	}
+	if err := link.SetPIN(pin); err != nil {
+		return nil, fmt.Errorf("failed to hash PIN: %w", err)
+	}
+
+	err = gs.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&link).Error; err != nil {
+			return err
+		}
+		return RecordAppointmentEvent(tx, appointment, models.AppointmentEventParticipants, actor,
+			[]models.FieldChange{{Field: "guest", After: displayName}}, "")
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save guest link: %w", err)
+	}
+	return &link, nil
+}
+
+// Links returns an appointment's guest links, newest first
+func (gs *GuestLinkService) Links(ctx context.Context, appointmentID uint) ([]models.GuestLink, error) {
+	var links []models.GuestLink
+	if err := gs.DB.WithContext(ctx).Where("appointment_id = ?", appointmentID).
+		Order("created_at DESC, id DESC").Find(&links).Error; err != nil {
+		return nil, fmt.Errorf("failed to load guest links: %w", err)
+	}
+	return links, nil
+}
+
+// Revoke stops a guest link from working and disconnects a guest already in
+// the call
+func (gs *GuestLinkService) Revoke(ctx context.Context, appointment *models.Appointment, linkID uint, actor Actor) (*models.GuestLink, error) {
+	var link models.GuestLink
+	err := gs.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("appointment_id = ?", appointment.ID).First(&link, linkID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrGuestLinkNotFound
+			}
+			return err
+		}
+		if link.RevokedAt != nil {
+			return nil
+		}
+		now := time.Now()
+		if err := tx.Model(&link).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		link.RevokedAt = &now
+		return RecordAppointmentEvent(tx, appointment, models.AppointmentEventParticipants, actor,
+			[]models.FieldChange{{Field: "guest", Before: link.DisplayName}}, "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	DisconnectGuest(link.ID)
+	return &link, nil
+}
+
+// Lookup finds the link for a token and its appointment, whether or not it is open
+func (gs *GuestLinkService) Lookup(token string) (*models.GuestLink, *models.Appointment, error) {
+	var links []models.GuestLink
+	if err := gs.DB.Where("token = ?", token).Limit(1).Find(&links).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to load guest link: %w", err)
+	}
+	if len(links) == 0 {
+		return nil, nil, ErrGuestLinkNotFound
+	}
+
+	var appointment models.Appointment
+	if err := gs.DB.First(&appointment, links[0].AppointmentID).Error; err != nil {
+		return nil, nil, ErrGuestLinkNotFound
+	}
+	return &links[0], &appointment, nil
+}
+
+// Open checks a guest may join now with the PIN they gave. Too many wrong
+// PINs revoke the link.
+func (gs *GuestLinkService) Open(token, pin string) (*models.GuestLink, *models.Appointment, error) {
+	link, appointment, err := gs.Lookup(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !link.IsOpen(appointment, time.Now()) {
+		return nil, nil, ErrGuestLinkClosed
+	}
+	if !link.HasPIN() {
+		return link, appointment, nil
+	}
+
+	// Take an attempt before checking the PIN, so parallel guesses cannot
+	// get past the limit
+	var attempts []int
+	if err := gs.DB.Raw(`UPDATE guest_links SET failed_attempts = failed_attempts + 1
+		WHERE id = ? AND failed_attempts < ? AND revoked_at IS NULL RETURNING failed_attempts`,
+		link.ID, models.MaxGuestPINAttempts).Scan(&attempts).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to count PIN attempt: %w", err)
+	}
+	if len(attempts) == 0 {
+		return nil, nil, ErrGuestLinkClosed
+	}
+
+	if link.CheckPIN(pin) {
+		if err := gs.DB.Model(link).Update("failed_attempts", gorm.Expr("failed_attempts - 1")).Error; err != nil {
+			log.Printf("Failed to return PIN attempt for guest link %d: %v", link.ID, err)
+		}
+		return link, appointment, nil
+	}
+	if attempts[0] >= models.MaxGuestPINAttempts {
+		if err := gs.DB.Model(link).Where("revoked_at IS NULL").Update("revoked_at", time.Now()).Error; err != nil {
+			log.Printf("Failed to revoke guest link %d: %v", link.ID, err)
+		} else {
+			log.Printf("Revoked guest link %d after %d wrong PINs", link.ID, models.MaxGuestPINAttempts)
+		}
+	}
+	return nil, nil, ErrGuestLinkPIN
+}
+
+// IsOpen reports whether a guest link still lets its guest stay in the call
+func (gs *GuestLinkService) IsOpen(linkID uint) bool {
+	var link models.GuestLink
+	if err := gs.DB.First(&link, linkID).Error; err != nil {
+		return false
+	}
+	var appointment models.Appointment
+	if err := gs.DB.First(&appointment, link.AppointmentID).Error; err != nil {
+		return false
+	}
+	return link.IsOpen(&appointment, time.Now())
+}
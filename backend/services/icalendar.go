@@ -0,0 +1,224 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// CalendarEvent is one appointment as it appears in a calendar
+type CalendarEvent struct {
+	UID          string
+	Summary      string
+	Description  string
+	Location     string
+	URL          string
+	Start        time.Time
+	End          time.Time
+	LastModified time.Time
+	Sequence     int
+	Cancelled    bool
+	// Tentative marks a slot held until it is paid for
+	Tentative bool
+}
+
+// Calendar is an RFC 5545 iCalendar object with its events written in one time zone
+type Calendar struct {
+	Name     string
+	Method   string
+	Location *time.Location
+	Events   []CalendarEvent
+}
+
+const (
+	icalDateTime    = "20060102T150405"
+	icalMaxLineSize = 75
+)
+
+// WriteTo writes the calendar, folding long lines and ending each with CRLF
+func (cal *Calendar) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	line := func(name, value string) {
+		writeFolded(&b, name+":"+value)
+	}
+
+	location := cal.Location
+	if location == nil {
+		location = time.UTC
+	}
+	utc := location == time.UTC || location.String() == "UTC"
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//Telehealth Platform//Appointments//EN")
+	line("CALSCALE", "GREGORIAN")
+	if cal.Method != "" {
+		line("METHOD", cal.Method)
+	}
+	if cal.Name != "" {
+		line("X-WR-CALNAME", escapeText(cal.Name))
+	}
+	if !utc {
+		line("X-WR-TIMEZONE", location.String())
+		if len(cal.Events) > 0 {
+			writeTimeZone(&b, location, cal.Events)
+		}
+	}
+
+	// Times are written in the calendar's zone, or as UTC
+	dateTime := func(name string, t time.Time) {
+		if utc {
+			line(name, t.UTC().Format(icalDateTime)+"Z")
+			return
+		}
+		line(name+";TZID="+location.String(), t.In(location).Format(icalDateTime))
+	}
+
+	stamp := time.Now().UTC().Format(icalDateTime) + "Z"
+	for _, event := range cal.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", event.UID)
+		line("DTSTAMP", stamp)
+		dateTime("DTSTART", event.Start)
+		dateTime("DTEND", event.End)
+		line("SUMMARY", escapeText(event.Summary))
+		if event.Description != "" {
+			line("DESCRIPTION", escapeText(event.Description))
+		}
+		if event.Location != "" {
+			line("LOCATION", escapeText(event.Location))
+		}
+		if event.URL != "" {
+			line("URL", event.URL)
+		}
+		if !event.LastModified.IsZero() {
+			line("LAST-MODIFIED", event.LastModified.UTC().Format(icalDateTime)+"Z")
+		}
+		line("SEQUENCE", fmt.Sprint(event.Sequence))
+		if event.Cancelled {
+			line("STATUS", "CANCELLED")
+		} else if event.Tentative {
+			line("STATUS", "TENTATIVE")
+		} else {
+			line("STATUS", "CONFIRMED")
+		}
+		line("TRANSP", "OPAQUE")
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// String returns the calendar as iCalendar text
+func (cal *Calendar) String() string {
+	var b strings.Builder
+	cal.WriteTo(&b)
+	return b.String()
+}
+
+// writeTimeZone writes a VTIMEZONE covering the events. Go does not expose a
+// zone's rules, so each offset change in the range is found by searching and
+// written as its own observance.
+func writeTimeZone(b *strings.Builder, location *time.Location, events []CalendarEvent) {
+	from, to := events[0].Start, events[0].End
+	for _, event := range events[1:] {
+		if event.Start.Before(from) {
+			from = event.Start
+		}
+		if event.End.After(to) {
+			to = event.End
+		}
+	}
+	// Start a year early so the first observance is in effect before any event
+	from = from.AddDate(-1, 0, 0)
+
+	writeFolded(b, "BEGIN:VTIMEZONE")
+	writeFolded(b, "TZID:"+location.String())
+
+	_, offset := from.In(location).Zone()
+	writeObservance(b, from.In(location), offset, from.In(location))
+	for day := from; day.Before(to); day = day.Add(24 * time.Hour) {
+		next := day.Add(24 * time.Hour)
+		_, nextOffset := next.In(location).Zone()
+		if nextOffset == offset {
+			continue
+		}
+		// Narrow the change down to the second
+		low, high := day, next
+		for high.Sub(low) > time.Second {
+			mid := low.Add(high.Sub(low) / 2)
+			if _, midOffset := mid.In(location).Zone(); midOffset == offset {
+				low = mid
+			} else {
+				high = mid
+			}
+		}
+		writeObservance(b, high.In(location), offset, high.In(location))
+		offset = nextOffset
+	}
+
+	writeFolded(b, "END:VTIMEZONE")
+}
+
+// writeObservance writes a STANDARD or DAYLIGHT component starting at onset
+func writeObservance(b *strings.Builder, onset time.Time, offsetFrom int, zone time.Time) {
+	kind := "STANDARD"
+	if zone.IsDST() {
+		kind = "DAYLIGHT"
+	}
+	name, offsetTo := zone.Zone()
+
+	// DTSTART is the onset in the local time that was in effect before it
+	local := onset.UTC().Add(time.Duration(offsetFrom) * time.Second)
+
+	writeFolded(b, "BEGIN:"+kind)
+	writeFolded(b, "DTSTART:"+local.Format(icalDateTime))
+	writeFolded(b, "TZOFFSETFROM:"+formatOffset(offsetFrom))
+	writeFolded(b, "TZOFFSETTO:"+formatOffset(offsetTo))
+	writeFolded(b, "TZNAME:"+escapeText(name))
+	writeFolded(b, "END:"+kind)
+}
+
+// formatOffset formats a UTC offset in seconds as +HHMM
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// escapeText escapes a TEXT value
+func escapeText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// writeFolded writes a content line, folding it at 75 octets without
+// splitting a UTF-8 character
+func writeFolded(b *strings.Builder, line string) {
+	limit := icalMaxLineSize
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space, which counts towards the limit
+		limit = icalMaxLineSize - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
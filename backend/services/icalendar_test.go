@@ -0,0 +1,136 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+	"unicode/utf8"
+)
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Follow-up", "Follow-up"},
+		{"Dr. Okello; cardiology", `Dr. Okello\; cardiology`},
+		{"Kampala, Uganda", `Kampala\, Uganda`},
+		{`C:\notes`, `C:\\notes`},
+		{"line one\nline two", `line one\nline two`},
+		{"line one\r\nline two", `line one\nline two`},
+		{`a\,b`, `a\\\,b`},
+	}
+	for _, tt := range tests {
+		if got := escapeText(tt.in); got != tt.want {
+			t.Errorf("escapeText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWriteFolded(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"short", "SUMMARY:Check-up"},
+		{"exactly the limit", "DESCRIPTION:" + strings.Repeat("a", icalMaxLineSize-len("DESCRIPTION:"))},
+		{"long ascii", "DESCRIPTION:" + strings.Repeat("abcdefghij", 20)},
+		{"long multibyte", "DESCRIPTION:" + strings.Repeat("é€😀", 40)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			writeFolded(&b, tt.line)
+			out := b.String()
+
+			if !strings.HasSuffix(out, "\r\n") {
+				t.Fatalf("output %q does not end with CRLF", out)
+			}
+			lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+			var unfolded strings.Builder
+			for i, line := range lines {
+				if len(line) > icalMaxLineSize {
+					t.Errorf("line %d is %d octets, want at most %d", i, len(line), icalMaxLineSize)
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("line %d splits a UTF-8 character: %q", i, line)
+				}
+				if i > 0 {
+					if !strings.HasPrefix(line, " ") {
+						t.Fatalf("continuation line %d does not start with a space: %q", i, line)
+					}
+					line = line[1:]
+				}
+				unfolded.WriteString(line)
+			}
+			if unfolded.String() != tt.line {
+				t.Errorf("unfolded output = %q, want %q", unfolded.String(), tt.line)
+			}
+			if len(tt.line) <= icalMaxLineSize && len(lines) != 1 {
+				t.Errorf("got %d lines for a line within the limit, want 1", len(lines))
+			}
+		})
+	}
+}
+
+func TestWriteTimeZone(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+	start := time.Date(2025, 3, 20, 9, 0, 0, 0, newYork)
+	events := []CalendarEvent{{Start: start, End: start.Add(30 * time.Minute)}}
+
+	var b strings.Builder
+	writeTimeZone(&b, newYork, events)
+	out := b.String()
+
+	// The year before the event covers the November 2024 and March 2025 changes
+	want := strings.Join([]string{
+		"BEGIN:VTIMEZONE",
+		"TZID:America/New_York",
+		"BEGIN:DAYLIGHT",
+		"DTSTART:20240320T090000",
+		"TZOFFSETFROM:-0400",
+		"TZOFFSETTO:-0400",
+		"TZNAME:EDT",
+		"END:DAYLIGHT",
+		"BEGIN:STANDARD",
+		"DTSTART:20241103T020000",
+		"TZOFFSETFROM:-0400",
+		"TZOFFSETTO:-0500",
+		"TZNAME:EST",
+		"END:STANDARD",
+		"BEGIN:DAYLIGHT",
+		"DTSTART:20250309T020000",
+		"TZOFFSETFROM:-0500",
+		"TZOFFSETTO:-0400",
+		"TZNAME:EDT",
+		"END:DAYLIGHT",
+		"END:VTIMEZONE",
+	}, "\r\n") + "\r\n"
+	if out != want {
+		t.Errorf("writeTimeZone() =\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestWriteTimeZoneWithoutChanges(t *testing.T) {
+	kampala, err := time.LoadLocation("Africa/Kampala")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+	start := time.Date(2025, 6, 2, 10, 0, 0, 0, kampala)
+	events := []CalendarEvent{{Start: start, End: start.Add(time.Hour)}}
+
+	var b strings.Builder
+	writeTimeZone(&b, kampala, events)
+	out := b.String()
+
+	if n := strings.Count(out, "BEGIN:STANDARD"); n != 1 || strings.Contains(out, "BEGIN:DAYLIGHT") {
+		t.Errorf("got %d standard observances and daylight %v, want one standard observance only",
+			n, strings.Contains(out, "BEGIN:DAYLIGHT"))
+	}
+	if !strings.Contains(out, "TZOFFSETTO:+0300\r\n") {
+		t.Errorf("output does not have the +0300 offset:\n%s", out)
+	}
+}
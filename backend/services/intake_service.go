@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// Errors returned by IntakeService
+var (
+	ErrInvalidQuestions = errors.New("the questionnaire is not valid")
+	ErrNoQuestionnaire  = errors.New("this appointment has no intake questionnaire")
+	ErrIntakeClosed     = errors.New("intake answers can only be given before the appointment")
+	ErrInvalidAnswers   = errors.New("some answers are not valid")
+)
+
+// IntakeService manages versioned intake questionnaires and patients' answers
+type IntakeService struct {
+	DB *gorm.DB
+}
+
+// NewIntakeService creates a new intake service
+func NewIntakeService() *IntakeService {
+	return &IntakeService{
+		DB: config.DB,
+	}
+}
+
+// CreateQuestionnaire saves a questionnaire with its first version
+func (is *IntakeService) CreateQuestionnaire(ctx context.Context, questionnaire *models.Questionnaire, questions []models.Question, createdBy uint) (*models.QuestionnaireVersion, map[string]string, error) {
+	if problems := models.ValidateQuestions(questions); len(problems) > 0 {
+		return nil, problems, ErrInvalidQuestions
+	}
+
+	version := models.QuestionnaireVersion{Version: 1, Questions: questions, CreatedBy: createdBy}
+	err := is.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		questionnaire.CurrentVersion = 1
+		if err := tx.Create(questionnaire).Error; err != nil {
+			return err
+		}
+		version.QuestionnaireID = questionnaire.ID
+		return tx.Create(&version).Error
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to save questionnaire: %w", err)
+	}
+	return &version, nil, nil
+}
+
+// UpdateQuestionnaire renames a questionnaire and adds a version with the new
+// questions. Answers already given keep pointing at the version they used.
+func (is *IntakeService) UpdateQuestionnaire(ctx context.Context, questionnaire *models.Questionnaire, name string, questions []models.Question, updatedBy uint) (*models.QuestionnaireVersion, map[string]string, error) {
+	if problems := models.ValidateQuestions(questions); len(problems) > 0 {
+		return nil, problems, ErrInvalidQuestions
+	}
+
+	version := models.QuestionnaireVersion{QuestionnaireID: questionnaire.ID, Questions: questions, CreatedBy: updatedBy}
+	err := is.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the questionnaire so concurrent edits get consecutive versions
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(questionnaire, questionnaire.ID).Error; err != nil {
+			return err
+		}
+		version.Version = questionnaire.CurrentVersion + 1
+		if err := tx.Create(&version).Error; err != nil {
+			return err
+		}
+		questionnaire.Name = name
+		questionnaire.CurrentVersion = version.Version
+		return tx.Model(questionnaire).Updates(map[string]interface{}{
+			"name":            name,
+			"current_version": version.Version,
+		}).Error
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to save questionnaire: %w", err)
+	}
+	return &version, nil, nil
+}
+
+// Version returns one version of a questionnaire
+func (is *IntakeService) Version(ctx context.Context, questionnaireID uint, version int) (*models.QuestionnaireVersion, error) {
+	var questionnaireVersion models.QuestionnaireVersion
+	if err := is.DB.WithContext(ctx).Where("questionnaire_id = ? AND version = ?", questionnaireID, version).
+		First(&questionnaireVersion).Error; err != nil {
+		return nil, err
+	}
+	return &questionnaireVersion, nil
+}
+
+// AppointmentQuestionnaire returns the current questions for an appointment,
+// taken from the questionnaire on its appointment type
+func (is *IntakeService) AppointmentQuestionnaire(ctx context.Context, appointment *models.Appointment) (*models.QuestionnaireVersion, error) {
+	if appointment.AppointmentTypeID == nil {
+		return nil, ErrNoQuestionnaire
+	}
+
+	db := is.DB.WithContext(ctx)
+	var appointmentType models.AppointmentType
+	if err := db.Unscoped().First(&appointmentType, *appointment.AppointmentTypeID).Error; err != nil || appointmentType.QuestionnaireID == nil {
+		return nil, ErrNoQuestionnaire
+	}
+
+	var questionnaire models.Questionnaire
+	if err := db.First(&questionnaire, *appointmentType.QuestionnaireID).Error; err != nil {
+		return nil, ErrNoQuestionnaire
+	}
+	return is.Version(ctx, questionnaire.ID, questionnaire.CurrentVersion)
+}
+
+// Submit validates and stores the patient's answers for an appointment.
+// Answers can be replaced until the appointment starts; on invalid answers
+// the problems are returned keyed by question ID.
+func (is *IntakeService) Submit(ctx context.Context, appointment *models.Appointment, answers map[string]interface{}) (*models.IntakeResponse, map[string]string, error) {
+	if appointment.Status != models.StatusScheduled && appointment.Status != models.StatusHeld ||
+		!time.Now().Before(appointment.StartTime) {
+		return nil, nil, ErrIntakeClosed
+	}
+
+	version, err := is.AppointmentQuestionnaire(ctx, appointment)
+	if err != nil {
+		return nil, nil, err
+	}
+	kept, problems := version.Validate(answers)
+	if len(problems) > 0 {
+		return nil, problems, ErrInvalidAnswers
+	}
+
+	response := models.IntakeResponse{
+		AppointmentID:          appointment.ID,
+		PatientID:              appointment.PatientID,
+		QuestionnaireVersionID: version.ID,
+		Answers:                kept,
+	}
+	if err := is.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "appointment_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"questionnaire_version_id", "answers", "updated_at"}),
+	}).Create(&response).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to save intake answers: %w", err)
+	}
+	response.QuestionnaireVersion = *version
+	return &response, nil, nil
+}
+
+// Response returns the answers given for an appointment, or nil if there are none
+func (is *IntakeService) Response(ctx context.Context, appointmentID uint) (*models.IntakeResponse, error) {
+	var responses []models.IntakeResponse
+	if err := is.DB.WithContext(ctx).Preload("QuestionnaireVersion").
+		Where("appointment_id = ?", appointmentID).Limit(1).Find(&responses).Error; err != nil {
+		return nil, fmt.Errorf("failed to load intake answers: %w", err)
+	}
+	if len(responses) == 0 {
+		return nil, nil
+	}
+	return &responses[0], nil
+}
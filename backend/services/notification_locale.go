@@ -0,0 +1,120 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// notificationLocale holds the translated text and date formats for a language
+type notificationLocale struct {
+	messages  map[string]string
+	longDate  func(t time.Time) string
+	shortDate func(t time.Time) string
+	clock     string
+}
+
+// SupportedLanguages lists the languages notifications can be sent in
+var SupportedLanguages = []string{"en", "fr"}
+
+var notificationLocales = map[string]*notificationLocale{
+	"en": {
+		messages: map[string]string{
+			"appointment_confirmation.subject":        "Your Appointment Confirmation",
+			"appointment_confirmation.doctor_subject": "New Appointment Scheduled",
+			"appointment_confirmation.sms":            "Your appointment with %s has been confirmed for %s at %s. Visit yourtelehealth.com for details.",
+			"appointment_reminder.subject":            "Upcoming Appointment Reminder",
+			"appointment_reminder.doctor_subject":     "Upcoming Appointment Reminder",
+			"appointment_reminder.sms":                "Reminder: Your appointment with %s is tomorrow at %s. Visit yourtelehealth.com to join the video call.",
+			"appointment_cancellation.subject":        "Appointment Cancelled",
+			"appointment_cancellation.doctor_subject": "Appointment Cancelled",
+			"appointment_cancellation.sms":            "Your appointment with %s on %s at %s has been cancelled.",
+			"appointment_update.subject":              "Appointment Updated",
+			"appointment_update.doctor_subject":       "Appointment Updated",
+			"appointment_update.sms":                  "Your appointment with %s has been updated. Please check yourtelehealth.com for details.",
+			"appointment_rescheduled.subject":         "Your Appointment Has Been Rescheduled",
+			"appointment_rescheduled.doctor_subject":  "Appointment Rescheduled",
+			"appointment_rescheduled.sms":             "Your appointment with %s has been moved to %s at %s. Visit yourtelehealth.com for details.",
+			"waitlist_offer.subject":                  "An Appointment Slot Is Available",
+			"waitlist_offer.sms":                      "A slot with %s on %s at %s is available. Claim it before %s: %s",
+			"data_export_ready.subject":               "Your Data Export Is Ready",
+			"data_export_ready.sms":                   "Your telehealth data export is ready. Check your email or visit yourtelehealth.com to download it.",
+			"appointment_invitation.subject":          "You Are Invited to a Telehealth Appointment",
+			"appointment_invitation.sms":              "You are invited to join an appointment with %s on %s at %s. Join the video call: %s",
+			"participant_role.interpreter":            "Interpreter",
+			"participant_role.caregiver":              "Caregiver",
+			"participant_role.clinician":              "Clinician",
+		},
+		longDate:  func(t time.Time) string { return t.Format("Monday, January 2, 2006") },
+		shortDate: func(t time.Time) string { return t.Format("Jan 2") },
+		clock:     "3:04 PM MST",
+	},
+	"fr": {
+		messages: map[string]string{
+			"appointment_confirmation.subject":        "Confirmation de votre rendez-vous",
+			"appointment_confirmation.doctor_subject": "Nouveau rendez-vous planifié",
+			"appointment_confirmation.sms":            "Votre rendez-vous avec %s est confirmé pour le %s à %s. Rendez-vous sur yourtelehealth.com pour plus de détails.",
+			"appointment_reminder.subject":            "Rappel de rendez-vous",
+			"appointment_reminder.doctor_subject":     "Rappel de rendez-vous",
+			"appointment_reminder.sms":                "Rappel : votre rendez-vous avec %s a lieu demain à %s. Rendez-vous sur yourtelehealth.com pour rejoindre l'appel vidéo.",
+			"appointment_cancellation.subject":        "Rendez-vous annulé",
+			"appointment_cancellation.doctor_subject": "Rendez-vous annulé",
+			"appointment_cancellation.sms":            "Votre rendez-vous avec %s le %s à %s a été annulé.",
+			"appointment_update.subject":              "Rendez-vous modifié",
+			"appointment_update.doctor_subject":       "Rendez-vous modifié",
+			"appointment_update.sms":                  "Votre rendez-vous avec %s a été modifié. Consultez yourtelehealth.com pour plus de détails.",
+			"appointment_rescheduled.subject":         "Votre rendez-vous a été déplacé",
+			"appointment_rescheduled.doctor_subject":  "Rendez-vous déplacé",
+			"appointment_rescheduled.sms":             "Votre rendez-vous avec %s a été déplacé au %s à %s. Rendez-vous sur yourtelehealth.com pour plus de détails.",
+			"waitlist_offer.subject":                  "Un créneau de rendez-vous est disponible",
+			"waitlist_offer.sms":                      "Un créneau avec %s le %s à %s est disponible. Réservez-le avant %s : %s",
+			"data_export_ready.subject":               "Votre export de données est prêt",
+			"data_export_ready.sms":                   "Votre export de données est prêt. Consultez vos e-mails ou rendez-vous sur yourtelehealth.com pour le télécharger.",
+			"appointment_invitation.subject":          "Vous êtes invité à un rendez-vous de téléconsultation",
+			"appointment_invitation.sms":              "Vous êtes invité à un rendez-vous avec %s le %s à %s. Rejoignez l'appel vidéo : %s",
+			"participant_role.interpreter":            "Interprète",
+			"participant_role.caregiver":              "Aidant",
+			"participant_role.clinician":              "Clinicien",
+		},
+		longDate: func(t time.Time) string {
+			return fmt.Sprintf("%s %d %s %d", frenchDays[t.Weekday()], t.Day(), frenchMonths[t.Month()-1], t.Year())
+		},
+		shortDate: func(t time.Time) string {
+			return fmt.Sprintf("%d %s", t.Day(), frenchShortMonths[t.Month()-1])
+		},
+		clock: "15:04 MST",
+	},
+}
+
+var (
+	frenchDays        = []string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"}
+	frenchMonths      = []string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"}
+	frenchShortMonths = []string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."}
+)
+
+// IsSupportedLanguage reports whether notifications can be sent in a language
+func IsSupportedLanguage(language string) bool {
+	_, ok := notificationLocales[language]
+	return ok
+}
+
+// localeFor returns the locale for a language, falling back to English
+func localeFor(language string) *notificationLocale {
+	if locale, ok := notificationLocales[language]; ok {
+		return locale
+	}
+	return notificationLocales[models.DefaultLanguage]
+}
+
+// text returns a translated message, formatted with args
+func (l *notificationLocale) text(key string, args ...interface{}) string {
+	message, ok := l.messages[key]
+	if !ok {
+		message = notificationLocales[models.DefaultLanguage].messages[key]
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
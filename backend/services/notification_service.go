@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -30,8 +31,39 @@ const (
 	
 	// NotificationTypeAppointmentUpdate represents an appointment update notification
 	NotificationTypeAppointmentUpdate NotificationType = "appointment_update"
+	
+	// NotificationTypeAppointmentRescheduled represents an appointment moved to a new time
+	NotificationTypeAppointmentRescheduled NotificationType = "appointment_rescheduled"
+	
+	// NotificationTypeWaitlistOffer offers a waitlisted patient a freed slot
+	NotificationTypeWaitlistOffer NotificationType = "waitlist_offer"
+	
+	// NotificationTypeDataExportReady tells a user their data export can be downloaded
+	NotificationTypeDataExportReady NotificationType = "data_export_ready"
+	
+	// NotificationTypeAppointmentInvitation invites an interpreter, caregiver or clinician to an appointment
+	NotificationTypeAppointmentInvitation NotificationType = "appointment_invitation"
 )
 
+// NotificationTypes lists the notification types users can set channel preferences for
+var NotificationTypes = []NotificationType{
+	NotificationTypeAppointmentReminder,
+	NotificationTypeAppointmentConfirmation,
+	NotificationTypeAppointmentCancellation,
+	NotificationTypeAppointmentUpdate,
+	NotificationTypeAppointmentRescheduled,
+	NotificationTypeWaitlistOffer,
+	NotificationTypeDataExportReady,
+	NotificationTypeAppointmentInvitation,
+}
+
+// ignoresQuietHours lists notification types that are sent straight away,
+// because they stop being useful while held back. A waitlist offer's claim
+// window runs from the moment it is made.
+var ignoresQuietHours = map[NotificationType]bool{
+	NotificationTypeWaitlistOffer: true,
+}
+
 // NotificationService handles sending notifications to users
 type NotificationService struct {
 	EmailEnabled bool
@@ -89,143 +121,144 @@ func NewNotificationService(db *gorm.DB) *NotificationService {
 
 // SendAppointmentNotification sends a notification about an appointment
 func (ns *NotificationService) SendAppointmentNotification(appointment *models.Appointment, notificationType NotificationType) error {
-	// Get user and doctor information
-	var patient models.User = appointment.Patient
-	var doctor models.User = appointment.Doctor
+	// Get user and doctor information with their preferences
+	patient := ns.recipientFor(&appointment.Patient)
+	doctor := ns.recipientFor(&appointment.Doctor)
+	doctorName := fmt.Sprintf("Dr. %s %s", appointment.Doctor.FirstName, appointment.Doctor.LastName)
 	
-	// Prepare notification data
-	data := map[string]interface{}{
-		"PatientName":    fmt.Sprintf("%s %s", patient.FirstName, patient.LastName),
-		"DoctorName":     fmt.Sprintf("Dr. %s %s", doctor.FirstName, doctor.LastName),
-		"AppointmentID":  appointment.ID,
-		"AppointmentDate": appointment.StartTime.Format("Monday, January 2, 2006"),
-		"StartTime":      appointment.StartTime.Format("3:04 PM"),
-		"EndTime":        appointment.EndTime.Format("3:04 PM"),
-		"Status":         appointment.Status,
-		"Reason":         appointment.Reason,
-		"VideoLink":      fmt.Sprintf("https://yourtelehealth.com/appointments/%d/video", appointment.ID),
-	}
+	// Prepare notification data in each recipient's time zone and language
+	patientData := ns.appointmentData(appointment, patient)
+	doctorData := ns.appointmentData(appointment, doctor)
+	startTime := patient.localTime(appointment.StartTime)
 	
 	// Send notifications based on type
 	var err error
 	switch notificationType {
 	case NotificationTypeAppointmentConfirmation:
 		// Send to patient
-		if ns.EmailEnabled {
-			err = ns.sendEmail(patient.Email, "Your Appointment Confirmation", "appointment_confirmation", data)
-			if err != nil {
-				log.Printf("Failed to send confirmation email to patient: %v", err)
-			}
+		err = ns.emailUserWithInvite(patient, notificationType, patient.locale.text("appointment_confirmation.subject"), "appointment_confirmation", patientData, ns.calendarInvite(appointment, &appointment.Patient))
+		if err != nil {
+			log.Printf("Failed to send confirmation email to patient: %v", err)
 		}
 		
-		if ns.SMSEnabled && patient.PhoneNumber != "" {
-			err = ns.sendSMS(patient.PhoneNumber, fmt.Sprintf(
-				"Your appointment with Dr. %s %s has been confirmed for %s at %s. Visit yourtelehealth.com for details.",
-				doctor.FirstName, doctor.LastName, 
-				appointment.StartTime.Format("Jan 2"),
-				appointment.StartTime.Format("3:04 PM"),
-			))
-			if err != nil {
-				log.Printf("Failed to send confirmation SMS to patient: %v", err)
-			}
+		err = ns.smsUser(patient, notificationType, patient.locale.text("appointment_confirmation.sms",
+			doctorName,
+			patient.locale.shortDate(startTime),
+			startTime.Format(patient.locale.clock),
+		))
+		if err != nil {
+			log.Printf("Failed to send confirmation SMS to patient: %v", err)
 		}
 		
 		// Send to doctor
-		if ns.EmailEnabled {
-			err = ns.sendEmail(doctor.Email, "New Appointment Scheduled", "appointment_confirmation_doctor", data)
-			if err != nil {
-				log.Printf("Failed to send confirmation email to doctor: %v", err)
-			}
+		err = ns.emailUserWithInvite(doctor, notificationType, doctor.locale.text("appointment_confirmation.doctor_subject"), "appointment_confirmation_doctor", doctorData, ns.calendarInvite(appointment, &appointment.Doctor))
+		if err != nil {
+			log.Printf("Failed to send confirmation email to doctor: %v", err)
 		}
 		
 	case NotificationTypeAppointmentReminder:
 		// Send to patient
-		if ns.EmailEnabled {
-			err = ns.sendEmail(patient.Email, "Upcoming Appointment Reminder", "appointment_reminder", data)
-			if err != nil {
-				log.Printf("Failed to send reminder email to patient: %v", err)
-			}
+		err = ns.emailUser(patient, notificationType, patient.locale.text("appointment_reminder.subject"), "appointment_reminder", patientData)
+		if err != nil {
+			log.Printf("Failed to send reminder email to patient: %v", err)
 		}
 		
-		if ns.SMSEnabled && patient.PhoneNumber != "" {
-			err = ns.sendSMS(patient.PhoneNumber, fmt.Sprintf(
-				"Reminder: Your appointment with Dr. %s %s is tomorrow at %s. Visit yourtelehealth.com to join the video call.",
-				doctor.FirstName, doctor.LastName, 
-				appointment.StartTime.Format("3:04 PM"),
-			))
-			if err != nil {
-				log.Printf("Failed to send reminder SMS to patient: %v", err)
-			}
+		err = ns.smsUser(patient, notificationType, patient.locale.text("appointment_reminder.sms",
+			doctorName,
+			startTime.Format(patient.locale.clock),
+		))
+		if err != nil {
+			log.Printf("Failed to send reminder SMS to patient: %v", err)
 		}
 		
 		// Send to doctor
-		if ns.EmailEnabled {
-			err = ns.sendEmail(doctor.Email, "Upcoming Appointment Reminder", "appointment_reminder_doctor", data)
-			if err != nil {
-				log.Printf("Failed to send reminder email to doctor: %v", err)
-			}
+		err = ns.emailUser(doctor, notificationType, doctor.locale.text("appointment_reminder.doctor_subject"), "appointment_reminder_doctor", doctorData)
+		if err != nil {
+			log.Printf("Failed to send reminder email to doctor: %v", err)
 		}
 		
 	case NotificationTypeAppointmentCancellation:
 		// Send to patient
-		if ns.EmailEnabled {
-			err = ns.sendEmail(patient.Email, "Appointment Cancelled", "appointment_cancellation", data)
-			if err != nil {
-				log.Printf("Failed to send cancellation email to patient: %v", err)
-			}
+		err = ns.emailUser(patient, notificationType, patient.locale.text("appointment_cancellation.subject"), "appointment_cancellation", patientData)
+		if err != nil {
+			log.Printf("Failed to send cancellation email to patient: %v", err)
 		}
 		
-		if ns.SMSEnabled && patient.PhoneNumber != "" {
-			err = ns.sendSMS(patient.PhoneNumber, fmt.Sprintf(
-				"Your appointment with Dr. %s %s on %s at %s has been cancelled.",
-				doctor.FirstName, doctor.LastName, 
-				appointment.StartTime.Format("Jan 2"),
-				appointment.StartTime.Format("3:04 PM"),
-			))
-			if err != nil {
-				log.Printf("Failed to send cancellation SMS to patient: %v", err)
-			}
+		err = ns.smsUser(patient, notificationType, patient.locale.text("appointment_cancellation.sms",
+			doctorName,
+			patient.locale.shortDate(startTime),
+			startTime.Format(patient.locale.clock),
+		))
+		if err != nil {
+			log.Printf("Failed to send cancellation SMS to patient: %v", err)
 		}
 		
 		// Send to doctor
-		if ns.EmailEnabled {
-			err = ns.sendEmail(doctor.Email, "Appointment Cancelled", "appointment_cancellation_doctor", data)
-			if err != nil {
-				log.Printf("Failed to send cancellation email to doctor: %v", err)
-			}
+		err = ns.emailUser(doctor, notificationType, doctor.locale.text("appointment_cancellation.doctor_subject"), "appointment_cancellation_doctor", doctorData)
+		if err != nil {
+			log.Printf("Failed to send cancellation email to doctor: %v", err)
 		}
 		
 	case NotificationTypeAppointmentUpdate:
 		// Send to patient
-		if ns.EmailEnabled {
-			err = ns.sendEmail(patient.Email, "Appointment Updated", "appointment_update", data)
-			if err != nil {
-				log.Printf("Failed to send update email to patient: %v", err)
-			}
+		err = ns.emailUser(patient, notificationType, patient.locale.text("appointment_update.subject"), "appointment_update", patientData)
+		if err != nil {
+			log.Printf("Failed to send update email to patient: %v", err)
 		}
 		
-		if ns.SMSEnabled && patient.PhoneNumber != "" {
-			err = ns.sendSMS(patient.PhoneNumber, fmt.Sprintf(
-				"Your appointment with Dr. %s %s has been updated. Please check yourtelehealth.com for details.",
-				doctor.FirstName, doctor.LastName,
-			))
-			if err != nil {
-				log.Printf("Failed to send update SMS to patient: %v", err)
-			}
+		err = ns.smsUser(patient, notificationType, patient.locale.text("appointment_update.sms", doctorName))
+		if err != nil {
+			log.Printf("Failed to send update SMS to patient: %v", err)
 		}
 		
 		// Send to doctor
-		if ns.EmailEnabled {
-			err = ns.sendEmail(doctor.Email, "Appointment Updated", "appointment_update_doctor", data)
-			if err != nil {
-				log.Printf("Failed to send update email to doctor: %v", err)
-			}
+		err = ns.emailUser(doctor, notificationType, doctor.locale.text("appointment_update.doctor_subject"), "appointment_update_doctor", doctorData)
+		if err != nil {
+			log.Printf("Failed to send update email to doctor: %v", err)
 		}
 	}
 	
 	return nil
 }
 
+// SendRescheduleNotification tells the patient and doctor an appointment has moved
+func (ns *NotificationService) SendRescheduleNotification(appointment *models.Appointment, previousStart time.Time) error {
+	patient := ns.recipientFor(&appointment.Patient)
+	doctor := ns.recipientFor(&appointment.Doctor)
+	doctorName := fmt.Sprintf("Dr. %s %s", appointment.Doctor.FirstName, appointment.Doctor.LastName)
+	notificationType := NotificationTypeAppointmentRescheduled
+	
+	// Include the previous time in each recipient's time zone
+	withPrevious := func(r recipient) map[string]interface{} {
+		data := ns.appointmentData(appointment, r)
+		previous := r.localTime(previousStart)
+		data["PreviousDate"] = r.locale.longDate(previous)
+		data["PreviousStartTime"] = previous.Format(r.locale.clock)
+		return data
+	}
+	
+	// Send to patient
+	if err := ns.emailUser(patient, notificationType, patient.locale.text("appointment_rescheduled.subject"), "appointment_rescheduled", withPrevious(patient)); err != nil {
+		log.Printf("Failed to send reschedule email to patient: %v", err)
+	}
+	
+	startTime := patient.localTime(appointment.StartTime)
+	if err := ns.smsUser(patient, notificationType, patient.locale.text("appointment_rescheduled.sms",
+		doctorName,
+		patient.locale.shortDate(startTime),
+		startTime.Format(patient.locale.clock),
+	)); err != nil {
+		log.Printf("Failed to send reschedule SMS to patient: %v", err)
+	}
+	
+	// Send to doctor
+	if err := ns.emailUser(doctor, notificationType, doctor.locale.text("appointment_rescheduled.doctor_subject"), "appointment_rescheduled_doctor", withPrevious(doctor)); err != nil {
+		log.Printf("Failed to send reschedule email to doctor: %v", err)
+	}
+	
+	return nil
+}
+
 // SendAppointmentReminders sends reminders for appointments that are coming up
 func (ns *NotificationService) SendAppointmentReminders() error {
 	// Get appointments that are happening tomorrow
@@ -255,23 +288,332 @@ func (ns *NotificationService) SendAppointmentReminders() error {
 	return nil
 }
 
-// sendEmail sends an email using a template
-func (ns *NotificationService) sendEmail(to, subject, templateName string, data map[string]interface{}) error {
-	if !ns.EmailEnabled {
+// SendWaitlistOffer tells a waitlisted patient a slot is free and how long they have to claim it
+func (ns *NotificationService) SendWaitlistOffer(offer *models.WaitlistOffer, patient, doctor *models.User, claimURL string) error {
+	recipient := ns.recipientFor(patient)
+	doctorName := fmt.Sprintf("Dr. %s %s", doctor.FirstName, doctor.LastName)
+	startTime := recipient.localTime(offer.StartTime)
+	endTime := recipient.localTime(offer.EndTime)
+	expiresAt := recipient.localTime(offer.ExpiresAt)
+	
+	data := map[string]interface{}{
+		"PatientName":     fmt.Sprintf("%s %s", patient.FirstName, patient.LastName),
+		"DoctorName":      doctorName,
+		"AppointmentDate": recipient.locale.longDate(startTime),
+		"StartTime":       startTime.Format(recipient.locale.clock),
+		"EndTime":         endTime.Format(recipient.locale.clock),
+		"ClaimURL":        claimURL,
+		"ExpiresAt":       recipient.locale.longDate(expiresAt) + " " + expiresAt.Format(recipient.locale.clock),
+		"CurrentYear":     time.Now().Year(),
+	}
+	for key, value := range ns.organizationBranding(offer.OrganizationID) {
+		data[key] = value
+	}
+	
+	if err := ns.emailUser(recipient, NotificationTypeWaitlistOffer, recipient.locale.text("waitlist_offer.subject"), "waitlist_offer", data); err != nil {
+		log.Printf("Failed to send waitlist offer email to user %d: %v", patient.ID, err)
+	}
+	
+	if err := ns.smsUser(recipient, NotificationTypeWaitlistOffer, recipient.locale.text("waitlist_offer.sms",
+		doctorName,
+		recipient.locale.shortDate(startTime),
+		startTime.Format(recipient.locale.clock),
+		expiresAt.Format(recipient.locale.clock),
+		claimURL,
+	)); err != nil {
+		log.Printf("Failed to send waitlist offer SMS to user %d: %v", patient.ID, err)
+	}
+	
+	return nil
+}
+
+// SendParticipantInvitation tells an invited participant when the appointment
+// is, who it is with and how to join the call
+func (ns *NotificationService) SendParticipantInvitation(appointment *models.Appointment, participant *models.AppointmentParticipant) error {
+	recipient := ns.recipientFor(&participant.User)
+	doctorName := fmt.Sprintf("Dr. %s %s", appointment.Doctor.FirstName, appointment.Doctor.LastName)
+	startTime := recipient.localTime(appointment.StartTime)
+	
+	// The reason for the visit stays between the patient and doctor
+	data := ns.appointmentData(appointment, recipient)
+	delete(data, "Reason")
+	data["ParticipantName"] = fmt.Sprintf("%s %s", participant.User.FirstName, participant.User.LastName)
+	data["ParticipantRole"] = recipient.locale.text("participant_role." + string(participant.Role))
+	
+	if err := ns.emailUserWithInvite(recipient, NotificationTypeAppointmentInvitation, recipient.locale.text("appointment_invitation.subject"), "appointment_invitation", data, ns.calendarInvite(appointment, &participant.User)); err != nil {
+		log.Printf("Failed to send appointment invitation email to user %d: %v", participant.UserID, err)
+	}
+	
+	if err := ns.smsUser(recipient, NotificationTypeAppointmentInvitation, recipient.locale.text("appointment_invitation.sms",
+		doctorName,
+		recipient.locale.shortDate(startTime),
+		startTime.Format(recipient.locale.clock),
+		VideoLink(appointment.ID),
+	)); err != nil {
+		log.Printf("Failed to send appointment invitation SMS to user %d: %v", participant.UserID, err)
+	}
+	
+	return nil
+}
+
+// SendDataExportNotification tells a user that their data export is ready to download
+func (ns *NotificationService) SendDataExportNotification(user *models.User, downloadURL string, expiresAt time.Time) error {
+	recipient := ns.recipientFor(user)
+	localExpiry := recipient.localTime(expiresAt)
+	
+	data := map[string]interface{}{
+		"Name":        fmt.Sprintf("%s %s", user.FirstName, user.LastName),
+		"DownloadURL": downloadURL,
+		"ExpiresAt":   recipient.locale.longDate(localExpiry) + " " + localExpiry.Format(recipient.locale.clock),
+		"CurrentYear": time.Now().Year(),
+	}
+	
+	if err := ns.emailUser(recipient, NotificationTypeDataExportReady, recipient.locale.text("data_export_ready.subject"), "data_export_ready", data); err != nil {
+		log.Printf("Failed to send data export email to user %d: %v", user.ID, err)
+	}
+	
+	if err := ns.smsUser(recipient, NotificationTypeDataExportReady, recipient.locale.text("data_export_ready.sms")); err != nil {
+		log.Printf("Failed to send data export SMS to user %d: %v", user.ID, err)
+	}
+	
+	return nil
+}
+
+// DeliverPendingNotifications sends notifications that were held back for quiet hours
+func (ns *NotificationService) DeliverPendingNotifications() error {
+	var pending []models.PendingNotification
+	if err := ns.DB.Where("send_after <= ?", time.Now()).Order("send_after ASC").Limit(500).Find(&pending).Error; err != nil {
+		return fmt.Errorf("failed to fetch pending notifications: %w", err)
+	}
+	
+	for _, notification := range pending {
+		var err error
+		switch notification.Channel {
+		case models.ChannelEmail:
+			err = ns.sendEmail(notification.Recipient, notification.Subject, notification.Body, notification.Invite)
+		case models.ChannelSMS:
+			err = ns.sendSMS(notification.Recipient, notification.Body)
+		}
+		ns.logNotification(notification.UserID, NotificationType(notification.Type), notification.Channel, notification.Recipient, notification.Subject, err)
+		
+		if err := ns.DB.Delete(&notification).Error; err != nil {
+			log.Printf("Failed to remove pending notification %d: %v", notification.ID, err)
+		}
+	}
+	
+	return nil
+}
+
+// recipient is a user with the preferences that control their notifications
+type recipient struct {
+	user        *models.User
+	preferences models.UserPreferences
+	locale      *notificationLocale
+}
+
+// localTime converts t to the recipient's time zone
+func (r recipient) localTime(t time.Time) time.Time {
+	return t.In(r.preferences.Location())
+}
+
+// recipientFor loads a user's notification preferences, using defaults if they have none
+func (ns *NotificationService) recipientFor(user *models.User) recipient {
+	preferences := models.DefaultUserPreferences(user.ID)
+	if ns.DB != nil && user.ID != 0 {
+		var saved []models.UserPreferences
+		if err := ns.DB.Where("user_id = ?", user.ID).Limit(1).Find(&saved).Error; err != nil {
+			log.Printf("Failed to load notification preferences for user %d: %v", user.ID, err)
+		} else if len(saved) > 0 {
+			preferences = saved[0]
+		}
+	}
+	
+	return recipient{
+		user:        user,
+		preferences: preferences,
+		locale:      localeFor(preferences.Language),
+	}
+}
+
+// appointmentData builds the template data for an appointment in the recipient's time zone and language
+func (ns *NotificationService) appointmentData(appointment *models.Appointment, r recipient) map[string]interface{} {
+	startTime := r.localTime(appointment.StartTime)
+	endTime := r.localTime(appointment.EndTime)
+	
+	data := map[string]interface{}{
+		"PatientName":    fmt.Sprintf("%s %s", appointment.Patient.FirstName, appointment.Patient.LastName),
+		"DoctorName":     fmt.Sprintf("Dr. %s %s", appointment.Doctor.FirstName, appointment.Doctor.LastName),
+		"AppointmentID":  appointment.ID,
+		"AppointmentDate": r.locale.longDate(startTime),
+		"StartTime":      startTime.Format(r.locale.clock),
+		"EndTime":        endTime.Format(r.locale.clock),
+		"Status":         appointment.Status,
+		"Reason":         appointment.Reason,
+		"VideoLink":      VideoLink(appointment.ID),
+		"CurrentYear":    time.Now().Year(),
+	}
+	
+	// Apply the clinic's branding
+	for key, value := range ns.organizationBranding(appointment.OrganizationID) {
+		data[key] = value
+	}
+	
+	return data
+}
+
+// calendarInvite returns an appointment as an iCalendar file for one participant
+func (ns *NotificationService) calendarInvite(appointment *models.Appointment, viewer *models.User) string {
+	if ns.DB == nil {
+		return ""
+	}
+	calendar := (&CalendarService{DB: ns.DB}).AppointmentCalendar(appointment, viewer)
+	return calendar.String()
+}
+
+// VideoLink returns the page patients and doctors open to join an appointment's video call
+func VideoLink(appointmentID uint) string {
+	return fmt.Sprintf("https://yourtelehealth.com/appointments/%d/video", appointmentID)
+}
+
+// organizationBranding returns the template fields used to brand an organization's emails
+func (ns *NotificationService) organizationBranding(organizationID uint) map[string]interface{} {
+	branding := map[string]interface{}{
+		"ClinicName":   "Telehealth Platform",
+		"LogoURL":      "",
+		"SupportEmail": ns.EmailConfig.FromEmail,
+	}
+	
+	if ns.DB == nil || organizationID == 0 {
+		return branding
+	}
+	
+	var organization models.Organization
+	if err := ns.DB.First(&organization, organizationID).Error; err != nil {
+		log.Printf("Failed to load branding for organization %d: %v", organizationID, err)
+		return branding
+	}
+	
+	branding["ClinicName"] = organization.Name
+	branding["LogoURL"] = organization.LogoURL
+	if organization.SupportEmail != "" {
+		branding["SupportEmail"] = organization.SupportEmail
+	}
+	return branding
+}
+
+// emailUser renders a templated email in the user's language and delivers it if
+// the user accepts this notification type by email
+func (ns *NotificationService) emailUser(r recipient, notificationType NotificationType, subject, templateName string, data map[string]interface{}) error {
+	return ns.emailUserWithInvite(r, notificationType, subject, templateName, data, "")
+}
+
+// emailUserWithInvite is emailUser with an iCalendar invite attached, unless invite is empty
+func (ns *NotificationService) emailUserWithInvite(r recipient, notificationType NotificationType, subject, templateName string, data map[string]interface{}, invite string) error {
+	if !ns.EmailEnabled || !r.preferences.AllowsChannel(string(notificationType), models.ChannelEmail) {
+		return nil
+	}
+	
+	body, err := renderEmail(templateName, r.preferences.Language, data)
+	if err != nil {
+		ns.logNotification(r.user.ID, notificationType, models.ChannelEmail, r.user.Email, subject, err)
+		return err
+	}
+	
+	return ns.deliver(r, notificationType, models.ChannelEmail, r.user.Email, subject, body, invite)
+}
+
+// smsUser delivers an SMS if the user has a phone number and accepts this notification type by SMS
+func (ns *NotificationService) smsUser(r recipient, notificationType NotificationType, message string) error {
+	if !ns.SMSEnabled || r.user.PhoneNumber == "" || !r.preferences.AllowsChannel(string(notificationType), models.ChannelSMS) {
 		return nil
 	}
 	
+	return ns.deliver(r, notificationType, models.ChannelSMS, r.user.PhoneNumber, "", message, "")
+}
+
+// deliver sends a rendered notification now, or holds it until the recipient's
+// quiet hours end unless the type ignores them
+func (ns *NotificationService) deliver(r recipient, notificationType NotificationType, channel models.NotificationChannel, to, subject, body, invite string) error {
+	if sendAfter, quiet := r.preferences.QuietHoursEndAfter(time.Now()); quiet && ns.DB != nil && !ignoresQuietHours[notificationType] {
+		pending := models.PendingNotification{
+			UserID:    r.user.ID,
+			Type:      string(notificationType),
+			Channel:   channel,
+			Recipient: to,
+			Subject:   subject,
+			Body:      body,
+			Invite:    invite,
+			SendAfter: sendAfter,
+		}
+		if err := ns.DB.Create(&pending).Error; err != nil {
+			return fmt.Errorf("failed to queue notification for quiet hours: %w", err)
+		}
+		return nil
+	}
+	
+	var err error
+	switch channel {
+	case models.ChannelEmail:
+		err = ns.sendEmail(to, subject, body, invite)
+	case models.ChannelSMS:
+		err = ns.sendSMS(to, body)
+	}
+	ns.logNotification(r.user.ID, notificationType, channel, to, subject, err)
+	return err
+}
+
+// logNotification stores the outcome of a notification delivery attempt
+func (ns *NotificationService) logNotification(userID uint, notificationType NotificationType, channel models.NotificationChannel, recipient, subject string, sendErr error) {
+	if ns.DB == nil || userID == 0 {
+		return
+	}
+	
+	entry := models.NotificationLog{
+		UserID:    userID,
+		Type:      string(notificationType),
+		Channel:   channel,
+		Recipient: recipient,
+		Subject:   subject,
+		Status:    "sent",
+	}
+	if sendErr != nil {
+		entry.Status = "failed"
+		entry.Error = sendErr.Error()
+	}
+	
+	if err := ns.DB.Create(&entry).Error; err != nil {
+		log.Printf("Failed to record notification for user %d: %v", userID, err)
+	}
+}
+
+// renderEmail renders an email template, preferring a translation in
+// templates/emails/<language>/ when one exists
+func renderEmail(templateName, language string, data map[string]interface{}) (string, error) {
 	// Get email template
 	templatePath := fmt.Sprintf("templates/emails/%s.html", templateName)
+	if localized := fmt.Sprintf("templates/emails/%s/%s.html", language, templateName); language != "" {
+		if _, err := os.Stat(localized); err == nil {
+			templatePath = localized
+		}
+	}
 	tmpl, err := template.ParseFiles(templatePath)
 	if err != nil {
-		return fmt.Errorf("failed to parse email template: %w", err)
+		return "", fmt.Errorf("failed to parse email template: %w", err)
 	}
 	
 	// Render template
 	var body bytes.Buffer
 	if err := tmpl.Execute(&body, data); err != nil {
-		return fmt.Errorf("failed to execute email template: %w", err)
+		return "", fmt.Errorf("failed to execute email template: %w", err)
+	}
+	
+	return body.String(), nil
+}
+
+// sendEmail sends a rendered HTML email, attaching an iCalendar invite if one is given
+func (ns *NotificationService) sendEmail(to, subject, body, invite string) error {
+	if !ns.EmailEnabled {
+		return nil
 	}
 	
 	// Create email message
@@ -279,7 +621,16 @@ func (ns *NotificationService) sendEmail(to, subject, templateName string, data
 	m.SetHeader("From", fmt.Sprintf("%s <%s>", ns.EmailConfig.FromName, ns.EmailConfig.FromEmail))
 	m.SetHeader("To", to)
 	m.SetHeader("Subject", subject)
-	m.SetBody("text/html", body.String())
+	m.SetBody("text/html", body)
+	if invite != "" {
+		m.Attach("invite.ics",
+			gomail.SetHeader(map[string][]string{"Content-Type": {`text/calendar; charset="UTF-8"; method=PUBLISH`}}),
+			gomail.SetCopyFunc(func(w io.Writer) error {
+				_, err := io.WriteString(w, invite)
+				return err
+			}),
+		)
+	}
 	
 	// Create SMTP dialer
 	d := gomail.NewDialer(
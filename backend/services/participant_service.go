@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// Errors returned by ParticipantService
+var (
+	ErrParticipantEnded     = errors.New("participants can only be invited before the appointment ends")
+	ErrParticipantIsParty   = errors.New("the patient and doctor are already on the appointment")
+	ErrParticipantNotMember = errors.New("participants must be members of the organization")
+	ErrParticipantExists    = errors.New("this user is already a participant")
+	ErrParticipantNotFound  = errors.New("participant not found")
+)
+
+// ParticipantService manages the people invited to an appointment besides
+// its patient and doctor
+type ParticipantService struct {
+	DB                  *gorm.DB
+	NotificationService *NotificationService
+}
+
+// NewParticipantService creates a new participant service
+func NewParticipantService() *ParticipantService {
+	return &ParticipantService{
+		DB:                  config.DB,
+		NotificationService: NewNotificationService(config.DB),
+	}
+}
+
+// Participants returns an appointment's participants, earliest invited first
+func (ps *ParticipantService) Participants(ctx context.Context, appointmentID uint) ([]models.AppointmentParticipant, error) {
+	var participants []models.AppointmentParticipant
+	if err := ps.DB.WithContext(ctx).Preload("User").Where("appointment_id = ?", appointmentID).
+		Order("created_at ASC, id ASC").Find(&participants).Error; err != nil {
+		return nil, fmt.Errorf("failed to load participants: %w", err)
+	}
+	return participants, nil
+}
+
+// Invite adds a member of the appointment's organization as a participant
+// and sends them an invitation
+func (ps *ParticipantService) Invite(ctx context.Context, appointment *models.Appointment, userID uint, role models.ParticipantRole, actor Actor) (*models.AppointmentParticipant, error) {
+	db := ps.DB.WithContext(ctx)
+
+	if appointment.Status.IsFinal() || !time.Now().Before(appointment.EndTime) {
+		return nil, ErrParticipantEnded
+	}
+	if userID == appointment.PatientID || userID == appointment.DoctorID {
+		return nil, ErrParticipantIsParty
+	}
+
+	var members int64
+	if err := db.Model(&models.OrganizationMembership{}).
+		Where("organization_id = ? AND user_id = ?", appointment.OrganizationID, userID).
+		Count(&members).Error; err != nil {
+		return nil, fmt.Errorf("failed to check organization membership: %w", err)
+	}
+	if members == 0 {
+		return nil, ErrParticipantNotMember
+	}
+
+	participant := models.AppointmentParticipant{
+		OrganizationID: appointment.OrganizationID,
+		AppointmentID:  appointment.ID,
+		UserID:         userID,
+		Role:           role,
+		InvitedByID:    actor.ID,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&participant)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrParticipantExists
+		}
+		return RecordAppointmentEvent(tx, appointment, models.AppointmentEventParticipants, actor,
+			[]models.FieldChange{{Field: participantField(&participant), After: userID}}, "")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Load related entities for the invitation
+	if err := db.Preload("User").First(&participant, participant.ID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load participant: %w", err)
+	}
+	invited := *appointment
+	if err := db.Preload("Patient").Preload("Doctor").First(&invited, appointment.ID).Error; err != nil {
+		log.Printf("Failed to load appointment %d for participant invitation: %v", appointment.ID, err)
+	} else {
+		go ps.NotificationService.SendParticipantInvitation(&invited, &participant)
+	}
+
+	return &participant, nil
+}
+
+// Remove takes a participant off an appointment; their access ends at once
+func (ps *ParticipantService) Remove(ctx context.Context, appointment *models.Appointment, participantID uint, actor Actor) error {
+	return ps.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var participant models.AppointmentParticipant
+		if err := tx.Where("appointment_id = ?", appointment.ID).First(&participant, participantID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrParticipantNotFound
+			}
+			return err
+		}
+		if err := tx.Delete(&participant).Error; err != nil {
+			return err
+		}
+		return RecordAppointmentEvent(tx, appointment, models.AppointmentEventParticipants, actor,
+			[]models.FieldChange{{Field: participantField(&participant), Before: participant.UserID}}, "")
+	})
+}
+
+// ActiveParticipant returns the user's participant entry on an appointment
+// if they are invited and their access has not ended
+func ActiveParticipant(db *gorm.DB, appointment *models.Appointment, userID uint) (*models.AppointmentParticipant, bool) {
+	var participants []models.AppointmentParticipant
+	if err := db.Where("appointment_id = ? AND user_id = ?", appointment.ID, userID).
+		Limit(1).Find(&participants).Error; err != nil {
+		log.Printf("Failed to load participant %d of appointment %d: %v", userID, appointment.ID, err)
+		return nil, false
+	}
+	if len(participants) == 0 || !participants[0].HasAccess(appointment, time.Now()) {
+		return nil, false
+	}
+	return &participants[0], true
+}
+
+// participantField names a participant's entry in the appointment history
+func participantField(participant *models.AppointmentParticipant) string {
+	return "participant." + string(participant.Role)
+}
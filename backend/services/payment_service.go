@@ -17,6 +17,7 @@ type PaymentService struct {
 	Enabled     bool
 	APIKey      string
 	APIEndpoint string
+	Currency    string
 }
 
 // PaymentStatus represents the status of a payment
@@ -34,6 +35,12 @@ const (
 	
 	// PaymentStatusRefunded means the payment was refunded
 	PaymentStatusRefunded PaymentStatus = "refunded"
+	
+	// PaymentStatusPartiallyRefunded means part of the payment was refunded
+	PaymentStatusPartiallyRefunded PaymentStatus = "partially_refunded"
+	
+	// PaymentStatusRefundPending means a refund is owed and has not been sent yet
+	PaymentStatusRefundPending PaymentStatus = "refund_pending"
 )
 
 // PaymentMethod represents the available payment methods
@@ -80,9 +87,24 @@ func NewPaymentService() *PaymentService {
 		Enabled:     os.Getenv("PAYMENT_ENABLED") == "true",
 		APIKey:      os.Getenv("EVERSEND_API_KEY"),
 		APIEndpoint: os.Getenv("EVERSEND_API_ENDPOINT"),
+		Currency:    "USD",
 	}
 }
 
+// ForOrganization returns a copy of the service using an organization's payment settings.
+// Organizations without their own API key use the platform key.
+func (ps *PaymentService) ForOrganization(organization *models.Organization) *PaymentService {
+	scoped := *ps
+	scoped.Enabled = ps.Enabled && organization.PaymentEnabled
+	if organization.EversendAPIKey != "" {
+		scoped.APIKey = organization.EversendAPIKey
+	}
+	if organization.Currency != "" {
+		scoped.Currency = organization.Currency
+	}
+	return &scoped
+}
+
 // CreatePayment creates a new payment for an appointment
 func (ps *PaymentService) CreatePayment(appointment *models.Appointment, paymentDetails *models.PaymentDetails) (*PaymentResponse, error) {
 	if !ps.Enabled {
@@ -106,7 +128,7 @@ func (ps *PaymentService) CreatePayment(appointment *models.Appointment, payment
 	// Create payment request
 	paymentRequest := PaymentRequest{
 		Amount:        paymentDetails.Amount,
-		Currency:      "USD", // Or use dynamic currency
+		Currency:      ps.Currency,
 		CustomerEmail: patient.Email,
 		CustomerName:  fmt.Sprintf("%s %s", patient.FirstName, patient.LastName),
 		CustomerPhone: patient.PhoneNumber, // Used for mobile money
@@ -203,6 +225,11 @@ func (ps *PaymentService) VerifyPayment(paymentID string) (*PaymentResponse, err
 
 // RefundPayment refunds a payment
 func (ps *PaymentService) RefundPayment(paymentID string, reason string) error {
+	return ps.RefundAmount(paymentID, 0, reason)
+}
+
+// RefundAmount refunds part of a payment. An amount of zero refunds it in full.
+func (ps *PaymentService) RefundAmount(paymentID string, amount float64, reason string) error {
 	if !ps.Enabled {
 		return fmt.Errorf("payment service is not enabled")
 	}
@@ -212,9 +239,12 @@ func (ps *PaymentService) RefundPayment(paymentID string, reason string) error {
 	}
 	
 	// Create refund request
-	refundRequest := map[string]string{
+	refundRequest := map[string]interface{}{
 		"reason": reason,
 	}
+	if amount > 0 {
+		refundRequest["amount"] = amount
+	}
 	
 	// Convert request to JSON
 	jsonData, err := json.Marshal(refundRequest)
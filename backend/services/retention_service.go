@@ -0,0 +1,330 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// ErrDeletionAlreadyRequested is returned when a user already has a pending deletion request
+var ErrDeletionAlreadyRequested = errors.New("account deletion already requested")
+
+// ErrNoPendingDeletion is returned when there is no pending deletion request to cancel
+var ErrNoPendingDeletion = errors.New("no pending account deletion request")
+
+// RetentionService handles account deletion, anonymization and record retention
+type RetentionService struct {
+	DB                 *gorm.DB
+	CoolingOffPeriod   time.Duration
+	ClinicalRetention  time.Duration
+	FinancialRetention time.Duration
+	AppointmentService *AppointmentService
+}
+
+// NewRetentionService creates a new retention service
+func NewRetentionService() *RetentionService {
+	return &RetentionService{
+		DB:                 config.DB,
+		CoolingOffPeriod:   time.Duration(envInt("ACCOUNT_DELETION_COOLING_OFF_DAYS", 14)) * 24 * time.Hour,
+		ClinicalRetention:  time.Duration(envInt("RETENTION_CLINICAL_YEARS", 10)) * 365 * 24 * time.Hour,
+		FinancialRetention: time.Duration(envInt("RETENTION_FINANCIAL_YEARS", 7)) * 365 * 24 * time.Hour,
+		AppointmentService: NewAppointmentService(),
+	}
+}
+
+// RequestDeletion schedules a user's account for deletion after the cooling-off period
+func (rs *RetentionService) RequestDeletion(userID, requestedBy uint, reason string) (*models.AccountDeletionRequest, error) {
+	var existing models.AccountDeletionRequest
+	err := rs.DB.Where("user_id = ? AND status = ?", userID, models.DeletionStatusPending).First(&existing).Error
+	if err == nil {
+		return &existing, ErrDeletionAlreadyRequested
+	}
+
+	request := models.AccountDeletionRequest{
+		UserID:       userID,
+		RequestedBy:  requestedBy,
+		Status:       models.DeletionStatusPending,
+		Reason:       reason,
+		ScheduledFor: time.Now().Add(rs.CoolingOffPeriod),
+	}
+	if err := rs.DB.Create(&request).Error; err != nil {
+		return nil, fmt.Errorf("failed to create deletion request: %w", err)
+	}
+
+	return &request, nil
+}
+
+// CancelDeletion cancels a user's pending deletion request
+func (rs *RetentionService) CancelDeletion(userID uint) (*models.AccountDeletionRequest, error) {
+	var request models.AccountDeletionRequest
+	if err := rs.DB.Where("user_id = ? AND status = ?", userID, models.DeletionStatusPending).
+		First(&request).Error; err != nil {
+		return nil, ErrNoPendingDeletion
+	}
+
+	now := time.Now()
+	request.Status = models.DeletionStatusCancelled
+	request.CancelledAt = &now
+	if err := rs.DB.Save(&request).Error; err != nil {
+		return nil, fmt.Errorf("failed to cancel deletion request: %w", err)
+	}
+
+	return &request, nil
+}
+
+// ProcessDueDeletions anonymizes accounts whose cooling-off period has passed
+func (rs *RetentionService) ProcessDueDeletions() error {
+	var requests []models.AccountDeletionRequest
+	if err := rs.DB.Where("status = ? AND scheduled_for <= ?", models.DeletionStatusPending, time.Now()).
+		Find(&requests).Error; err != nil {
+		return fmt.Errorf("failed to fetch due deletion requests: %w", err)
+	}
+
+	for _, request := range requests {
+		if err := rs.AnonymizeUser(request.UserID); err != nil {
+			log.Printf("Failed to anonymize user %d: %v", request.UserID, err)
+			continue
+		}
+
+		now := time.Now()
+		request.Status = models.DeletionStatusCompleted
+		request.CompletedAt = &now
+		rs.DB.Save(&request)
+	}
+
+	return nil
+}
+
+// AnonymizeUser strips personal fields from a user while keeping clinical and financial records
+func (rs *RetentionService) AnonymizeUser(userID uint) error {
+	var exportFiles []string
+	var upcoming []models.Appointment
+
+	err := rs.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return fmt.Errorf("failed to load user: %w", err)
+		}
+
+		// Replace identifying fields
+		now := time.Now()
+		user.Email = fmt.Sprintf("deleted-user-%d@anonymized.invalid", user.ID)
+		user.FirstName = "Deleted"
+		user.LastName = "User"
+		user.PasswordHash = "!"
+		user.PhoneNumber = ""
+		user.Address = ""
+		user.DateOfBirth = nil
+		user.TwoFactorEnabled = false
+		user.TwoFactorSecretEncrypted = ""
+		user.AnonymizedAt = &now
+		if err := tx.Save(&user).Error; err != nil {
+			return fmt.Errorf("failed to anonymize user: %w", err)
+		}
+
+		// Upcoming appointments are cancelled once the account is gone
+		if err := tx.Where("(patient_id = ? OR doctor_id = ?) AND status IN ? AND start_time > ?",
+			user.ID, user.ID, []models.AppointmentStatus{models.StatusScheduled, models.StatusHeld}, now).Find(&upcoming).Error; err != nil {
+			return fmt.Errorf("failed to load upcoming appointments: %w", err)
+		}
+
+		// Notification history holds contact details and has no retention requirement
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.NotificationLog{}).Error; err != nil {
+			return fmt.Errorf("failed to delete notification history: %w", err)
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.PendingNotification{}).Error; err != nil {
+			return fmt.Errorf("failed to delete pending notifications: %w", err)
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.UserPreferences{}).Error; err != nil {
+			return fmt.Errorf("failed to delete notification preferences: %w", err)
+		}
+
+		// Doctors stop being bookable
+		if err := tx.Where("doctor_id = ?", user.ID).Delete(&models.AvailabilityRule{}).Error; err != nil {
+			return fmt.Errorf("failed to delete availability: %w", err)
+		}
+		if err := tx.Where("doctor_id = ?", user.ID).Delete(&models.AvailabilityException{}).Error; err != nil {
+			return fmt.Errorf("failed to delete availability exceptions: %w", err)
+		}
+		if err := tx.Where("doctor_id = ?", user.ID).Delete(&models.CancellationPolicy{}).Error; err != nil {
+			return fmt.Errorf("failed to delete cancellation policy: %w", err)
+		}
+		if err := tx.Where("doctor_id = ?", user.ID).Delete(&models.SchedulingRules{}).Error; err != nil {
+			return fmt.Errorf("failed to delete scheduling rules: %w", err)
+		}
+
+		// Waitlist reasons describe symptoms; drop the patient's entries and a doctor's waitlist
+		if err := tx.Where("patient_id = ? OR doctor_id = ?", user.ID, user.ID).Delete(&models.WaitlistOffer{}).Error; err != nil {
+			return fmt.Errorf("failed to delete waitlist offers: %w", err)
+		}
+		if err := tx.Where("patient_id = ? OR doctor_id = ?", user.ID, user.ID).Delete(&models.WaitlistEntry{}).Error; err != nil {
+			return fmt.Errorf("failed to delete waitlist entries: %w", err)
+		}
+
+		// Intake answers are health information
+		if err := tx.Where("patient_id = ?", user.ID).Delete(&models.IntakeResponse{}).Error; err != nil {
+			return fmt.Errorf("failed to delete intake answers: %w", err)
+		}
+
+		// End the user's invitations to other people's appointments
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.AppointmentParticipant{}).Error; err != nil {
+			return fmt.Errorf("failed to delete appointment invitations: %w", err)
+		}
+
+		// Leave every organization, so the account no longer has a role anywhere
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.OrganizationMembership{}).Error; err != nil {
+			return fmt.Errorf("failed to delete organization memberships: %w", err)
+		}
+
+		// Revoke the calendar feed link
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.CalendarFeed{}).Error; err != nil {
+			return fmt.Errorf("failed to delete calendar feed: %w", err)
+		}
+
+		// Review text is free-form and may identify the patient; keep only the ratings
+		if err := tx.Model(&models.Review{}).Where("patient_id = ?", user.ID).
+			Update("comment", "").Error; err != nil {
+			return fmt.Errorf("failed to clear review comments: %w", err)
+		}
+
+		// Remove any data exports
+		var exports []models.DataExport
+		if err := tx.Where("user_id = ?", user.ID).Find(&exports).Error; err != nil {
+			return fmt.Errorf("failed to load data exports: %w", err)
+		}
+		for _, export := range exports {
+			if export.FilePath != "" {
+				exportFiles = append(exportFiles, export.FilePath)
+			}
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.DataExport{}).Error; err != nil {
+			return fmt.Errorf("failed to delete data exports: %w", err)
+		}
+
+		// Soft delete so the account can no longer be used
+		if err := tx.Delete(&user).Error; err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Cancel through the lifecycle so payments are refunded, the other party
+	// is told and the freed slots go to the waitlist
+	for i := range upcoming {
+		if _, err := rs.AppointmentService.Transition(context.Background(), &upcoming[i], models.StatusCancelled,
+			SystemActor, "Account deleted"); err != nil {
+			log.Printf("Failed to cancel appointment %d of deleted user %d: %v", upcoming[i].ID, userID, err)
+		}
+	}
+
+	for _, path := range exportFiles {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove export file %s: %v", path, err)
+		}
+	}
+
+	return nil
+}
+
+// PurgeExpiredRecords permanently deletes records of anonymized users whose retention has run out
+func (rs *RetentionService) PurgeExpiredRecords() error {
+	now := time.Now()
+	anonymizedUsers := rs.DB.Unscoped().Model(&models.User{}).Select("id").Where("anonymized_at IS NOT NULL")
+
+	// Financial records
+	result := rs.DB.Unscoped().
+		Where("created_at < ? AND appointment_id IN (?)", now.Add(-rs.FinancialRetention),
+			rs.DB.Unscoped().Model(&models.Appointment{}).Select("id").Where("patient_id IN (?)", anonymizedUsers)).
+		Delete(&models.Payment{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to purge payments: %w", result.Error)
+	}
+	log.Printf("Purged %d payments past their retention period", result.RowsAffected)
+
+	// Clinical records, once no payment still depends on them
+	result = rs.DB.Unscoped().
+		Where("end_time < ? AND patient_id IN (?)", now.Add(-rs.ClinicalRetention), anonymizedUsers).
+		Where("NOT EXISTS (SELECT 1 FROM payments WHERE payments.appointment_id = appointments.id)").
+		Delete(&models.Appointment{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to purge appointments: %w", result.Error)
+	}
+	log.Printf("Purged %d appointments past their retention period", result.RowsAffected)
+
+	// Records that belong to purged appointments
+	for _, orphan := range []struct {
+		model interface{}
+		table string
+		name  string
+	}{
+		{&models.AppointmentEvent{}, "appointment_events", "appointment history"},
+		{&models.AppointmentStatusChange{}, "appointment_status_changes", "appointment status changes"},
+		{&models.AppointmentReschedule{}, "appointment_reschedules", "appointment reschedules"},
+		{&models.AppointmentParticipant{}, "appointment_participants", "appointment participants"},
+		{&models.GuestLink{}, "guest_links", "guest links"},
+		{&models.VideoSessionEvent{}, "video_session_events", "video session events"},
+		{&models.IntakeResponse{}, "intake_responses", "intake answers"},
+	} {
+		result = rs.DB.Unscoped().
+			Where("NOT EXISTS (SELECT 1 FROM appointments WHERE appointments.id = " + orphan.table + ".appointment_id)").
+			Delete(orphan.model)
+		if result.Error != nil {
+			return fmt.Errorf("failed to purge %s: %w", orphan.name, result.Error)
+		}
+	}
+
+	// Reviews of purged appointments, and reviews by anonymized patients
+	// once the clinical retention period has run out
+	result = rs.DB.Unscoped().
+		Where("NOT EXISTS (SELECT 1 FROM appointments WHERE appointments.id = reviews.appointment_id)").
+		Or("created_at < ? AND patient_id IN (?)", now.Add(-rs.ClinicalRetention), anonymizedUsers).
+		Delete(&models.Review{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to purge reviews: %w", result.Error)
+	}
+	result = rs.DB.
+		Where("NOT EXISTS (SELECT 1 FROM reviews WHERE reviews.id = review_reports.review_id)").
+		Delete(&models.ReviewReport{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to purge review reports: %w", result.Error)
+	}
+
+	// Series records once none of their appointments are left
+	result = rs.DB.
+		Where("patient_id IN (?)", anonymizedUsers).
+		Where("NOT EXISTS (SELECT 1 FROM appointments WHERE appointments.series_id = appointment_series.id)").
+		Delete(&models.AppointmentSeries{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to purge appointment series: %w", result.Error)
+	}
+
+	// Memberships of accounts anonymized before memberships were removed with them
+	result = rs.DB.Where("user_id IN (?)", anonymizedUsers).Delete(&models.OrganizationMembership{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to purge organization memberships: %w", result.Error)
+	}
+
+	// Anonymized accounts with nothing left to retain
+	result = rs.DB.Unscoped().
+		Where("anonymized_at IS NOT NULL").
+		Where("NOT EXISTS (SELECT 1 FROM appointments WHERE appointments.patient_id = users.id OR appointments.doctor_id = users.id)").
+		Delete(&models.User{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to purge users: %w", result.Error)
+	}
+	log.Printf("Purged %d anonymized accounts", result.RowsAffected)
+
+	return nil
+}
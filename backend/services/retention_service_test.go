@@ -0,0 +1,147 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/encryption"
+	"github.com/adrianmcmains/telehealth-platform/models"
+	"github.com/adrianmcmains/telehealth-platform/tenancy"
+)
+
+// testDatabaseDSN names the variable holding a throwaway Postgres database
+// for tests that need real foreign keys
+const testDatabaseDSN = "TEST_DATABASE_DSN"
+
+// openTestDB connects to the test database and migrates it, skipping the
+// test when no database is configured
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv(testDatabaseDSN)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDatabaseDSN)
+	}
+
+	keyProvider, err := encryption.NewLocalFileKeyProvider(filepath.Join(t.TempDir(), "field_keys.json"))
+	if err != nil {
+		t.Fatalf("failed to create field encryption keys: %v", err)
+	}
+	encryption.Configure(keyProvider)
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	if err := tenancy.RegisterCallbacks(db); err != nil {
+		t.Fatalf("failed to register tenancy callbacks: %v", err)
+	}
+	if err := config.AutoMigrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	config.DB = db
+	return db
+}
+
+// createMember creates a user who belongs to the organization with the given role
+func createMember(t *testing.T, db *gorm.DB, organizationID uint, role models.UserRole, email string) models.User {
+	t.Helper()
+
+	user := models.User{Email: email, PasswordHash: "!", FirstName: "Test", LastName: string(role), Role: role}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create %s: %v", role, err)
+	}
+	membership := models.OrganizationMembership{OrganizationID: organizationID, UserID: user.ID, Role: role}
+	if err := db.Create(&membership).Error; err != nil {
+		t.Fatalf("failed to add %s to organization: %v", role, err)
+	}
+	return user
+}
+
+func TestPurgeExpiredRecordsRemovesAnonymizedUser(t *testing.T) {
+	db := openTestDB(t)
+	suffix := time.Now().UnixNano()
+
+	organization := models.Organization{Name: "Retention", Slug: fmt.Sprintf("retention-%d", suffix)}
+	if err := db.Create(&organization).Error; err != nil {
+		t.Fatalf("failed to create organization: %v", err)
+	}
+	doctor := createMember(t, db, organization.ID, models.RoleDoctor, fmt.Sprintf("doctor-%d@example.test", suffix))
+	patient := createMember(t, db, organization.ID, models.RolePatient, fmt.Sprintf("patient-%d@example.test", suffix))
+
+	start := time.Now().Add(-48 * time.Hour)
+	appointment := models.Appointment{
+		OrganizationID: organization.ID,
+		PatientID:      patient.ID,
+		DoctorID:       doctor.ID,
+		StartTime:      start,
+		EndTime:        start.Add(30 * time.Minute),
+		Status:         models.StatusCompleted,
+		Reason:         "Follow-up",
+	}
+	if err := db.Create(&appointment).Error; err != nil {
+		t.Fatalf("failed to create appointment: %v", err)
+	}
+
+	review := models.Review{
+		OrganizationID: organization.ID,
+		AppointmentID:  appointment.ID,
+		PatientID:      patient.ID,
+		DoctorID:       doctor.ID,
+		Rating:         4,
+		Comment:        "Very thorough",
+	}
+	if err := db.Create(&review).Error; err != nil {
+		t.Fatalf("failed to create review: %v", err)
+	}
+
+	rs := &RetentionService{
+		DB:                 db,
+		ClinicalRetention:  time.Hour,
+		FinancialRetention: time.Hour,
+		AppointmentService: NewAppointmentService(),
+	}
+	if err := rs.AnonymizeUser(patient.ID); err != nil {
+		t.Fatalf("AnonymizeUser() error = %v", err)
+	}
+	if err := rs.PurgeExpiredRecords(); err != nil {
+		t.Fatalf("PurgeExpiredRecords() error = %v", err)
+	}
+
+	var users int64
+	if err := db.Unscoped().Model(&models.User{}).Where("id = ?", patient.ID).Count(&users).Error; err != nil {
+		t.Fatalf("failed to count users: %v", err)
+	}
+	if users != 0 {
+		t.Errorf("anonymized user %d is still stored after its retention ran out", patient.ID)
+	}
+
+	var appointments int64
+	if err := db.Unscoped().Model(&models.Appointment{}).Where("id = ?", appointment.ID).Count(&appointments).Error; err != nil {
+		t.Fatalf("failed to count appointments: %v", err)
+	}
+	if appointments != 0 {
+		t.Errorf("appointment %d is still stored after its retention ran out", appointment.ID)
+	}
+
+	var reviews int64
+	if err := db.Unscoped().Model(&models.Review{}).Where("id = ?", review.ID).Count(&reviews).Error; err != nil {
+		t.Fatalf("failed to count reviews: %v", err)
+	}
+	if reviews != 0 {
+		t.Errorf("review %d of a purged appointment is still stored", review.ID)
+	}
+
+	// The doctor's account was not deleted and is kept
+	if err := db.First(&models.User{}, doctor.ID).Error; err != nil {
+		t.Errorf("failed to load doctor %d after the purge: %v", doctor.ID, err)
+	}
+}
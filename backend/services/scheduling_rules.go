@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// Errors returned by AvailabilityService.CheckRules
+var (
+	ErrBookingTooSoon    = errors.New("this appointment must be booked further in advance")
+	ErrBookingTooFar     = errors.New("this appointment is too far ahead to book")
+	ErrBufferConflict    = errors.New("the selected time is too close to another appointment")
+	ErrDailyLimitReached = errors.New("the doctor has no more appointments available that day")
+)
+
+// dayKey is the format days are counted under in the doctor's time zone
+const dayKey = "2006-01-02"
+
+// SchedulingRules returns the doctor's rules, or empty rules if none are set
+func (as *AvailabilityService) SchedulingRules(ctx context.Context, doctorID uint) (models.SchedulingRules, error) {
+	var rules []models.SchedulingRules
+	if err := as.DB.WithContext(ctx).Where("doctor_id = ?", doctorID).Limit(1).Find(&rules).Error; err != nil {
+		return models.SchedulingRules{}, fmt.Errorf("failed to load scheduling rules: %w", err)
+	}
+	if len(rules) == 0 {
+		return models.SchedulingRules{DoctorID: doctorID}, nil
+	}
+	return rules[0], nil
+}
+
+// CheckRules checks a booking against the doctor's lead time, booking
+// horizon, buffers and daily cap. Appointments in ignore are the ones being
+// moved and do not count as bookings.
+func (as *AvailabilityService) CheckRules(ctx context.Context, doctorID uint, start, end time.Time, ignore ...uint) error {
+	rules, err := as.SchedulingRules(ctx, doctorID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if start.Before(rules.Earliest(now)) {
+		return ErrBookingTooSoon
+	}
+	if latest, ok := rules.Latest(now); ok && start.After(latest) {
+		return ErrBookingTooFar
+	}
+
+	if padding := rules.BufferBefore() + rules.BufferAfter(); padding > 0 {
+		booked, err := as.bookedRanges(ctx, doctorID, start.Add(-padding), end.Add(padding), ignore...)
+		if err != nil {
+			return err
+		}
+		if tooClose(TimeRange{Start: start, End: end}, booked, rules.BufferBefore(), rules.BufferAfter()) {
+			return ErrBufferConflict
+		}
+	}
+
+	if rules.MaxPerDay > 0 {
+		location := as.DoctorLocation(doctorID)
+		counts, err := as.dailyCounts(ctx, doctorID, location, start, start, ignore...)
+		if err != nil {
+			return err
+		}
+		if counts[start.In(location).Format(dayKey)] >= rules.MaxPerDay {
+			return ErrDailyLimitReached
+		}
+	}
+
+	return nil
+}
+
+// breaksRules reports whether an error from CheckRules is a broken rule
+// rather than a failure to check
+func breaksRules(err error) bool {
+	return errors.Is(err, ErrBookingTooSoon) || errors.Is(err, ErrBookingTooFar) ||
+		errors.Is(err, ErrBufferConflict) || errors.Is(err, ErrDailyLimitReached)
+}
+
+// dailyCounts counts the doctor's active appointments on each day from the
+// day of from to the day of to, keyed by date in the given location,
+// leaving out the appointments in ignore
+func (as *AvailabilityService) dailyCounts(ctx context.Context, doctorID uint, location *time.Location, from, to time.Time, ignore ...uint) (map[string]int, error) {
+	from = from.In(location)
+	to = to.In(location)
+	dayStart := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, location)
+	dayEnd := time.Date(to.Year(), to.Month(), to.Day()+1, 0, 0, 0, 0, location)
+
+	var appointments []models.Appointment
+	if err := as.DB.WithContext(ctx).Select("start_time").Scopes(blocksSlot, ignoring(ignore)).
+		Where("doctor_id = ? AND start_time >= ? AND start_time < ?", doctorID, dayStart, dayEnd).
+		Find(&appointments).Error; err != nil {
+		return nil, fmt.Errorf("failed to count booked appointments: %w", err)
+	}
+
+	counts := make(map[string]int)
+	for _, appointment := range appointments {
+		counts[appointment.StartTime.In(location).Format(dayKey)]++
+	}
+	return counts, nil
+}
+
+// tooClose reports whether a booking or its buffers overlap another booking
+// or that booking's buffers. With no buffers it is a plain overlap check.
+func tooClose(r TimeRange, booked []TimeRange, before, after time.Duration) bool {
+	padded := TimeRange{Start: r.Start.Add(-before), End: r.End.Add(after)}
+	for _, other := range booked {
+		otherPadded := TimeRange{Start: other.Start.Add(-before), End: other.End.Add(after)}
+		if padded.Overlaps(other) || r.Overlaps(otherPadded) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoring leaves the given appointments out of a query
+func ignoring(ids []uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(ids) == 0 {
+			return db
+		}
+		return db.Where("id NOT IN ?", ids)
+	}
+}
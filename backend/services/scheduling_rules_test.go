@@ -0,0 +1,37 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTooClose(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2025, 3, 10, hour, minute, 0, 0, time.UTC)
+	}
+	booking := TimeRange{Start: at(10, 0), End: at(10, 30)}
+
+	tests := []struct {
+		name          string
+		booked        []TimeRange
+		before, after time.Duration
+		want          bool
+	}{
+		{"nothing booked", nil, 10 * time.Minute, 15 * time.Minute, false},
+		{"overlap without buffers", []TimeRange{{Start: at(10, 15), End: at(10, 45)}}, 0, 0, true},
+		{"back to back without buffers", []TimeRange{{Start: at(10, 30), End: at(11, 0)}, {Start: at(9, 30), End: at(10, 0)}}, 0, 0, false},
+		{"next booking inside the buffer after", []TimeRange{{Start: at(10, 44), End: at(11, 15)}}, 10 * time.Minute, 15 * time.Minute, true},
+		{"next booking once the buffer after ends", []TimeRange{{Start: at(10, 45), End: at(11, 15)}}, 10 * time.Minute, 15 * time.Minute, false},
+		{"previous booking's buffer after reaches the start", []TimeRange{{Start: at(9, 0), End: at(9, 50)}}, 10 * time.Minute, 15 * time.Minute, true},
+		{"previous booking clear of both buffers", []TimeRange{{Start: at(9, 0), End: at(9, 45)}}, 10 * time.Minute, 15 * time.Minute, false},
+		{"buffer before only", []TimeRange{{Start: at(9, 0), End: at(9, 55)}}, 10 * time.Minute, 0, true},
+		{"one of several booked is too close", []TimeRange{{Start: at(8, 0), End: at(8, 30)}, {Start: at(10, 34), End: at(11, 0)}}, 0, 5 * time.Minute, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tooClose(booking, tt.booked, tt.before, tt.after); got != tt.want {
+				t.Errorf("tooClose() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/config"
+	"github.com/adrianmcmains/telehealth-platform/models"
+)
+
+// Errors returned when claiming a waitlist offer
+var (
+	ErrOfferClosed  = errors.New("this offer is no longer open")
+	ErrOfferExpired = errors.New("this offer has expired")
+)
+
+// WaitlistService offers freed slots to waitlisted patients, one at a time
+type WaitlistService struct {
+	DB                  *gorm.DB
+	NotificationService *NotificationService
+	AvailabilityService *AvailabilityService
+	// OfferTTL is how long a patient has to claim an offered slot
+	OfferTTL time.Duration
+	// HoldPeriod is how long a claimed paid slot is held for checkout
+	HoldPeriod  time.Duration
+	FrontendURL string
+}
+
+// NewWaitlistService creates a new waitlist service
+func NewWaitlistService() *WaitlistService {
+	return &WaitlistService{
+		DB:                  config.DB,
+		NotificationService: NewNotificationService(config.DB),
+		AvailabilityService: NewAvailabilityService(),
+		OfferTTL:            time.Duration(envInt("WAITLIST_OFFER_MINUTES", 60)) * time.Minute,
+		HoldPeriod:          time.Duration(envInt("SLOT_HOLD_MINUTES", 15)) * time.Minute,
+		FrontendURL:         os.Getenv("FRONTEND_URL"),
+	}
+}
+
+// ClaimURL returns the link a patient follows to claim an offer
+func (ws *WaitlistService) ClaimURL(offer *models.WaitlistOffer) string {
+	return fmt.Sprintf("%s/waitlist/offers/%s", ws.FrontendURL, offer.Token)
+}
+
+// OfferSlot offers the slot an appointment gave up to the longest-waiting
+// patient whose dates cover it and who has not already been offered it. The
+// offer keeps the appointment's visit type, modality and price. Nothing is
+// offered while another offer for the slot is open or once the slot is booked
+// again.
+func (ws *WaitlistService) OfferSlot(freed *models.Appointment) error {
+	organizationID, doctorID := freed.OrganizationID, freed.DoctorID
+	start, end := freed.StartTime, freed.EndTime
+	now := time.Now()
+	if !start.After(now) {
+		return nil
+	}
+
+	booked, err := ws.AvailabilityService.bookedRanges(context.Background(), doctorID, start, end)
+	if err != nil {
+		return err
+	}
+	if overlapsAny(TimeRange{Start: start, End: end}, booked) {
+		return nil
+	}
+	if err := ws.AvailabilityService.CheckRules(context.Background(), doctorID, start, end); err != nil {
+		if breaksRules(err) {
+			return nil
+		}
+		return err
+	}
+
+	var open int64
+	if err := ws.DB.Model(&models.WaitlistOffer{}).
+		Where("doctor_id = ? AND start_time = ? AND status = ?", doctorID, start, models.OfferStatusPending).
+		Count(&open).Error; err != nil {
+		return fmt.Errorf("failed to check open offers: %w", err)
+	}
+	if open > 0 {
+		return nil
+	}
+
+	// Preferred dates are in the doctor's time zone
+	date := start.In(ws.AvailabilityService.DoctorLocation(doctorID)).Format(models.ExceptionDateFormat)
+	alreadyOffered := ws.DB.Model(&models.WaitlistOffer{}).Select("patient_id").
+		Where("doctor_id = ? AND start_time = ?", doctorID, start)
+	var entries []models.WaitlistEntry
+	if err := ws.DB.Preload("Patient").Preload("Doctor").
+		Where("organization_id = ? AND doctor_id = ? AND status = ? AND from_date <= ? AND to_date >= ?",
+			organizationID, doctorID, models.WaitlistStatusWaiting, date, date).
+		Where("patient_id NOT IN (?)", alreadyOffered).
+		Order("created_at ASC").Limit(1).Find(&entries).Error; err != nil {
+		return fmt.Errorf("failed to load waitlist: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	entry := entries[0]
+
+	token, err := generateToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := now.Add(ws.OfferTTL)
+	if start.Before(expiresAt) {
+		expiresAt = start
+	}
+	offer := models.WaitlistOffer{
+		OrganizationID:    organizationID,
+		EntryID:           entry.ID,
+		DoctorID:          doctorID,
+		PatientID:         entry.PatientID,
+		StartTime:         start,
+		EndTime:           end,
+		AppointmentTypeID: freed.AppointmentTypeID,
+		Modality:          freed.Modality,
+		Price:             freed.Price,
+		Token:             token,
+		Status:            models.OfferStatusPending,
+		ExpiresAt:         expiresAt,
+	}
+
+	err = ws.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&offer).Error; err != nil {
+			return err
+		}
+		return tx.Model(&entry).Update("status", models.WaitlistStatusOffered).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create waitlist offer: %w", err)
+	}
+
+	ws.NotificationService.SendWaitlistOffer(&offer, &entry.Patient, &entry.Doctor, ws.ClaimURL(&offer))
+	return nil
+}
+
+// Claim books the offered slot for the patient with the checks any booking
+// gets, holding a paid slot until checkout completes. If the slot was taken
+// or can no longer be booked the offer expires and the patient goes back to
+// waiting.
+func (ws *WaitlistService) Claim(ctx context.Context, offer *models.WaitlistOffer) (*models.Appointment, error) {
+	db := ws.DB.WithContext(ctx)
+
+	if offer.Status != models.OfferStatusPending {
+		return nil, ErrOfferClosed
+	}
+	if offer.IsExpired() {
+		return nil, ErrOfferExpired
+	}
+
+	var entry models.WaitlistEntry
+	if err := db.First(&entry, offer.EntryID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load waitlist entry: %w", err)
+	}
+
+	// The doctor's hours and rules apply as for any booking; an offer that
+	// breaks them can no longer be claimed
+	available, err := ws.AvailabilityService.IsAvailable(ctx, offer.DoctorID, offer.StartTime, offer.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	if !available {
+		ws.expireOffer(offer)
+		return nil, ErrSlotOutsideAvailability
+	}
+	if err := ws.AvailabilityService.CheckRules(ctx, offer.DoctorID, offer.StartTime, offer.EndTime); err != nil {
+		if breaksRules(err) {
+			ws.expireOffer(offer)
+		}
+		return nil, err
+	}
+
+	appointment := models.Appointment{
+		OrganizationID:    offer.OrganizationID,
+		PatientID:         offer.PatientID,
+		DoctorID:          offer.DoctorID,
+		StartTime:         offer.StartTime,
+		EndTime:           offer.EndTime,
+		Status:            models.StatusScheduled,
+		Reason:            entry.Reason,
+		AppointmentTypeID: offer.AppointmentTypeID,
+		Modality:          offer.Modality,
+		Price:             offer.Price,
+	}
+
+	// Paid visits hold the slot until checkout completes
+	if appointment.Price > 0 {
+		holdSlot(&appointment, ws.HoldPeriod)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(offer).Where("status = ?", models.OfferStatusPending).
+			Update("status", models.OfferStatusClaimed)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOfferClosed
+		}
+		if err := ReleaseExpiredHolds(tx, appointment.DoctorID, appointment.StartTime, appointment.EndTime); err != nil {
+			return err
+		}
+		// The overlap constraint rejects the booking if the slot was taken
+		if err := tx.Create(&appointment).Error; err != nil {
+			return err
+		}
+		// The offer link is the patient's own, so the booking is theirs
+		patient := Actor{ID: offer.PatientID, Role: models.RolePatient}
+		if err := RecordAppointmentEvent(tx, &appointment, models.AppointmentEventCreated, patient, models.DiffAppointment(nil, &appointment), ""); err != nil {
+			return err
+		}
+		if err := tx.Model(offer).Update("appointment_id", appointment.ID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&entry).Updates(map[string]interface{}{
+			"status":         models.WaitlistStatusBooked,
+			"appointment_id": appointment.ID,
+		}).Error
+	})
+	if config.IsExclusionViolation(err) {
+		ws.expireOffer(offer)
+		return nil, ErrSlotUnavailable
+	}
+	if err != nil {
+		return nil, err
+	}
+	offer.Status = models.OfferStatusClaimed
+	offer.AppointmentID = &appointment.ID
+
+	// Load related entities for notification; held slots are confirmed once paid
+	if err := db.Preload("Patient").Preload("Doctor").First(&appointment, appointment.ID).Error; err != nil {
+		log.Printf("Failed to load appointment %d for notification: %v", appointment.ID, err)
+	} else if appointment.Status == models.StatusScheduled {
+		go ws.NotificationService.SendAppointmentNotification(&appointment, NotificationTypeAppointmentConfirmation)
+	}
+
+	return &appointment, nil
+}
+
+// Decline turns an offer down and passes the slot to the next patient
+func (ws *WaitlistService) Decline(offer *models.WaitlistOffer) error {
+	if offer.Status != models.OfferStatusPending {
+		return ErrOfferClosed
+	}
+	if err := ws.closeOffer(offer, models.OfferStatusDeclined); err != nil {
+		return err
+	}
+	go ws.offerNext(offer)
+	return nil
+}
+
+// ExpireOffers closes offers that were not claimed in time, passing each slot
+// to the next patient, and removes entries whose preferred dates have passed
+func (ws *WaitlistService) ExpireOffers() error {
+	var offers []models.WaitlistOffer
+	if err := ws.DB.Where("status = ? AND expires_at < ?", models.OfferStatusPending, time.Now()).
+		Find(&offers).Error; err != nil {
+		return fmt.Errorf("failed to load expired offers: %w", err)
+	}
+
+	for i := range offers {
+		if err := ws.closeOffer(&offers[i], models.OfferStatusExpired); err != nil {
+			log.Printf("Failed to expire waitlist offer %d: %v", offers[i].ID, err)
+			continue
+		}
+		ws.offerNext(&offers[i])
+	}
+
+	// Allow a day for time zones ahead of UTC
+	cutoff := time.Now().UTC().AddDate(0, 0, -1).Format(models.ExceptionDateFormat)
+	if err := ws.DB.Model(&models.WaitlistEntry{}).
+		Where("status = ? AND to_date < ?", models.WaitlistStatusWaiting, cutoff).
+		Update("status", models.WaitlistStatusExpired).Error; err != nil {
+		return fmt.Errorf("failed to expire waitlist entries: %w", err)
+	}
+
+	return nil
+}
+
+// Leave removes an entry from the waitlist, passing on any slot it was offered
+func (ws *WaitlistService) Leave(ctx context.Context, entry *models.WaitlistEntry) error {
+	db := ws.DB.WithContext(ctx)
+
+	var offers []models.WaitlistOffer
+	if err := db.Where("entry_id = ? AND status = ?", entry.ID, models.OfferStatusPending).
+		Find(&offers).Error; err != nil {
+		return fmt.Errorf("failed to load open offers: %w", err)
+	}
+
+	if err := db.Model(entry).Update("status", models.WaitlistStatusCancelled).Error; err != nil {
+		return fmt.Errorf("failed to leave waitlist: %w", err)
+	}
+
+	for i := range offers {
+		if err := ws.closeOffer(&offers[i], models.OfferStatusDeclined); err != nil {
+			log.Printf("Failed to decline waitlist offer %d: %v", offers[i].ID, err)
+			continue
+		}
+		go ws.offerNext(&offers[i])
+	}
+	return nil
+}
+
+// closeOffer ends a pending offer and puts a patient who is still waiting back in line
+func (ws *WaitlistService) closeOffer(offer *models.WaitlistOffer, status models.WaitlistOfferStatus) error {
+	return ws.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(offer).Where("status = ?", models.OfferStatusPending).Update("status", status)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOfferClosed
+		}
+		offer.Status = status
+		return tx.Model(&models.WaitlistEntry{}).
+			Where("id = ? AND status = ?", offer.EntryID, models.WaitlistStatusOffered).
+			Update("status", models.WaitlistStatusWaiting).Error
+	})
+}
+
+// expireOffer closes an offer whose slot can no longer be booked
+func (ws *WaitlistService) expireOffer(offer *models.WaitlistOffer) {
+	if err := ws.closeOffer(offer, models.OfferStatusExpired); err != nil {
+		log.Printf("Failed to expire waitlist offer %d: %v", offer.ID, err)
+	}
+}
+
+// offerNext offers a closed offer's slot to the next patient
+func (ws *WaitlistService) offerNext(offer *models.WaitlistOffer) {
+	slot := models.Appointment{
+		OrganizationID:    offer.OrganizationID,
+		DoctorID:          offer.DoctorID,
+		StartTime:         offer.StartTime,
+		EndTime:           offer.EndTime,
+		AppointmentTypeID: offer.AppointmentTypeID,
+		Modality:          offer.Modality,
+		Price:             offer.Price,
+	}
+	if err := ws.OfferSlot(&slot); err != nil {
+		log.Printf("Failed to offer slot to the next waitlisted patient: %v", err)
+	}
+}
+
+// generateToken creates a random token for secret links
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
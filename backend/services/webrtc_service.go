@@ -2,6 +2,7 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,6 +11,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+
+	"github.com/adrianmcmains/telehealth-platform/models"
 )
 
 const (
@@ -21,6 +25,19 @@ const (
 
 	// Send pings to peer with this period (must be less than pongWait)
 	pingPeriod = (pongWait * 9) / 10
+
+	// How often a room checks its appointment is still open
+	roomCheckPeriod = 30 * time.Second
+)
+
+// GuestPINHeader carries a guest link's PIN, so it stays out of URLs and access logs
+const GuestPINHeader = "X-Guest-PIN"
+
+// webRTCServices are the running signaling services, so a revoked guest link
+// can disconnect its guest at once
+var (
+	webRTCServices     []*WebRTCService
+	webRTCServicesLock sync.RWMutex
 )
 
 // WebRTCMessage represents a WebRTC signaling message
@@ -33,17 +50,24 @@ type WebRTCMessage struct {
 
 // Client represents a connected client
 type Client struct {
-	Conn     *websocket.Conn
-	UserID   uint
-	RoomID   string
-	Messages chan []byte
+	Conn          *websocket.Conn
+	UserID        uint
+	RoomID        string
+	Messages      chan []byte
+	AppointmentID uint // the appointment the room is for
+	// PeerID identifies the client to the others in the room: the user's ID,
+	// or "guest-" and the link's ID for a guest
+	PeerID      string
+	DisplayName string // set for guests, who have no account to name them
+	GuestLinkID uint   // the link a guest joined with, or 0 for users
 }
 
 // Room represents a video session room
 type Room struct {
-	ID      string
-	Clients map[uint]*Client
-	Lock    sync.RWMutex
+	ID            string
+	AppointmentID uint
+	Clients       map[string]*Client
+	Lock          sync.RWMutex
 }
 
 // WebRTCService manages WebRTC signaling
@@ -51,12 +75,16 @@ type WebRTCService struct {
 	Rooms      map[string]*Room
 	Lock       sync.RWMutex
 	Upgrader   websocket.Upgrader
+	Attendance *AttendanceService
+	GuestLinks *GuestLinkService
 }
 
 // NewWebRTCService creates a new WebRTC service
 func NewWebRTCService() *WebRTCService {
-	return &WebRTCService{
-		Rooms: make(map[string]*Room),
+	s := &WebRTCService{
+		Rooms:      make(map[string]*Room),
+		Attendance: NewAttendanceService(),
+		GuestLinks: NewGuestLinkService(),
 		Upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
@@ -66,6 +94,36 @@ func NewWebRTCService() *WebRTCService {
 			},
 		},
 	}
+
+	webRTCServicesLock.Lock()
+	webRTCServices = append(webRTCServices, s)
+	webRTCServicesLock.Unlock()
+	return s
+}
+
+// DisconnectGuest drops the guest who joined with a link from every room
+func DisconnectGuest(linkID uint) {
+	webRTCServicesLock.RLock()
+	defer webRTCServicesLock.RUnlock()
+
+	for _, s := range webRTCServices {
+		s.Lock.RLock()
+		var guests []*Client
+		for _, room := range s.Rooms {
+			room.Lock.RLock()
+			for _, client := range room.Clients {
+				if client.GuestLinkID == linkID {
+					guests = append(guests, client)
+				}
+			}
+			room.Lock.RUnlock()
+		}
+		s.Lock.RUnlock()
+
+		for _, client := range guests {
+			client.disconnect("The guest link has been revoked")
+		}
+	}
 }
 
 // HandleWebSocket handles a new WebSocket connection
@@ -82,6 +140,24 @@ func (s *WebRTCService) HandleWebSocket(c *gin.Context) {
 		return
 	}
 
+	// Rooms are open only to the people on the appointment, around its time
+	appointment, err := s.Attendance.RoomAppointment(roomID, userID.(uint))
+	switch {
+	case errors.Is(err, ErrRoomNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Video room not found"})
+		return
+	case errors.Is(err, ErrRoomForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ErrRoomClosed):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("Failed to check access to video room %s: %v", roomID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access to the video room"})
+		return
+	}
+
 	// Upgrade HTTP connection to WebSocket
 	conn, err := s.Upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -91,10 +167,65 @@ func (s *WebRTCService) HandleWebSocket(c *gin.Context) {
 
 	// Create client
 	client := &Client{
-		Conn:     conn,
-		UserID:   userID.(uint),
-		RoomID:   roomID,
-		Messages: make(chan []byte, 100),
+		Conn:          conn,
+		UserID:        userID.(uint),
+		RoomID:        roomID,
+		Messages:      make(chan []byte, 100),
+		AppointmentID: appointment.ID,
+		PeerID:        fmt.Sprint(userID),
+	}
+
+	// Track attendance
+	s.Attendance.Record(appointment.ID, client.UserID, models.VideoSessionJoined)
+
+	// Add client to room
+	s.joinRoom(client)
+
+	// Start client routines
+	go client.writePump()
+	go client.readPump(s)
+}
+
+// HandleGuestWebSocket lets a guest join the one room their link is for,
+// under the link's display name
+func (s *WebRTCService) HandleGuestWebSocket(c *gin.Context) {
+	link, appointment, err := s.GuestLinks.Open(c.Param("token"), c.GetHeader(GuestPINHeader))
+	switch {
+	case errors.Is(err, ErrGuestLinkNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Guest link not found"})
+		return
+	case errors.Is(err, ErrGuestLinkClosed):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, ErrGuestLinkPIN):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("Failed to open guest link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open the guest link"})
+		return
+	}
+	if !s.Attendance.RoomOpen(appointment, time.Now()) {
+		c.JSON(http.StatusGone, gin.H{"error": ErrRoomClosed.Error()})
+		return
+	}
+
+	// Upgrade HTTP connection to WebSocket
+	conn, err := s.Upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade connection: %v", err)
+		return
+	}
+
+	// Create client; guests are not counted for attendance
+	client := &Client{
+		Conn:          conn,
+		RoomID:        appointment.VideoRoomID,
+		Messages:      make(chan []byte, 100),
+		AppointmentID: appointment.ID,
+		PeerID:        fmt.Sprintf("guest-%d", link.ID),
+		DisplayName:   link.DisplayName,
+		GuestLinkID:   link.ID,
 	}
 
 	// Add client to room
@@ -114,17 +245,19 @@ func (s *WebRTCService) joinRoom(client *Client) {
 	if !exists {
 		// Create new room if it doesn't exist
 		room = &Room{
-			ID:      client.RoomID,
-			Clients: make(map[uint]*Client),
+			ID:            client.RoomID,
+			AppointmentID: client.AppointmentID,
+			Clients:       make(map[string]*Client),
 		}
 		s.Rooms[client.RoomID] = room
+		go s.watchRoom(room)
 	}
 
 	room.Lock.Lock()
 	defer room.Lock.Unlock()
 
 	// Add client to room
-	room.Clients[client.UserID] = client
+	room.Clients[client.PeerID] = client
 
 	// Notify other clients about the new client
 	s.broadcastJoin(client)
@@ -143,8 +276,10 @@ func (s *WebRTCService) leaveRoom(client *Client) {
 	room.Lock.Lock()
 	defer room.Lock.Unlock()
 
-	// Remove client from room
-	delete(room.Clients, client.UserID)
+	// Remove client from room, unless the same peer has connected again since
+	if room.Clients[client.PeerID] == client {
+		delete(room.Clients, client.PeerID)
+	}
 
 	// If room is empty, remove it
 	if len(room.Clients) == 0 {
@@ -155,6 +290,59 @@ func (s *WebRTCService) leaveRoom(client *Client) {
 	}
 }
 
+// watchRoom closes a room once its appointment is cancelled or settled, or
+// its closing time has passed. It stops when the room empties.
+func (s *WebRTCService) watchRoom(room *Room) {
+	ticker := time.NewTicker(roomCheckPeriod)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.Lock.RLock()
+		current := s.Rooms[room.ID]
+		s.Lock.RUnlock()
+		if current != room {
+			return
+		}
+
+		var appointment models.Appointment
+		if err := s.Attendance.DB.First(&appointment, room.AppointmentID).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("Failed to check video room for appointment %d: %v", room.AppointmentID, err)
+				continue
+			}
+		} else if s.Attendance.RoomOpen(&appointment, time.Now()) {
+			continue
+		}
+
+		s.closeRoom(room)
+		return
+	}
+}
+
+// closeRoom disconnects everyone in a room. Each client's read loop then
+// leaves the room and records the departure.
+func (s *WebRTCService) closeRoom(room *Room) {
+	room.Lock.RLock()
+	clients := make([]*Client, 0, len(room.Clients))
+	for _, client := range room.Clients {
+		clients = append(clients, client)
+	}
+	room.Lock.RUnlock()
+
+	log.Printf("Closing video room for appointment %d", room.AppointmentID)
+	for _, client := range clients {
+		client.disconnect("The video room has closed")
+	}
+}
+
+// disconnect closes a client's connection with a reason. Its read loop then
+// leaves the room.
+func (c *Client) disconnect(reason string) {
+	message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason)
+	c.Conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeWait))
+	c.Conn.Close()
+}
+
 // broadcastJoin notifies other clients about a new client
 func (s *WebRTCService) broadcastJoin(client *Client) {
 	room := s.Rooms[client.RoomID]
@@ -164,7 +352,10 @@ func (s *WebRTCService) broadcastJoin(client *Client) {
 
 	message := WebRTCMessage{
 		Type: "user-joined",
-		From: fmt.Sprint(client.UserID),
+		From: client.PeerID,
+	}
+	if client.GuestLinkID != 0 {
+		message.Data, _ = json.Marshal(gin.H{"guest": true, "displayName": client.DisplayName})
 	}
 
 	jsonMsg, err := json.Marshal(message)
@@ -174,7 +365,7 @@ func (s *WebRTCService) broadcastJoin(client *Client) {
 	}
 
 	for id, c := range room.Clients {
-		if id != client.UserID {
+		if id != client.PeerID {
 			c.Messages <- jsonMsg
 		}
 	}
@@ -189,7 +380,7 @@ func (s *WebRTCService) broadcastLeave(client *Client) {
 
 	message := WebRTCMessage{
 		Type: "user-left",
-		From: fmt.Sprint(client.UserID),
+		From: client.PeerID,
 	}
 
 	jsonMsg, err := json.Marshal(message)
@@ -199,7 +390,7 @@ func (s *WebRTCService) broadcastLeave(client *Client) {
 	}
 
 	for id, c := range room.Clients {
-		if id != client.UserID {
+		if id != client.PeerID {
 			c.Messages <- jsonMsg
 		}
 	}
@@ -220,16 +411,13 @@ func (s *WebRTCService) broadcastMessage(message *WebRTCMessage, fromClient *Cli
 
 	// If the message has a specific recipient
 	if message.To != "" {
-		for id, client := range room.Clients {
-			if fmt.Sprint(id) == message.To {
-				jsonMsg, err := json.Marshal(message)
-				if err != nil {
-					log.Printf("Failed to marshal message: %v", err)
-					return
-				}
-				client.Messages <- jsonMsg
+		if client, ok := room.Clients[message.To]; ok {
+			jsonMsg, err := json.Marshal(message)
+			if err != nil {
+				log.Printf("Failed to marshal message: %v", err)
 				return
 			}
+			client.Messages <- jsonMsg
 		}
 	} else {
 		// Broadcast to all clients in the room except the sender
@@ -240,7 +428,7 @@ func (s *WebRTCService) broadcastMessage(message *WebRTCMessage, fromClient *Cli
 		}
 
 		for id, client := range room.Clients {
-			if id != fromClient.UserID {
+			if id != fromClient.PeerID {
 				client.Messages <- jsonMsg
 			}
 		}
@@ -253,6 +441,9 @@ func (c *Client) readPump(s *WebRTCService) {
 		s.leaveRoom(c)
 		c.Conn.Close()
 		close(c.Messages)
+		if c.GuestLinkID == 0 {
+			s.Attendance.Record(c.AppointmentID, c.UserID, models.VideoSessionLeft)
+		}
 	}()
 
 	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
@@ -276,7 +467,12 @@ func (c *Client) readPump(s *WebRTCService) {
 			continue
 		}
 
-		webRTCMessage.From = fmt.Sprint(c.UserID)
+		// Guests lose signaling as soon as their link is revoked or expires
+		if c.GuestLinkID != 0 && !s.GuestLinks.IsOpen(c.GuestLinkID) {
+			break
+		}
+
+		webRTCMessage.From = c.PeerID
 		s.broadcastMessage(&webRTCMessage, c)
 	}
 }
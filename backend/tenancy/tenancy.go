@@ -0,0 +1,97 @@
+// Package tenancy isolates organizations from each other. Every query, update,
+// delete and create on a model with an OrganizationID field is scoped to the
+// organization carried in the statement context, so controllers only need to
+// run their queries with the request context.
+package tenancy
+
+import (
+	"context"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// organizationField is the model field that marks a tenant-owned table
+const organizationField = "OrganizationID"
+
+type contextKey struct{}
+
+// WithOrganization returns a context whose queries are scoped to an organization
+func WithOrganization(ctx context.Context, organizationID uint) context.Context {
+	return context.WithValue(ctx, contextKey{}, organizationID)
+}
+
+// OrganizationFromContext returns the organization a context is scoped to
+func OrganizationFromContext(ctx context.Context) (uint, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	organizationID, ok := ctx.Value(contextKey{}).(uint)
+	return organizationID, ok && organizationID != 0
+}
+
+// RegisterCallbacks installs the organization scoping callbacks on a database handle
+func RegisterCallbacks(db *gorm.DB) error {
+	if err := db.Callback().Query().Before("gorm:query").Register("tenancy:scope_query", scopeStatement); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register("tenancy:scope_row", scopeStatement); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("tenancy:scope_update", scopeStatement); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("gorm:delete").Register("tenancy:scope_delete", scopeStatement); err != nil {
+		return err
+	}
+	return db.Callback().Create().Before("gorm:create").Register("tenancy:assign_create", assignOrganization)
+}
+
+// MembersWithRole limits a user query to members of an organization holding a role
+func MembersWithRole(organizationID uint, role string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("users.id IN (SELECT user_id FROM organization_memberships WHERE organization_id = ? AND role = ?)",
+			organizationID, role)
+	}
+}
+
+// scopeStatement adds an organization filter to statements on tenant-owned tables
+func scopeStatement(db *gorm.DB) {
+	organizationID, ok := OrganizationFromContext(db.Statement.Context)
+	if !ok || db.Statement.Schema == nil {
+		return
+	}
+
+	field := db.Statement.Schema.LookUpField(organizationField)
+	if field == nil {
+		return
+	}
+
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: organizationID},
+	}})
+}
+
+// assignOrganization stamps new tenant-owned records with the context's organization
+func assignOrganization(db *gorm.DB) {
+	organizationID, ok := OrganizationFromContext(db.Statement.Context)
+	if !ok || db.Statement.Schema == nil {
+		return
+	}
+
+	field := db.Statement.Schema.LookUpField(organizationField)
+	if field == nil {
+		return
+	}
+
+	ctx := db.Statement.Context
+	switch db.Statement.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < db.Statement.ReflectValue.Len(); i++ {
+			db.AddError(field.Set(ctx, reflect.Indirect(db.Statement.ReflectValue.Index(i)), organizationID))
+		}
+	case reflect.Struct:
+		db.AddError(field.Set(ctx, db.Statement.ReflectValue, organizationID))
+	}
+}